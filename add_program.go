@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/csxuejin/supervisord/faults"
+	"github.com/csxuejin/supervisord/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// the name of a program added at runtime is also the name of its file
+var programNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// the keys of an option in ProgramConfig.Options
+var optionKeyRegexp = regexp.MustCompile(`^[a-z_]+$`)
+
+// AddProgram adds a new program at runtime without editing the
+// configuration file. The program is saved to "<name>.conf" in the
+// "programs_dir" of [supervisord] section, so it is loaded again after
+// supervisord is restarted, and it is started if it is autostart. A program
+// already loaded is not added again
+func (s *Supervisor) AddProgram(r *http.Request, args *struct{ Config types.ProgramConfig }, reply *struct{ Success bool }) error {
+	programConfig := args.Config
+	programConfig.Name = strings.TrimSpace(programConfig.Name)
+	content, err := formatProgramConfig(programConfig)
+	if err != nil {
+		return faults.NewFault(faults.BAD_ARGUMENTS, fmt.Sprintf("BAD_ARGUMENTS: %v", err))
+	}
+	name := programConfig.Name
+
+	// the program is not lost by a reload replacing the configuration
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	dir := s.config.GetProgramsDir()
+	if dir == "" {
+		return faults.NewFault(faults.FAILED, "FAILED: programs_dir is not set in [supervisord]")
+	}
+	if s.config.GetProgram(name) != nil || s.procMgr.Find(name) != nil {
+		return faults.NewFault(faults.ALREADY_ADDED, fmt.Sprintf("ALREADY_ADDED: %s", name))
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return faults.NewFault(faults.FAILED, fmt.Sprintf("FAILED: %v", err))
+	}
+	fileName := s.config.GetProgramFile(name)
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return faults.NewFault(faults.ALREADY_ADDED, fmt.Sprintf("ALREADY_ADDED: %s", name))
+	}
+	if err != nil {
+		return faults.NewFault(faults.FAILED, fmt.Sprintf("FAILED: %v", err))
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fileName)
+		return faults.NewFault(faults.FAILED, fmt.Sprintf("FAILED: %v", err))
+	}
+	programs, err := s.config.AddProgramFile(fileName)
+	if err != nil {
+		os.Remove(fileName)
+		return faults.NewFault(faults.BAD_ARGUMENTS, fmt.Sprintf("BAD_ARGUMENTS: %v", err))
+	}
+	log.WithFields(log.Fields{"program": name, "file": fileName}).Info("the program is added")
+	for _, program := range programs {
+		s.procMgr.CreateProcess(s.GetSupervisorId(), s.config.GetProgram(program))
+	}
+	s.procMgr.StartAutoStartProgramsIn(programs)
+	reply.Success = true
+	return nil
+}
+
+// the comments and the string expressions can't be escaped in the values
+// of the configuration file
+var unsafeValueRegexp = regexp.MustCompile(`[;#]|%\(`)
+
+// format the program section of the program config, the values are checked
+// so they can't break the section or be changed when it is loaded
+func formatProgramConfig(programConfig types.ProgramConfig) ([]byte, error) {
+	if !programNameRegexp.MatchString(programConfig.Name) {
+		return nil, fmt.Errorf("invalid program name %s", programConfig.Name)
+	}
+	if programConfig.Command == "" {
+		return nil, fmt.Errorf("no command of program %s", programConfig.Name)
+	}
+	settings := [][2]string{{"command", programConfig.Command},
+		{"directory", programConfig.Directory},
+		{"user", programConfig.User},
+		{"autostart", fmt.Sprintf("%v", programConfig.Autostart)},
+		{"autorestart", programConfig.Autorestart}}
+
+	env := make([]string, 0)
+	for _, v := range programConfig.Environment {
+		pos := strings.Index(v, "=")
+		// the spaces around the value are trimmed when it is loaded
+		if pos <= 0 || strings.Contains(v, "\"") || strings.TrimSpace(v[pos+1:]) != v[pos+1:] {
+			return nil, fmt.Errorf("invalid environment %s", v)
+		}
+		env = append(env, fmt.Sprintf("%s=\"%s\"", v[0:pos], v[pos+1:]))
+	}
+	settings = append(settings, [2]string{"environment", strings.Join(env, ",")})
+
+	for _, option := range programConfig.Options {
+		pos := strings.Index(option, "=")
+		if pos <= 0 || !optionKeyRegexp.MatchString(option[0:pos]) {
+			return nil, fmt.Errorf("invalid option %s", option)
+		}
+		key := option[0:pos]
+		for _, setting := range settings {
+			if setting[0] == key {
+				return nil, fmt.Errorf("option %s is set by the program config", key)
+			}
+		}
+		settings = append(settings, [2]string{key, option[pos+1:]})
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0))
+	fmt.Fprintf(buf, "[program:%s]\n", programConfig.Name)
+	for _, setting := range settings {
+		if setting[1] == "" {
+			continue
+		}
+		if strings.ContainsAny(setting[1], "\r\n") {
+			return nil, fmt.Errorf("invalid %s of program %s", setting[0], programConfig.Name)
+		}
+		if unsafeValueRegexp.MatchString(setting[1]) {
+			return nil, fmt.Errorf("the %s of program %s can't contain ';', '#' or '%%('", setting[0], programConfig.Name)
+		}
+		fmt.Fprintf(buf, "%s=%s\n", setting[0], setting[1])
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/csxuejin/supervisord/faults"
+	"github.com/csxuejin/supervisord/process"
+	"github.com/csxuejin/supervisord/types"
+	"github.com/csxuejin/supervisord/xmlrpcclient"
+)
+
+func TestAddProgram(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	conf := "[supervisord]\nprograms_dir=%(here)s/programs\n[program:a]\ncommand=/bin/sleep 60\nautostart=false\n"
+	s := createTestSupervisor(t, dir, conf)
+	defer s.procMgr.StopAllProcesses()
+
+	args := struct{ Config types.ProgramConfig }{types.ProgramConfig{Name: "web",
+		Command:     "/bin/sleep 60",
+		Environment: []string{"PORT=8080"},
+		Autostart:   true,
+		Options:     []string{"startsecs=0"}}}
+	reply := struct{ Success bool }{}
+	if err := s.AddProgram(nil, &args, &reply); err != nil || !reply.Success {
+		t.Fatalf("Fail to add the program: %v", err)
+	}
+	proc := s.procMgr.Find("web")
+	if proc == nil || proc.GetState() != process.RUNNING {
+		t.Fatalf("The autostart program is not started after it is added")
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "programs", "web.conf"))
+	if !strings.Contains(string(b), "command=/bin/sleep 60\n") || !strings.Contains(string(b), "environment=PORT=\"8080\"\n") || !strings.Contains(string(b), "startsecs=0\n") {
+		t.Errorf("Wrong saved program:\n%s", b)
+	}
+
+	//the duplicated programs are rejected
+	for _, name := range []string{"web", "a"} {
+		args.Config.Name = name
+		err := s.AddProgram(nil, &args, &reply)
+		if err == nil || !strings.Contains(err.Error(), "ALREADY_ADDED") {
+			t.Errorf("The duplicated program %s should be rejected, err=%v", name, err)
+		}
+	}
+	args.Config.Name = "../web"
+	if err := s.AddProgram(nil, &args, &reply); err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") {
+		t.Errorf("The invalid program name should be rejected, err=%v", err)
+	}
+
+	//the added program is loaded again after restart
+	restarted := NewSupervisor(filepath.Join(dir, "supervisord.conf"))
+	if programs, err := restarted.config.Load(); err != nil || len(programs) != 2 || restarted.config.GetProgram("web") == nil {
+		t.Errorf("The added program is not loaded again, programs=%v, err=%v", programs, err)
+	}
+}
+
+func TestAddProgramLoadedBack(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\nprograms_dir=%(here)s/programs\n")
+	defer s.procMgr.StopAllProcesses()
+
+	config := types.ProgramConfig{Name: "web",
+		Command:     `/bin/sh -c "echo '  two  spaces  ' && exec sleep 60"`,
+		Environment: []string{"GREETING=hello  world"},
+		Options:     []string{"stopsignal=INT", "startsecs=0"}}
+	reply := struct{ Success bool }{}
+	if err := s.AddProgram(nil, &struct{ Config types.ProgramConfig }{config}, &reply); err != nil || !reply.Success {
+		t.Fatalf("Fail to add the program: %v", err)
+	}
+
+	//the values are not changed by writing and loading the file
+	loaded := NewSupervisor(filepath.Join(dir, "supervisord.conf"))
+	if _, err := loaded.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	entry := loaded.config.GetProgram("web")
+	if entry == nil {
+		t.Fatal("The added program is not loaded")
+	}
+	if command := entry.GetString("command", ""); command != config.Command {
+		t.Errorf("Wrong loaded command %q", command)
+	}
+	if env := entry.GetEnv("environment"); len(env) != 1 || env[0] != config.Environment[0] {
+		t.Errorf("Wrong loaded environment %q", env)
+	}
+	if entry.GetString("stopsignal", "") != "INT" || entry.GetInt("startsecs", 1) != 0 {
+		t.Errorf("Wrong loaded options")
+	}
+}
+
+func TestAddProgramUnsafeValues(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\nprograms_dir=%(here)s/programs\n")
+
+	//the comments and the string expressions can't be saved unchanged
+	configs := []types.ProgramConfig{
+		{Name: "web", Command: "/bin/sleep 60; rm -rf /tmp/x"},
+		{Name: "web", Command: "/bin/sleep 60 # comment"},
+		{Name: "web", Command: "/bin/sleep %(ENV_TIME)s"},
+		{Name: "web", Command: "/bin/sleep 60", Environment: []string{"A=1;2"}},
+		{Name: "web", Command: "/bin/sleep 60", Environment: []string{"A= 1 "}},
+		{Name: "web", Command: "/bin/sleep 60", Directory: "%(here)s"},
+		{Name: "web", Command: "/bin/sleep 60", Options: []string{"stdout_logfile=/tmp/#web.log"}},
+	}
+	for _, config := range configs {
+		reply := struct{ Success bool }{}
+		err := s.AddProgram(nil, &struct{ Config types.ProgramConfig }{config}, &reply)
+		if err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") || reply.Success {
+			t.Errorf("The unsafe program config %v should be rejected, err=%v", config, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "programs", "web.conf")); err == nil {
+		t.Error("The rejected program should not be saved")
+	}
+}
+
+func TestAddProgramWithoutProgramsDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\n")
+
+	args := struct{ Config types.ProgramConfig }{types.ProgramConfig{Name: "web", Command: "/bin/sleep 60"}}
+	reply := struct{ Success bool }{}
+	err := s.AddProgram(nil, &args, &reply)
+	if err == nil || !strings.Contains(err.Error(), "programs_dir") || reply.Success {
+		t.Errorf("The program should not be added without programs_dir, err=%v", err)
+	}
+}
+
+func TestAddProgramByClient(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\nprograms_dir=programs\n")
+	defer s.procMgr.StopAllProcesses()
+
+	addr := freeTCPAddr(t)
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartInetHttpServer("", "", addr, s); err != nil {
+		t.Fatal(err)
+	}
+	client := xmlrpcclient.NewXmlRPCClient("http://" + addr)
+	config := types.ProgramConfig{Name: "worker", Command: "/bin/sleep 60", Autorestart: "false"}
+	if reply, err := client.AddProgram(config); err != nil || !reply.Value {
+		t.Fatalf("Fail to add the program by client: %v", err)
+	}
+	entry := s.config.GetProgram("worker")
+	if entry == nil || entry.GetString("directory", "") != "" || entry.GetString("autorestart", "") != "false" || entry.GetBool("autostart", true) {
+		t.Errorf("The program is not added by client with its config")
+	}
+	_, err := client.AddProgram(config)
+	if !xmlrpcclient.IsFault(err, faults.ALREADY_ADDED) {
+		t.Errorf("The duplicated program should be rejected, err=%v", err)
+	}
+}
+
+func TestAddProgramWhileReloading(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[supervisord]\nprograms_dir=%(here)s/programs\n[program:a]\ncommand=/bin/sleep 60\nautostart=false\n"), os.ModePerm)
+	s := NewSupervisor(configFile)
+	if _, err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			s.Reload()
+		}
+	}()
+	names := []string{"web0", "web1", "web2", "web3", "web4"}
+	for _, name := range names {
+		args := struct{ Config types.ProgramConfig }{types.ProgramConfig{Name: name, Command: "/bin/sleep 60"}}
+		if err := s.AddProgram(nil, &args, &struct{ Success bool }{}); err != nil {
+			t.Errorf("Fail to add the program %s: %v", name, err)
+		}
+	}
+	<-done
+	for _, name := range names {
+		if s.config.GetProgram(name) == nil || s.procMgr.Find(name) == nil {
+			t.Errorf("The added program %s is lost by the reload", name)
+		}
+	}
+}
@@ -3,10 +3,10 @@ package config
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -19,15 +19,24 @@ type ConfigEntry struct {
 	Group     string
 	Name      string
 	keyValues map[string]string
+	//the environment of [supervisord] section inherited by the program
+	inheritedEnv string
 }
 
+// check if the entry is a program, the fcgi-program is also a program
 func (c *ConfigEntry) IsProgram() bool {
-	return strings.HasPrefix(c.Name, "program:")
+	return strings.HasPrefix(c.Name, "program:") || c.IsFcgiProgram()
+}
+
+func (c *ConfigEntry) IsFcgiProgram() bool {
+	return strings.HasPrefix(c.Name, "fcgi-program:")
 }
 
 func (c *ConfigEntry) GetProgramName() string {
 	if strings.HasPrefix(c.Name, "program:") {
 		return c.Name[len("program:"):]
+	} else if c.IsFcgiProgram() {
+		return c.Name[len("fcgi-program:"):]
 	}
 	return ""
 }
@@ -67,6 +76,13 @@ func (c *ConfigEntry) GetPrograms() []string {
 	return make([]string, 0)
 }
 
+// check if the entry has the same configuration as the other entry
+func (c *ConfigEntry) IsSame(other *ConfigEntry) bool {
+	return other != nil && c.Name == other.Name && c.Group == other.Group &&
+		c.ConfigDir == other.ConfigDir && c.inheritedEnv == other.inheritedEnv &&
+		reflect.DeepEqual(c.keyValues, other.keyValues)
+}
+
 func (c *ConfigEntry) setGroup(group string) {
 	c.Group = group
 }
@@ -89,14 +105,16 @@ type Config struct {
 	entries map[string]*ConfigEntry
 
 	ProgramGroup *ProcessGroup
+	//the environment of [supervisord] section
+	globalEnv string
 }
 
 func NewConfigEntry(configDir string) *ConfigEntry {
-	return &ConfigEntry{configDir, "", "", make(map[string]string)}
+	return &ConfigEntry{ConfigDir: configDir, keyValues: make(map[string]string)}
 }
 
 func NewConfig(configFile string) *Config {
-	return &Config{configFile, make(map[string]*ConfigEntry), NewProcessGroup()}
+	return &Config{configFile: configFile, entries: make(map[string]*ConfigEntry), ProgramGroup: NewProcessGroup()}
 }
 
 //create a new entry or return the already-exist entry
@@ -111,65 +129,174 @@ func (c *Config) createEntry(name string, configDir string) *ConfigEntry {
 }
 
 //
-// return the loaded programs
+// load the configuration file and the files included by its [include]
+// section, return the loaded programs
 func (c *Config) Load() ([]string, error) {
-	ini := ini.NewIni()
-	c.ProgramGroup = NewProcessGroup()
-	ini.LoadFile(c.configFile)
+	return c.LoadAndCheck(nil)
+}
 
-	includeFiles := c.getIncludeFiles(ini)
-	for _, f := range includeFiles {
-		ini.LoadFile(f)
+// LoadAndCheck loads the configuration file like Load, the new configuration
+// is passed to check before it replaces the current one. The current
+// configuration is kept if check returns an error
+func (c *Config) LoadAndCheck(check func(newConfig *Config) error) ([]string, error) {
+	loader := &configLoader{loaded: make(map[string]bool), programFiles: make(map[string]string)}
+	sections, err := loader.loadAll(c.configFile)
+	if err != nil {
+		return nil, err
+	}
+	// parse into a new configuration so the entries used by the running
+	// processes are not changed and the previous configuration is kept if
+	// fail to parse
+	newConfig := NewConfig(c.configFile)
+	loaded_programs, err := newConfig.parse(sections)
+	if err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err = check(newConfig); err != nil {
+			return nil, err
+		}
 	}
-	return c.parse(ini), nil
+	c.entries = newConfig.entries
+	c.ProgramGroup = newConfig.ProgramGroup
+	return loaded_programs, nil
+}
+
+// configSection is a section and the file in which it is defined
+type configSection struct {
+	*ini.Section
+	file string
+}
+
+// the directory of the file in which the section is defined, it is the
+// value of %(here)s
+func (s *configSection) dir() string {
+	return filepath.Dir(s.file)
 }
 
-func (c *Config) getIncludeFiles(cfg *ini.Ini) []string {
+// configLoader loads a configuration file and its included files
+type configLoader struct {
+	// the loaded files
+	loaded map[string]bool
+	// the file in which the program or event listener section is defined
+	programFiles map[string]string
+}
+
+// load the file and the files included by it recursively, the sections of an
+// included file follow the sections of the file which includes it.
+//
+// includeChain is the files which include this file, it is used to detect
+// the circular include
+func (l *configLoader) load(fileName string, includeChain []string) ([]*configSection, error) {
+	absFile, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("fail to load config file %s: %w", fileName, err)
+	}
+	for _, f := range includeChain {
+		if f == absFile {
+			return nil, fmt.Errorf("circular include of config file: %s -> %s", strings.Join(includeChain, " -> "), absFile)
+		}
+	}
+	if l.loaded[absFile] {
+		return make([]*configSection, 0), nil
+	}
+	if _, err := os.Stat(absFile); err != nil {
+		return nil, fmt.Errorf("fail to load config file %s: %w", fileName, err)
+	}
+	l.loaded[absFile] = true
+
+	cfg := ini.NewIni()
+	cfg.LoadFile(absFile)
+	sections := make([]*configSection, 0)
+	for _, section := range cfg.Sections() {
+		if strings.HasPrefix(section.Name, "program:") || strings.HasPrefix(section.Name, "fcgi-program:") || strings.HasPrefix(section.Name, "eventlistener:") {
+			if prevFile, ok := l.programFiles[section.Name]; ok {
+				return nil, fmt.Errorf("duplicated [%s] in config files %s and %s", section.Name, prevFile, absFile)
+			}
+			l.programFiles[section.Name] = absFile
+		}
+		sections = append(sections, &configSection{Section: section, file: absFile})
+	}
+
+	includeChain = append(includeChain, absFile)
+	for _, f := range getIncludeFiles(cfg, filepath.Dir(absFile)) {
+		included, err := l.load(f, includeChain)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, included...)
+	}
+	return sections, nil
+}
+
+// get the files matched by the glob patterns of the "files" in [include]
+// section, a relative pattern is relative to the dir. The files matched by
+// one pattern are sorted by name
+func getIncludeFiles(cfg *ini.Ini, dir string) []string {
 	result := make([]string, 0)
 	if includeSection, err := cfg.GetSection("include"); err == nil {
 		key, err := includeSection.GetValue("files")
 		if err == nil {
-			env := NewStringExpression("here", c.GetConfigFileDir())
-			files := strings.Fields(key)
-			for _, f_raw := range files {
-				dir := c.GetConfigFileDir()
+			env := NewStringExpression("here", dir)
+			for _, f_raw := range strings.Fields(key) {
 				f, err := env.Eval(f_raw)
 				if err != nil {
+					log.WithFields(log.Fields{log.ErrorKey: err, "files": f_raw}).Warn("invalid include file pattern")
 					continue
 				}
-				if filepath.IsAbs(f) {
-					dir = filepath.Dir(f)
+				if !filepath.IsAbs(f) {
+					f = filepath.Join(dir, f)
 				}
-				fileInfos, err := ioutil.ReadDir(dir)
-				if err == nil {
-					goPattern := toRegexp(filepath.Base(f))
-					for _, fileInfo := range fileInfos {
-						if matched, err := regexp.MatchString(goPattern, fileInfo.Name()); matched && err == nil {
-							result = append(result, filepath.Join(dir, fileInfo.Name()))
-						}
-					}
+				matches, err := filepath.Glob(f)
+				if err != nil {
+					log.WithFields(log.Fields{log.ErrorKey: err, "files": f_raw}).Warn("invalid include file pattern")
+					continue
 				}
-
+				sort.Strings(matches)
+				result = append(result, matches...)
 			}
 		}
 	}
 	return result
-
 }
 
-func (c *Config) parse(cfg *ini.Ini) []string {
-	c.parseGroup(cfg)
-	loaded_programs := c.parseProgram(cfg)
+func (c *Config) parse(sections []*configSection) ([]string, error) {
+	if err := c.parseGroup(sections); err != nil {
+		return nil, err
+	}
+	if err := c.parseGlobalEnv(sections); err != nil {
+		return nil, err
+	}
+	loaded_programs, err := c.parseProgram(sections)
+	if err != nil {
+		return nil, err
+	}
+	programs := c.GetEntries(func(entry *ConfigEntry) bool {
+		return entry.IsProgram()
+	})
+	if cycle := FindDependsCycle(programs); cycle != nil {
+		return nil, fmt.Errorf("circular depends_on: %s", strings.Join(cycle, " -> "))
+	}
 
 	//parse non-group,non-program and non-eventlistener sections
-	for _, section := range cfg.Sections() {
-		if !strings.HasPrefix(section.Name, "group:") && !strings.HasPrefix(section.Name, "program:") && !strings.HasPrefix(section.Name, "eventlistener:") {
-			entry := c.createEntry(section.Name, c.GetConfigFileDir())
+	for _, section := range sections {
+		if is_program, _ := c.isProgramOrEventListener(section.Section); !is_program && !strings.HasPrefix(section.Name, "group:") {
+			entry := c.createEntry(section.Name, section.dir())
 			c.entries[section.Name] = entry
-			entry.parse(section)
+			if err := entry.parse(section, NewStringExpression("here", section.dir())); err != nil {
+				return nil, err
+			}
 		}
 	}
-	return loaded_programs
+	return loaded_programs, nil
+}
+
+// GetConfigFile gets the absolute path of the configuration file
+func (c *Config) GetConfigFile() string {
+	if path, err := filepath.Abs(c.configFile); err == nil {
+		return path
+	}
+	return c.configFile
 }
 
 func (c *Config) GetConfigFileDir() string {
@@ -302,56 +429,85 @@ func (c *ConfigEntry) GetInt(key string, defValue int) int {
 //  environment = A="env 1",B="this is a test"
 func (c *ConfigEntry) GetEnv(key string) []string {
 	value, ok := c.keyValues[key]
-	env := make([]string, 0)
+	if !ok {
+		return make([]string, 0)
+	}
+	return parseEnv(value)
+}
 
-	if ok {
-		start := 0
-		n := len(value)
-		var i int
-		for {
-			for i = start; i < n && value[i] != '='; {
-				i++
-			}
-			key := value[start:i]
-			start = i + 1
-			if value[start] == '"' {
-				for i = start + 1; i < n && value[i] != '"'; {
-					i++
-				}
-				if i < n {
-					env = append(env, fmt.Sprintf("%s=%s", strings.TrimSpace(key), strings.TrimSpace(value[start+1:i])))
-				}
-				if i+1 < n && value[i+1] == ',' {
-					start = i + 2
-				} else {
-					break
-				}
-			} else {
-				for i = start; i < n && value[i] != ','; {
-					i++
-				}
-				if i < n {
-					env = append(env, fmt.Sprintf("%s=%s", strings.TrimSpace(key), strings.TrimSpace(value[start:i])))
-					start = i + 1
-				} else {
-					env = append(env, fmt.Sprintf("%s=%s", strings.TrimSpace(key), strings.TrimSpace(value[start:])))
-					break
-				}
+// GetEnvironment gets the environment of the program, the "environment" of
+// [supervisord] section is inherited and the variables are overridden by
+// the "environment" of the program
+func (c *ConfigEntry) GetEnvironment() []string {
+	return mergeEnv(parseEnv(c.inheritedEnv), c.GetEnv("environment"))
+}
+
+// MergeEnvironment gets the environment of the program with the variables
+// loaded from its "env_file", they override the inherited variables and
+// are overridden by the "environment" of the program
+func (c *ConfigEntry) MergeEnvironment(fileEnv []string) []string {
+	return mergeEnv(mergeEnv(parseEnv(c.inheritedEnv), fileEnv), c.GetEnv("environment"))
+}
+
+// override the "name=value" variables in env by the ones in overrides
+func mergeEnv(env []string, overrides []string) []string {
+	for _, v := range overrides {
+		name := v[:strings.Index(v, "=")+1]
+		overridden := false
+		for i := range env {
+			if strings.HasPrefix(env[i], name) {
+				env[i], overridden = v, true
 			}
 		}
+		if !overridden {
+			env = append(env, v)
+		}
 	}
+	return env
+}
 
-	result := make([]string, 0)
-	for i := 0; i < len(env); i++ {
-		tmp, err := NewStringExpression("program_name", c.GetProgramName(),
-			"process_num", c.GetString("process_num", "0"),
-			"group_name", c.GetGroupName(),
-			"here", c.ConfigDir).Eval(env[i])
-		if err == nil {
-			result = append(result, tmp)
+// parse the environment setting like A="env 1",B="this is a test" to the
+// list of "name=value"
+func parseEnv(value string) []string {
+	env := make([]string, 0)
+	if value == "" {
+		return env
+	}
+	start := 0
+	n := len(value)
+	var i int
+	for {
+		for i = start; i < n && value[i] != '='; {
+			i++
+		}
+		key := value[start:i]
+		start = i + 1
+		if value[start] == '"' {
+			for i = start + 1; i < n && value[i] != '"'; {
+				i++
+			}
+			if i < n {
+				env = append(env, fmt.Sprintf("%s=%s", strings.TrimSpace(key), strings.TrimSpace(value[start+1:i])))
+			}
+			if i+1 < n && value[i+1] == ',' {
+				start = i + 2
+			} else {
+				break
+			}
+		} else {
+			for i = start; i < n && value[i] != ','; {
+				i++
+			}
+			if i < n {
+				env = append(env, fmt.Sprintf("%s=%s", strings.TrimSpace(key), strings.TrimSpace(value[start:i])))
+				start = i + 1
+			} else {
+				env = append(env, fmt.Sprintf("%s=%s", strings.TrimSpace(key), strings.TrimSpace(value[start:])))
+				break
+			}
 		}
 	}
-	return result
+	return env
 }
 
 //get the value of key as string
@@ -359,47 +515,19 @@ func (c *ConfigEntry) GetString(key string, defValue string) string {
 	s, ok := c.keyValues[key]
 
 	if ok {
-		env := NewStringExpression("here", c.ConfigDir)
-		rep_s, err := env.Eval(s)
-		if err == nil {
-			return rep_s
-		}
-		log.WithFields(log.Fields{
-			log.ErrorKey: err,
-			"program":    c.GetProgramName(),
-			"key":        key,
-		}).Warn("Unable to parse expression")
+		return s
 	}
 	return defValue
 }
 
-//get the value of key as string and attempt to parse it with StringExpression
+//get the value of key as string, the string expression in it is evaluated
+//when the config is loaded
 func (c *ConfigEntry) GetStringExpression(key string, defValue string) string {
 	s, ok := c.keyValues[key]
 	if !ok || s == "" {
 		return ""
 	}
-
-	host_name, err := os.Hostname()
-	if err != nil {
-		host_name = "Unknown"
-	}
-	result, err := NewStringExpression("program_name", c.GetProgramName(),
-		"process_num", c.GetString("process_num", "0"),
-		"group_name", c.GetGroupName(),
-		"here", c.ConfigDir,
-		"host_node_name", host_name).Eval(s)
-
-	if err != nil {
-		log.WithFields(log.Fields{
-			log.ErrorKey: err,
-			"program":    c.GetProgramName(),
-			"key":        key,
-		}).Warn("unable to parse expression")
-		return s
-	}
-
-	return result
+	return s
 }
 
 func (c *ConfigEntry) GetStringArray(key string, sep string) []string {
@@ -437,20 +565,29 @@ func (c *ConfigEntry) GetBytes(key string, defValue int) int {
 	return defValue
 }
 
-func (c *ConfigEntry) parse(section *ini.Section) {
+// parse the keys of section, the placeholders like %(ENV_X)s and %(here)s
+// in the values are expanded by env
+func (c *ConfigEntry) parse(section *configSection, env *StringExpression) error {
 	c.Name = section.Name
 	for _, key := range section.Keys() {
-		c.keyValues[key.Name()] = key.ValueWithDefault("")
+		value, err := env.Eval(key.ValueWithDefault(""))
+		if err != nil {
+			return fmt.Errorf("invalid value of %s in [%s] of %s: %v", key.Name(), section.Name, section.file, err)
+		}
+		c.keyValues[key.Name()] = value
 	}
+	return nil
 }
 
-func (c *Config) parseGroup(cfg *ini.Ini) {
+func (c *Config) parseGroup(sections []*configSection) error {
 
 	//parse the group at first
-	for _, section := range cfg.Sections() {
+	for _, section := range sections {
 		if strings.HasPrefix(section.Name, "group:") {
-			entry := c.createEntry(section.Name, c.GetConfigFileDir())
-			entry.parse(section)
+			entry := c.createEntry(section.Name, section.dir())
+			if err := entry.parse(section, NewStringExpression("here", section.dir())); err != nil {
+				return err
+			}
 			groupName := entry.GetGroupName()
 			programs := entry.GetPrograms()
 			for _, program := range programs {
@@ -458,82 +595,118 @@ func (c *Config) parseGroup(cfg *ini.Ini) {
 			}
 		}
 	}
+	return nil
+}
+
+// get the environment of [supervisord] section before parsing the programs
+// which inherit it
+func (c *Config) parseGlobalEnv(sections []*configSection) error {
+	for _, section := range sections {
+		if section.Name != "supervisord" {
+			continue
+		}
+		value, err := section.GetValue("environment")
+		if err != nil {
+			return nil
+		}
+		c.globalEnv, err = NewStringExpression("here", section.dir()).Eval(value)
+		if err != nil {
+			return fmt.Errorf("invalid value of environment in [%s] of %s: %v", section.Name, section.file, err)
+		}
+	}
+	return nil
 }
 
 func (c *Config) isProgramOrEventListener(section *ini.Section) (bool, string) {
 	//check if it is a program or event listener section
-	is_program := strings.HasPrefix(section.Name, "program:")
-	is_event_listener := strings.HasPrefix(section.Name, "eventlistener:")
-	prefix := ""
-	if is_program {
-		prefix = "program:"
-	} else if is_event_listener {
-		prefix = "eventlistener:"
+	for _, prefix := range []string{"program:", "fcgi-program:", "eventlistener:"} {
+		if strings.HasPrefix(section.Name, prefix) {
+			return true, prefix
+		}
 	}
-	return is_program || is_event_listener, prefix
+	return false, ""
 }
 
 // parse the sections starts with "program:" prefix.
 //
 // Return all the parsed program names in the ini
-func (c *Config) parseProgram(cfg *ini.Ini) []string {
+func (c *Config) parseProgram(sections []*configSection) ([]string, error) {
 	loaded_programs := make([]string, 0)
-	for _, section := range cfg.Sections() {
+	for _, section := range sections {
 
-		program_or_event_listener, prefix := c.isProgramOrEventListener(section)
+		program_or_event_listener, prefix := c.isProgramOrEventListener(section.Section)
 
 		//if it is program or event listener
 		if program_or_event_listener {
-			//get the number of processes
-			numProcs, err := section.GetInt("numprocs")
-			programName := section.Name[len(prefix):]
+			programs, err := c.parseProgramSection(section, prefix)
 			if err != nil {
-				numProcs = 1
-			}
-			procName, err := section.GetValue("process_name")
-			if numProcs > 1 {
-				if err != nil || strings.Index(procName, "%(process_num)") == -1 {
-					log.WithFields(log.Fields{
-						"numprocs":     numProcs,
-						"process_name": procName,
-					}).Error("no process_num in process name")
-				}
-			}
-			originalProcName := programName
-			if err == nil {
-				originalProcName = procName
+				return nil, err
 			}
+			loaded_programs = append(loaded_programs, programs...)
+		}
+	}
+	return loaded_programs, nil
 
-			for i := 1; i <= numProcs; i++ {
-				envs := NewStringExpression("program_name", programName,
-					"process_num", fmt.Sprintf("%d", i),
-					"group_name", c.ProgramGroup.GetGroup(programName, programName),
-					"here", c.GetConfigFileDir())
-				cmd, err := envs.Eval(section.GetValueWithDefault("command", ""))
-				if err != nil {
-					continue
-				}
-				section.Add("command", cmd)
-
-				procName, err := envs.Eval(originalProcName)
-				if err != nil {
-					continue
-				}
+}
 
-				section.Add("process_name", procName)
-				section.Add("numprocs_start", fmt.Sprintf("%d", (i-1)))
-				section.Add("process_num", fmt.Sprintf("%d", i))
-				entry := c.createEntry(procName, c.GetConfigFileDir())
-				entry.parse(section)
-				entry.Name = prefix + procName
-				group := c.ProgramGroup.GetGroup(programName, programName)
-				entry.Group = group
-				loaded_programs = append(loaded_programs, procName)
-			}
+// parse a program or event listener section to the entries of its processes
+//
+// Return the names of the processes
+func (c *Config) parseProgramSection(section *configSection, prefix string) ([]string, error) {
+	loaded_programs := make([]string, 0)
+	//get the number of processes
+	numProcs, err := section.GetInt("numprocs")
+	programName := section.Name[len(prefix):]
+	if err != nil {
+		numProcs = 1
+	}
+	//the process_num of the processes starts from numprocs_start
+	numProcsStart, err := section.GetInt("numprocs_start")
+	if err != nil {
+		numProcsStart = 0
+	}
+	procName, err := section.GetValue("process_name")
+	if numProcs > 1 {
+		if err != nil || strings.Index(procName, "%(process_num)") == -1 {
+			return nil, fmt.Errorf("no %%(process_num) in process_name of [%s] of %s with numprocs %d", section.Name, section.file, numProcs)
 		}
 	}
-	return loaded_programs
+	if _, err := section.GetValue("events"); prefix == "eventlistener:" && err != nil {
+		return nil, fmt.Errorf("no events in [%s] of %s", section.Name, section.file)
+	}
+	if _, err := section.GetValue("socket"); prefix == "fcgi-program:" && err != nil {
+		return nil, fmt.Errorf("no socket in [%s] of %s", section.Name, section.file)
+	}
+	originalProcName := programName
+	if err == nil {
+		originalProcName = procName
+	}
 
+	for i := 0; i < numProcs; i++ {
+		processNum := fmt.Sprintf("%d", numProcsStart+i)
+		envs := NewStringExpression("program_name", programName,
+			"process_num", processNum,
+			"numprocs", fmt.Sprintf("%d", numProcs),
+			"group_name", c.ProgramGroup.GetGroup(programName, programName),
+			"here", section.dir())
+		procName, err := envs.Eval(originalProcName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of process_name in [%s] of %s: %v", section.Name, section.file, err)
+		}
+
+		section.Add("process_name", procName)
+		section.Add("process_num", processNum)
+		entry := c.createEntry(prefix+procName, section.dir())
+		if err := entry.parse(section, envs); err != nil {
+			return nil, err
+		}
+		entry.Name = prefix + procName
+		entry.inheritedEnv = c.globalEnv
+		group := c.ProgramGroup.GetGroup(programName, programName)
+		entry.Group = group
+		loaded_programs = append(loaded_programs, procName)
+	}
+	return loaded_programs, nil
 }
 
 func (c *Config) String() string {
@@ -548,5 +721,6 @@ func (c *Config) String() string {
 
 func (c *Config) RemoveProgram(programName string) {
 	delete(c.entries, fmt.Sprintf("program:%s", programName))
+	delete(c.entries, fmt.Sprintf("fcgi-program:%s", programName))
 	c.ProgramGroup.Remove(programName)
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -100,6 +101,30 @@ func TestGetEnvValueFromConfig(t *testing.T) {
 
 }
 
+func TestInheritGlobalEnvironment(t *testing.T) {
+	config, err := parse([]byte(`[program:x]
+environment=B="program b",C=%(process_num)d
+numprocs=2
+process_name=x_%(process_num)d
+
+[program:y]
+command=/bin/ls
+
+[supervisord]
+environment=A=global,B=global
+`))
+	if err != nil {
+		t.Fatalf("Fail to parse the config, err=%v", err)
+	}
+	// the global environment is overridden by the program and the process
+	if env := config.GetProgram("x_1").GetEnvironment(); strings.Join(env, " ") != "A=global B=program b C=1" {
+		t.Errorf("Wrong environment of x_1: %v", env)
+	}
+	if env := config.GetProgram("y").GetEnvironment(); strings.Join(env, " ") != "A=global B=global" {
+		t.Errorf("Wrong environment of y: %v", env)
+	}
+}
+
 func TestGetBytesFromConfig(t *testing.T) {
 	config, _ := parse([]byte("[program:test]\nA=1024\nB=2KB\nC=3MB\nD=4GB\nE=test"))
 	entry := config.GetProgram("test")
@@ -181,3 +206,300 @@ func TestConfigWithInclude(t *testing.T) {
 	}
 
 }
+
+func TestIncludeWithGlobInSubDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tmp")
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "conf.d"), os.ModePerm)
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[include]\nfiles=conf.d/*.conf extra.ini\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "conf.d", "b.conf"), []byte("[program:b]\ncommand=ls\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "conf.d", "a.conf"), []byte("[program:a]\ncommand=ls\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "conf.d", "c.txt"), []byte("[program:c]\ncommand=ls\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "extra.ini"), []byte("[program:d]\ncommand=ls\n"), os.ModePerm)
+
+	config := NewConfig(filepath.Join(dir, "supervisord.conf"))
+	programs, err := config.Load()
+	if err != nil || len(programs) != 3 || programs[0] != "a" || programs[1] != "b" || programs[2] != "d" {
+		t.Errorf("Fail to include the files in order, programs=%v, err=%v", programs, err)
+	}
+}
+
+func TestIncludeDuplicatedProgram(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tmp")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[program:a]\ncommand=ls\n[include]\nfiles=*.ini\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "a.ini"), []byte("[program:a]\ncommand=pwd\n"), os.ModePerm)
+
+	config := NewConfig(filepath.Join(dir, "supervisord.conf"))
+	_, err := config.Load()
+	if err == nil || !strings.Contains(err.Error(), "supervisord.conf") || !strings.Contains(err.Error(), "a.ini") {
+		t.Errorf("The duplicated program is not reported with the files, err=%v", err)
+	}
+}
+
+func TestProgramsDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tmp")
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "programs"), os.ModePerm)
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[supervisord]\nprograms_dir=programs\n[program:a]\ncommand=ls\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "programs", "b.conf"), []byte("[program:b]\ncommand=ls\n"), os.ModePerm)
+
+	config := NewConfig(filepath.Join(dir, "supervisord.conf"))
+	programs, err := config.Load()
+	if err != nil || len(programs) != 2 || programs[0] != "a" || programs[1] != "b" {
+		t.Fatalf("Fail to load the programs in programs_dir, programs=%v, err=%v", programs, err)
+	}
+	if config.GetProgramsDir() != filepath.Join(dir, "programs") || config.GetProgramFile("c") != filepath.Join(dir, "programs", "c.conf") {
+		t.Errorf("Wrong programs_dir %s", config.GetProgramsDir())
+	}
+
+	ioutil.WriteFile(config.GetProgramFile("c"), []byte("[program:c]\ncommand=pwd\n"), os.ModePerm)
+	programs, err = config.AddProgramFile(config.GetProgramFile("c"))
+	if err != nil || len(programs) != 1 || programs[0] != "c" || config.GetProgram("c") == nil || config.GetProgram("a") == nil {
+		t.Errorf("Fail to add the program file, programs=%v, err=%v", programs, err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "a.conf"), []byte("[program:a]\ncommand=pwd\n"), os.ModePerm)
+	if _, err = config.AddProgramFile(filepath.Join(dir, "a.conf")); err == nil || config.GetProgram("a").GetString("command", "") != "ls" {
+		t.Errorf("The program already loaded should not be added again, err=%v", err)
+	}
+}
+
+func TestCircularInclude(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tmp")
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[include]\nfiles=a.ini\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "a.ini"), []byte("[program:a]\ncommand=ls\n[include]\nfiles=supervisord.conf\n"), os.ModePerm)
+
+	config := NewConfig(filepath.Join(dir, "supervisord.conf"))
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("The circular include is not rejected, err=%v", err)
+	}
+}
+
+func TestCircularDependsOn(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tmp")
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[program:a]\ncommand=ls\ndepends_on=c\n[program:b]\ncommand=ls\ndepends_on=a\n[program:c]\ncommand=ls\ndepends_on=d, b\n[program:d]\ncommand=ls\n"), os.ModePerm)
+
+	config := NewConfig(configFile)
+	if _, err := config.Load(); err == nil || !strings.Contains(err.Error(), "circular depends_on: a -> c -> b -> a") {
+		t.Errorf("The circular depends_on is not rejected, err=%v", err)
+	}
+	errs := config.Validate()
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), configFile+":3: [program:a] depends_on: circular depends_on") {
+		t.Errorf("The circular depends_on should be reported, errors=%v", errs)
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "tmp")
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "conf.d"), os.ModePerm)
+	os.Setenv("TEST_SUPERVISOR_HOME", "/opt/test")
+	defer os.Unsetenv("TEST_SUPERVISOR_HOME")
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[supervisord]\nlogfile=%(here)s/supervisord.log\n[include]\nfiles=conf.d/*.conf\n"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(dir, "conf.d", "test.conf"), []byte("[program:test]\ncommand=%(ENV_TEST_SUPERVISOR_HOME)s/bin/%(program_name)s -n %(process_num)s\ndirectory=%(here)s\n"), os.ModePerm)
+
+	config := NewConfig(filepath.Join(dir, "supervisord.conf"))
+	if _, err := config.Load(); err != nil {
+		t.Fatalf("Fail to load the config, err=%v", err)
+	}
+	entry, _ := config.GetSupervisord()
+	if entry.GetString("logfile", "") != filepath.Join(dir, "supervisord.log") {
+		t.Errorf("Fail to expand here in supervisord: %s", entry.GetString("logfile", ""))
+	}
+	entry = config.GetProgram("test")
+	if entry.GetString("command", "") != "/opt/test/bin/test -n 0" {
+		t.Errorf("Fail to expand the command: %s", entry.GetString("command", ""))
+	}
+	if entry.GetString("directory", "") != filepath.Join(dir, "conf.d") {
+		t.Errorf("here is not the directory of the included file: %s", entry.GetString("directory", ""))
+	}
+}
+
+func TestUnknownPlaceholder(t *testing.T) {
+	_, err := parse([]byte("[program:test]\ncommand=/bin/ls\ndirectory=%(ENV_TEST_SUPERVISOR_NOT_EXIST)s\n"))
+	if err == nil || !strings.Contains(err.Error(), "directory") || !strings.Contains(err.Error(), "ENV_TEST_SUPERVISOR_NOT_EXIST") {
+		t.Errorf("The unknown placeholder is not reported with the key, err=%v", err)
+	}
+}
+
+func TestNumProcs(t *testing.T) {
+	config, err := parse([]byte("[program:x]\ncommand=/bin/worker --id %(process_num)d\nnumprocs=4\nprocess_name=%(program_name)s_%(process_num)02d\n"))
+	if err != nil {
+		t.Fatalf("Fail to parse the config, err=%v", err)
+	}
+	names := config.GetProgramNames()
+	if len(names) != 4 {
+		t.Fatalf("Expect 4 processes, but got %v", names)
+	}
+	for i := 0; i < 4; i++ {
+		entry := config.GetProgram(fmt.Sprintf("x_%02d", i))
+		if entry == nil || entry.Group != "x" || entry.GetString("command", "") != fmt.Sprintf("/bin/worker --id %d", i) {
+			t.Errorf("Fail to create the process x_%02d", i)
+		}
+	}
+}
+
+func TestNumProcsStart(t *testing.T) {
+	config, err := parse([]byte("[program:x]\ncommand=/bin/worker\nnumprocs=2\nnumprocs_start=10\nprocess_name=%(program_name)s_%(process_num)s\n"))
+	if err != nil || config.GetProgram("x_10") == nil || config.GetProgram("x_11") == nil || config.GetProgram("x_12") != nil {
+		t.Errorf("The process number doesn't start from numprocs_start, programs=%v, err=%v", config.GetProgramNames(), err)
+	}
+}
+
+func TestNumProcsWithoutProcessNum(t *testing.T) {
+	if _, err := parse([]byte("[program:x]\ncommand=/bin/worker\nnumprocs=2\n")); err == nil {
+		t.Errorf("The process_name without process_num is accepted")
+	}
+}
+
+func TestEventListenerConfig(t *testing.T) {
+	config, err := parse([]byte("[eventlistener:x]\ncommand=/bin/listener\nevents=PROCESS_STATE,TICK_60\nbuffer_size=20\nnumprocs=2\nprocess_name=%(program_name)s_%(process_num)s\n"))
+	if err != nil {
+		t.Fatalf("Fail to parse the config, err=%v", err)
+	}
+	listeners := config.GetEventListeners()
+	if len(listeners) != 2 || len(config.GetPrograms()) != 0 {
+		t.Fatalf("Expect 2 event listeners, but got %d", len(listeners))
+	}
+	for _, entry := range listeners {
+		name := entry.GetEventListenerName()
+		if (name != "x_0" && name != "x_1") || entry.Group != "x" || entry.GetInt("buffer_size", 0) != 20 ||
+			entry.GetString("events", "") != "PROCESS_STATE,TICK_60" {
+			t.Errorf("Wrong event listener %s", name)
+		}
+	}
+}
+
+func TestEventListenerWithoutEvents(t *testing.T) {
+	if _, err := parse([]byte("[eventlistener:x]\ncommand=/bin/listener\n")); err == nil {
+		t.Error("The event listener without events is accepted")
+	}
+}
+
+func TestFcgiProgramConfig(t *testing.T) {
+	config, err := parse([]byte("[fcgi-program:php]\ncommand=/usr/bin/php-cgi\nsocket=tcp://127.0.0.1:9000\n"))
+	if err != nil {
+		t.Fatalf("Fail to parse the config, err=%v", err)
+	}
+	entry := config.GetProgram("php")
+	if entry == nil || !entry.IsProgram() || !entry.IsFcgiProgram() || entry.GetString("socket", "") != "tcp://127.0.0.1:9000" {
+		t.Error("Fail to parse the fcgi-program")
+	}
+	if _, err := parse([]byte("[fcgi-program:php]\ncommand=/usr/bin/php-cgi\n")); err == nil {
+		t.Error("The fcgi-program without socket is accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte(`[program:a]
+command=/bin/a
+stopsignal=TERM BAD
+
+[program:b]
+command=/bin/b
+directory=/no/such/dir
+process_name=a
+
+[program:c]
+command=/bin/c
+numprocs=2
+
+[program:d]
+umask=999
+
+[group:g]
+programs=a,x
+`), os.ModePerm)
+
+	errs := NewConfig(configFile).Validate()
+	expected := []string{configFile + ":3: [program:a] stopsignal: unknown signal BAD",
+		configFile + ":8: [program:b] process_name: duplicated process name a",
+		configFile + ":7: [program:b] directory: no such directory /no/such/dir",
+		configFile + ":10: [program:c] no %(process_num) in process_name",
+		configFile + ":15: [program:d] umask: invalid octal umask 999",
+		configFile + ":14: [program:d] command: no command",
+		configFile + ":18: [group:g] programs: no such program x"}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expect %d errors, but got %v", len(expected), errs)
+	}
+	for i, err := range errs {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("Expect error %s, but got %s", expected[i], err.Error())
+		}
+	}
+
+	ioutil.WriteFile(configFile, []byte("[program:a]\ncommand=/bin/a\n"), os.ModePerm)
+	if errs := NewConfig(configFile).Validate(); len(errs) != 0 {
+		t.Errorf("The config should be valid, errors=%v", errs)
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "config")
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, ".env")
+	ioutil.WriteFile(envFile, []byte(`# the database
+export DB_HOST=localhost
+DB_PORT = 5432 # the port
+DB_USER='admin # not comment'
+DB_PASSWORD="p@ss \"word\"\n" # comment
+EMPTY=
+`), os.ModePerm)
+	env, err := ReadEnvFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"DB_HOST=localhost", "DB_PORT=5432", "DB_USER=admin # not comment", "DB_PASSWORD=p@ss \"word\"\n", "EMPTY="}
+	if fmt.Sprintf("%q", env) != fmt.Sprintf("%q", expected) {
+		t.Errorf("Wrong environment %q", env)
+	}
+
+	for _, content := range []string{"NO_VALUE\n", "A=\"unterminated\n", "A='x' y\n", "BAD NAME=1\n"} {
+		ioutil.WriteFile(envFile, []byte("# comment\n"+content), os.ModePerm)
+		if _, err := ReadEnvFile(envFile); err == nil || !strings.Contains(err.Error(), envFile+":2:") {
+			t.Errorf("The invalid line %q should be reported, err=%v", content, err)
+		}
+	}
+}
+
+func TestMergeEnvironment(t *testing.T) {
+	config, err := parse([]byte(`[supervisord]
+environment=A="global",B="global"
+
+[program:test]
+environment=C="program"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := config.GetProgram("test")
+	env := entry.MergeEnvironment([]string{"B=file", "C=file", "D=file"})
+	if strings.Join(env, ",") != "A=global,B=file,C=program,D=file" {
+		t.Errorf("Wrong merged environment %v", env)
+	}
+}
+
+func TestIsKnownSignal(t *testing.T) {
+	for _, sig := range []string{"TERM", "term", "SIGTERM", "ALRM", "WINCH", "sigusr2"} {
+		if !IsKnownSignal(sig) {
+			t.Errorf("The signal %s should be known", sig)
+		}
+	}
+	for _, sig := range []string{"BAD", "", "SIG"} {
+		if IsKnownSignal(sig) {
+			t.Errorf("The signal %s should be unknown", sig)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadEnvFile reads the "KEY=VALUE" lines of the environment file. The empty
+// lines and the lines starting with "#" are ignored and a line can start
+// with "export". The value can be quoted by single quotes which keep it
+// as is, or by double quotes which support the escapes \n, \t, \" and \\.
+// The text after " #" of an unquoted value is a comment
+func ReadEnvFile(fileName string) ([]string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	env := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimSpace(line[len("export"):])
+		}
+		pos := strings.Index(line, "=")
+		if pos <= 0 {
+			return nil, fmt.Errorf("%s:%d: invalid environment variable %s", fileName, lineNo, line)
+		}
+		key := strings.TrimSpace(line[:pos])
+		if strings.ContainsAny(key, " \t\"'") {
+			return nil, fmt.Errorf("%s:%d: invalid environment variable name %s", fileName, lineNo, key)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(line[pos+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fileName, lineNo, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, scanner.Err()
+}
+
+// parse the quoted or unquoted value of an environment variable
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	var result strings.Builder
+	var rest string
+	switch value[0] {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value %s", value)
+		}
+		result.WriteString(value[1 : end+1])
+		rest = value[end+2:]
+	case '"':
+		i := 1
+		for ; i < len(value) && value[i] != '"'; i++ {
+			if value[i] != '\\' || i+1 >= len(value) {
+				result.WriteByte(value[i])
+				continue
+			}
+			i++
+			switch value[i] {
+			case 'n':
+				result.WriteByte('\n')
+			case 't':
+				result.WriteByte('\t')
+			case '"', '\\':
+				result.WriteByte(value[i])
+			default:
+				result.WriteByte('\\')
+				result.WriteByte(value[i])
+			}
+		}
+		if i >= len(value) {
+			return "", fmt.Errorf("unterminated quoted value %s", value)
+		}
+		rest = value[i+1:]
+	default:
+		if pos := strings.Index(value, " #"); pos >= 0 {
+			value = value[:pos]
+		}
+		return strings.TrimSpace(value), nil
+	}
+	//only a comment can follow the quoted value
+	if rest = strings.TrimSpace(rest); rest != "" && rest[0] != '#' {
+		return "", fmt.Errorf("unexpected %s after the quoted value", rest)
+	}
+	return result.String(), nil
+}
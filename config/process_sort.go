@@ -32,18 +32,10 @@ func NewProcessSorter() *ProcessSorter {
 func (p *ProcessSorter) initDepends(program_configs []*ConfigEntry) {
 	//sort by depends_on
 	for _, config := range program_configs {
-		if config.IsProgram() && config.HasParameter("depends_on") {
-			depends_on := config.GetString("depends_on", "")
+		if config.IsProgram() {
 			prog_name := config.GetProgramName()
-			for _, depends_on_prog := range strings.Split(depends_on, ",") {
-				depends_on_prog = strings.TrimSpace(depends_on_prog)
-				if depends_on_prog != "" {
-					if _, ok := p.depends_on_gragh[prog_name]; !ok {
-						p.depends_on_gragh[prog_name] = make([]string, 0)
-					}
-					p.depends_on_gragh[prog_name] = append(p.depends_on_gragh[prog_name], depends_on_prog)
-
-				}
+			for _, depends_on_prog := range config.GetDependsOn() {
+				p.depends_on_gragh[prog_name] = append(p.depends_on_gragh[prog_name], depends_on_prog)
 			}
 		}
 	}
@@ -79,8 +71,15 @@ func (p *ProcessSorter) sortDepends() []string {
 	progs_with_depends_info := p.getDependsOnInfo()
 	progs_start_order := make([]string, 0)
 
-	//get all process without depends
+	//the programs are checked by name so the order is stable
+	prog_names := make([]string, 0)
 	for prog_name := range progs_with_depends_info {
+		prog_names = append(prog_names, prog_name)
+	}
+	sort.Strings(prog_names)
+
+	//get all process without depends
+	for _, prog_name := range prog_names {
 		if _, ok := p.depends_on_gragh[prog_name]; !ok {
 			finished_programs[prog_name] = prog_name
 			progs_start_order = append(progs_start_order, prog_name)
@@ -88,10 +87,21 @@ func (p *ProcessSorter) sortDepends() []string {
 	}
 
 	for len(finished_programs) < len(progs_with_depends_info) {
-		for prog_name := range p.depends_on_gragh {
+		progress := false
+		for _, prog_name := range prog_names {
 			if _, ok := finished_programs[prog_name]; !ok && p.inFinishedPrograms(prog_name, finished_programs) {
 				finished_programs[prog_name] = prog_name
 				progs_start_order = append(progs_start_order, prog_name)
+				progress = true
+			}
+		}
+		//the programs in a cycle are appended by name
+		if !progress {
+			for _, prog_name := range prog_names {
+				if _, ok := finished_programs[prog_name]; !ok {
+					finished_programs[prog_name] = prog_name
+					progs_start_order = append(progs_start_order, prog_name)
+				}
 			}
 		}
 	}
@@ -99,6 +109,49 @@ func (p *ProcessSorter) sortDepends() []string {
 	return progs_start_order
 }
 
+// find a cycle in the depends_on graph, the programs in the cycle are
+// returned and the first one is repeated at the end, nil if no cycle
+func (p *ProcessSorter) findCycle() []string {
+	prog_names := make([]string, 0)
+	for prog_name := range p.depends_on_gragh {
+		prog_names = append(prog_names, prog_name)
+	}
+	sort.Strings(prog_names)
+
+	//0: not visited, 1: in the path, 2: no cycle through it
+	state := make(map[string]int)
+	path := make([]string, 0)
+	var visit func(prog_name string) []string
+	visit = func(prog_name string) []string {
+		switch state[prog_name] {
+		case 1:
+			for i, name := range path {
+				if name == prog_name {
+					return append(append([]string{}, path[i:]...), prog_name)
+				}
+			}
+		case 2:
+			return nil
+		}
+		state[prog_name] = 1
+		path = append(path, prog_name)
+		for _, depends_on_prog := range p.depends_on_gragh[prog_name] {
+			if cycle := visit(depends_on_prog); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[prog_name] = 2
+		return nil
+	}
+	for _, prog_name := range prog_names {
+		if cycle := visit(prog_name); cycle != nil {
+			return cycle
+		}
+	}
+	return nil
+}
+
 func (p *ProcessSorter) inFinishedPrograms(program_name string, finished_programs map[string]string) bool {
 	if depends_on, ok := p.depends_on_gragh[program_name]; ok {
 		for _, depend_program := range depends_on {
@@ -143,7 +196,8 @@ func (p *ProcessSorter) SortProgram(program_configs []*ConfigEntry) []*ConfigEnt
 		}
 	}
 
-	sort.Sort(ProgramByPriority(p.procs_without_depends))
+	//the programs with same priority keep their order
+	sort.Stable(ProgramByPriority(p.procs_without_depends))
 	for _, p := range p.procs_without_depends {
 		result = append(result, p)
 	}
@@ -154,6 +208,26 @@ func (p *ProcessSorter) SortProgram(program_configs []*ConfigEntry) []*ConfigEnt
 	return NewProcessSorter().SortProcess(procs)
 }*/
 
+// FindDependsCycle returns the programs in a circular depends_on of the
+// program configs, the first one is repeated at the end. nil is returned
+// if there is no cycle
+func FindDependsCycle(program_configs []*ConfigEntry) []string {
+	p := NewProcessSorter()
+	p.initDepends(program_configs)
+	return p.findCycle()
+}
+
+// GetDependsOn gets the programs in the depends_on of the program
+func (c *ConfigEntry) GetDependsOn() []string {
+	result := make([]string, 0)
+	for _, prog := range strings.Split(c.GetString("depends_on", ""), ",") {
+		if prog = strings.TrimSpace(prog); prog != "" {
+			result = append(result, prog)
+		}
+	}
+	return result
+}
+
 func sortProgram(configs []*ConfigEntry) []*ConfigEntry {
 	return NewProcessSorter().SortProgram(configs)
 }
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// the files of the programs added at runtime in the "programs_dir"
+const programFilePattern = "*.conf"
+
+// get the "programs_dir" of [supervisord] section, a relative directory is
+// relative to the directory of the file in which it is defined
+func getProgramsDir(sections []*configSection) (string, error) {
+	for _, section := range sections {
+		if section.Name != "supervisord" {
+			continue
+		}
+		value, err := section.GetValue("programs_dir")
+		if err != nil || value == "" {
+			return "", nil
+		}
+		dir, err := NewStringExpression("here", section.dir()).Eval(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid value of programs_dir in [%s] of %s: %v", section.Name, section.file, err)
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(section.dir(), dir)
+		}
+		return dir, nil
+	}
+	return "", nil
+}
+
+// load the configuration file, the files included by it and the files of
+// the programs in the "programs_dir", the files in the programs_dir are
+// loaded by name after the other files
+func (l *configLoader) loadAll(configFile string) ([]*configSection, error) {
+	sections, err := l.load(configFile, make([]string, 0))
+	if err != nil {
+		return nil, err
+	}
+	dir, err := getProgramsDir(sections)
+	if err != nil || dir == "" {
+		return sections, err
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, programFilePattern))
+	sort.Strings(files)
+	for _, f := range files {
+		programSections, err := l.load(f, make([]string, 0))
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, programSections...)
+	}
+	return sections, nil
+}
+
+// GetProgramsDir gets the directory in which the programs added at runtime
+// are saved, it is empty if "programs_dir" is not set
+func (c *Config) GetProgramsDir() string {
+	entry, ok := c.GetSupervisord()
+	if !ok {
+		return ""
+	}
+	dir := entry.GetString("programs_dir", "")
+	if dir != "" && !filepath.IsAbs(dir) {
+		dir = filepath.Join(entry.ConfigDir, dir)
+	}
+	return dir
+}
+
+// GetProgramFile gets the file in the programs_dir in which the program
+// added at runtime is saved
+func (c *Config) GetProgramFile(programName string) string {
+	return filepath.Join(c.GetProgramsDir(), programName+".conf")
+}
+
+// AddProgramFile loads the program sections of the file to the loaded
+// configuration, the programs must not be loaded yet. Return the names of
+// the added processes
+func (c *Config) AddProgramFile(fileName string) ([]string, error) {
+	loader := &configLoader{loaded: make(map[string]bool), programFiles: make(map[string]string)}
+	sections, err := loader.load(fileName, make([]string, 0))
+	if err != nil {
+		return nil, err
+	}
+	// parse into a new configuration so the loaded configuration is kept if
+	// fail to parse
+	newConfig := NewConfig(c.configFile)
+	newConfig.ProgramGroup = c.ProgramGroup.Clone()
+	newConfig.globalEnv = c.globalEnv
+	programs, err := newConfig.parseProgram(sections)
+	if err != nil {
+		return nil, err
+	}
+	for name, entry := range newConfig.entries {
+		if _, ok := c.entries[name]; ok || c.GetProgram(entry.GetProgramName()) != nil {
+			return nil, fmt.Errorf("duplicated [%s] in config file %s", name, fileName)
+		}
+	}
+	for name, entry := range c.entries {
+		newConfig.entries[name] = entry
+	}
+	c.entries = newConfig.entries
+	c.ProgramGroup = newConfig.ProgramGroup
+	return programs, nil
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/csxuejin/supervisord/signals"
+)
+
+// IsKnownSignal checks if the signal name like "TERM", "term" or "SIGTERM"
+// can be sent by supervisord
+func IsKnownSignal(sig string) bool {
+	_, err := signals.ToSignal(sig)
+	return err == nil
+}
+
+// ValidationError is an error found by Validate, the Line is the line of the
+// key or the section in File, 0 if unknown
+type ValidationError struct {
+	File    string
+	Line    int
+	Section string
+	Key     string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	if e.Section == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	if e.Key == "" {
+		return fmt.Sprintf("%s: [%s] %s", location, e.Section, e.Message)
+	}
+	return fmt.Sprintf("%s: [%s] %s: %s", location, e.Section, e.Key, e.Message)
+}
+
+// Validate loads the configuration file and its included files and checks
+// the programs without changing the loaded configuration, all the errors
+// found are returned
+func (c *Config) Validate() []*ValidationError {
+	errs := make([]*ValidationError, 0)
+	loader := &configLoader{loaded: make(map[string]bool), programFiles: make(map[string]string)}
+	sections, err := loader.loadAll(c.configFile)
+	if err != nil {
+		return append(errs, &ValidationError{File: c.configFile, Message: err.Error()})
+	}
+
+	v := NewConfig(c.configFile)
+	if err := v.parseGroup(sections); err != nil {
+		errs = append(errs, &ValidationError{File: c.configFile, Message: err.Error()})
+	}
+	programSections := make(map[string]bool)
+	procSections := make(map[string]*configSection)
+	programs := make([]*ConfigEntry, 0)
+	for _, section := range sections {
+		ok, prefix := v.isProgramOrEventListener(section.Section)
+		if !ok {
+			continue
+		}
+		programSections[section.Name[len(prefix):]] = true
+		//each section is parsed to its own entries, so the entries of the
+		//duplicated process names are checked separately
+		sectionConfig := &Config{configFile: c.configFile, entries: make(map[string]*ConfigEntry), ProgramGroup: v.ProgramGroup}
+		procNames, err := sectionConfig.parseProgramSection(section, prefix)
+		if err != nil {
+			errs = append(errs, newValidationError(section, "", err.Error()))
+			continue
+		}
+		for _, procName := range procNames {
+			//the programs of all kinds share the process names
+			procKey := procName
+			if prefix == "eventlistener:" {
+				procKey = prefix + procName
+			}
+			if prev, ok := procSections[procKey]; ok {
+				errs = append(errs, newValidationError(section, "process_name",
+					fmt.Sprintf("duplicated process name %s, it is also the process name of [%s] in %s", procName, prev.Name, prev.file)))
+			}
+			procSections[procKey] = section
+			entry := sectionConfig.entries[prefix+procName]
+			if entry.IsProgram() {
+				programs = append(programs, entry)
+			}
+			errs = append(errs, validateEntry(entry, section)...)
+		}
+	}
+	if cycle := FindDependsCycle(programs); cycle != nil {
+		errs = append(errs, newValidationError(procSections[cycle[0]], "depends_on",
+			fmt.Sprintf("circular depends_on: %s", strings.Join(cycle, " -> "))))
+	}
+
+	for _, section := range sections {
+		if entry, ok := v.entries[section.Name]; ok && entry.IsGroup() {
+			for _, program := range entry.GetPrograms() {
+				if program != "" && !programSections[program] {
+					errs = append(errs, newValidationError(section, "programs", fmt.Sprintf("no such program %s", program)))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// check the values of the process entry
+func validateEntry(entry *ConfigEntry, section *configSection) []*ValidationError {
+	errs := make([]*ValidationError, 0)
+	for _, sig := range strings.Fields(entry.GetString("stopsignal", "TERM")) {
+		if !IsKnownSignal(sig) {
+			errs = append(errs, newValidationError(section, "stopsignal", fmt.Sprintf("unknown signal %s", sig)))
+		}
+	}
+	if entry.HasParameter("directory") {
+		dir := entry.GetStringExpression("directory", "")
+		if info, err := os.Stat(dir); err != nil {
+			errs = append(errs, newValidationError(section, "directory", fmt.Sprintf("no such directory %s", dir)))
+		} else if !info.IsDir() {
+			errs = append(errs, newValidationError(section, "directory", fmt.Sprintf("%s is not a directory", dir)))
+		}
+	}
+	if entry.HasParameter("umask") {
+		if _, err := strconv.ParseUint(entry.GetString("umask", ""), 8, 32); err != nil {
+			errs = append(errs, newValidationError(section, "umask", fmt.Sprintf("invalid octal umask %s", entry.GetString("umask", ""))))
+		}
+	}
+	if entry.GetString("command", "") == "" {
+		errs = append(errs, newValidationError(section, "command", "no command"))
+	}
+	return errs
+}
+
+func newValidationError(section *configSection, key string, message string) *ValidationError {
+	return &ValidationError{File: section.file,
+		Line:    findLine(section.file, section.Name, key),
+		Section: section.Name,
+		Key:     key,
+		Message: message}
+}
+
+// find the line number of the key in the section of the file, the line of
+// section is returned if the key is empty or not found
+func findLine(file string, sectionName string, key string) int {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	sectionLine := 0
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if sectionLine > 0 {
+				break
+			}
+			if strings.TrimSpace(line[1:len(line)-1]) == sectionName {
+				sectionLine = lineNo
+			}
+		} else if sectionLine > 0 && key != "" {
+			if pos := strings.Index(line, "="); pos > 0 && strings.TrimSpace(line[:pos]) == key {
+				return lineNo
+			}
+		}
+	}
+	return sectionLine
+}
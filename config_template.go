@@ -23,10 +23,11 @@ logfile_maxbytes=50MB
 logfile_backups=10
 loglevel=info
 pidfile=%(here)s/supervisord.pid
+metrics=false
 #umask=not support
 #nodaemon=not support
-#minfds=not support
-#minprocs=not support
+#minfds=1024
+#minprocs=200
 #nocleanup=not support
 #childlogdir=not support
 #user=not support
@@ -47,8 +48,8 @@ autorestart=true
 exitcodes=0,2
 stopsignal=TERM
 stopwaitsecs=10
-#stopasgroup=not support
-#killasgroup=not support
+stopasgroup=false
+killasgroup=false
 user=user1
 redirect_stderr=false
 stdout_logfile=AUTO
@@ -63,8 +64,13 @@ stderr_capture_maxbytes=0
 stderr_events_enabled=false
 environment=KEY="val",KEY2="val2"
 directory=/tmp
-#umask=not support
+umask=022
 serverurl=AUTO
+#healthcheck_url=http://127.0.0.1:8080/health
+healthcheck_interval=10
+healthcheck_timeout=5
+healthcheck_retries=3
+healthcheck_autorestart=false
 
 [include]
 files=/an/absolute/filename.conf /an/absolute/*.conf foo.conf config??.conf
@@ -85,8 +91,8 @@ autorestart=true
 exitcodes=0,2
 stopsignal=TERM
 stopwaitsecs=10
-#stopasgroup=not support
-#killasgroup=not support
+stopasgroup=false
+killasgroup=false
 user=user1
 redirect_stderr=false
 stdout_logfile=AUTO
@@ -101,7 +107,7 @@ stderr_capture_maxbytes=0
 stderr_events_enabled=false
 environment=KEY="val",KEY2="val2"
 directory=/tmp
-#umask=not support
+umask=022
 serverurl=AUTO
 buffer_size=10240
 events=PROCESS_STATE
@@ -39,6 +39,10 @@ func (x *CtlCommand) Execute(args []string) error {
 	}
 
 	rpcc := xmlrpcclient.NewXmlRPCClient(x.getServerUrl())
+	if err := rpcc.Validate(); err != nil {
+		fmt.Println(err)
+		return err
+	}
 	rpcc.SetUser(x.User)
 	rpcc.SetPassword(x.Password)
 	verb := args[0]
@@ -56,6 +60,8 @@ func (x *CtlCommand) Execute(args []string) error {
 		}
 		if reply, err := rpcc.GetAllProcessInfo(); err == nil {
 			x.showProcessInfo(&reply, processesMap)
+		} else {
+			fmt.Printf("Fail to get process information: %v\n", err)
 		}
 
 	////////////////////////////////////////////////////////////////////////////////
@@ -74,7 +80,12 @@ func (x *CtlCommand) Execute(args []string) error {
 			if pname == "all" {
 				reply, err := rpcc.ChangeAllProcessState(verb)
 				if err == nil {
-					x.showProcessInfo(&reply, make(map[string]bool))
+					for _, pinfo := range reply.Value {
+						fmt.Printf("%s: %s\n", pinfo.Name, state[verb])
+					}
+					for _, fault := range reply.Faults {
+						fmt.Printf("%s: ERROR (%s)\n", fault.Name, fault.FaultString)
+					}
 				} else {
 					fmt.Printf("Fail to change all process state to %s", state)
 				}
@@ -101,9 +112,11 @@ func (x *CtlCommand) Execute(args []string) error {
 			} else {
 				fmt.Printf("Hmmm! Something gone wrong?!\n")
 			}
+		} else {
+			fmt.Printf("Fail to shutdown: %v\n", err)
 		}
 
-	case "reload":
+	case "reload", "update":
 		if reply, err := rpcc.ReloadConfig(); err == nil {
 			if len(reply.AddedGroup) > 0 {
 				fmt.Printf("Added Groups: %s\n", strings.Join(reply.AddedGroup, ","))
@@ -114,13 +127,24 @@ func (x *CtlCommand) Execute(args []string) error {
 			if len(reply.RemovedGroup) > 0 {
 				fmt.Printf("Removed Groups: %s\n", strings.Join(reply.RemovedGroup, ","))
 			}
+			if len(reply.AddedPrograms) > 0 {
+				fmt.Printf("Added Programs: %s\n", strings.Join(reply.AddedPrograms, ","))
+			}
+			if len(reply.ChangedPrograms) > 0 {
+				fmt.Printf("Restarted Programs: %s\n", strings.Join(reply.ChangedPrograms, ","))
+			}
+			if len(reply.RemovedPrograms) > 0 {
+				fmt.Printf("Removed Programs: %s\n", strings.Join(reply.RemovedPrograms, ","))
+			}
+		} else {
+			fmt.Printf("Fail to reload: %v\n", err)
 		}
 
 	case "signal":
 		sig_name, processes := args[1], args[2:]
 		for _, process := range processes {
 			if process == "all" {
-				reply, err := rpcc.SignalAll(process)
+				reply, err := rpcc.SignalAll(sig_name)
 				if err == nil {
 					x.showProcessInfo(&reply, make(map[string]bool))
 				} else {
@@ -40,6 +40,7 @@ func (be *BaseEvent) GetType() string {
 }
 
 type EventListenerManager struct {
+	lock sync.RWMutex
 	//mapping between the event listener name and the listener
 	namedListeners map[string]*EventListener
 	//mapping between the event name and the event listeners
@@ -67,6 +68,12 @@ func (eps *EventPoolSerial) nextSerial(pool string) uint64 {
 	return r
 }
 
+//the encoded event in the queue of event listener
+type queuedEvent struct {
+	eventType string
+	data      []byte
+}
+
 type EventListener struct {
 	pool        string
 	server      string
@@ -93,7 +100,7 @@ func NewEventListener(pool string,
 	return evtListener
 }
 
-func (el *EventListener) getFirstEvent() ([]byte, bool) {
+func (el *EventListener) getFirstEvent() (*queuedEvent, bool) {
 	el.cond.L.Lock()
 
 	defer el.cond.L.Unlock()
@@ -105,8 +112,11 @@ func (el *EventListener) getFirstEvent() ([]byte, bool) {
 	if el.events.Len() > 0 {
 		elem := el.events.Front()
 		value := elem.Value
-		b, ok := value.([]byte)
-		return b, ok
+		event, ok := value.(*queuedEvent)
+		if !ok {
+			return nil, false
+		}
+		return event, true
 	}
 	return nil, false
 }
@@ -129,27 +139,30 @@ func (el *EventListener) start() {
 				break
 			}
 			for {
-				if b, ok := el.getFirstEvent(); ok {
-					_, err := el.stdout.Write(b)
+				if event, ok := el.getFirstEvent(); ok {
+					fields := log.Fields{"eventListener": el.pool, "event": event.eventType}
+					_, err := el.stdout.Write(event.data)
 					if err != nil {
-						log.WithFields(log.Fields{"eventListener": el.pool}).Warn("fail to send event")
+						log.WithFields(fields).Warn("fail to send event")
 						break
 					}
 					result, err := el.readResult()
 					if err != nil {
-						log.WithFields(log.Fields{"eventListener": el.pool}).Warn("fail to read result")
+						log.WithFields(fields).Warn("fail to read result")
 						break
 					}
 					if result == "OK" { //remove the event if succeed
-						log.WithFields(log.Fields{"eventListener": el.pool}).Info("succeed to send the event")
+						log.WithFields(fields).Info("succeed to send the event")
 						el.removeFirstEvent()
-						break
 					} else if result == "FAIL" {
-						log.WithFields(log.Fields{"eventListener": el.pool}).Warn("fail to send the event")
-						break
+						//the event is sent again after the listener is ready
+						log.WithFields(fields).Warn("the event listener fails to handle the event")
 					} else {
-						log.WithFields(log.Fields{"eventListener": el.pool, "result": result}).Warn("unknown result from listener")
+						//the event is sent again after the listener is ready
+						fields["result"] = result
+						log.WithFields(fields).Warn("unknown result from listener")
 					}
+					break
 				}
 			}
 		}
@@ -200,12 +213,34 @@ func (el *EventListener) readResult() (string, error) {
 	return "", fmt.Errorf("Fail to read the result")
 }
 
+//check if the event of the type is waiting to be sent, the lock must be
+//held by the caller
+func (el *EventListener) hasQueuedEvent(eventType string) bool {
+	for elem := el.events.Front(); elem != nil; elem = elem.Next() {
+		if event, ok := elem.Value.(*queuedEvent); ok && event.eventType == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+//get the number of events waiting to be sent, including the sending one
+func (el *EventListener) queueLength() int {
+	el.cond.L.Lock()
+	defer el.cond.L.Unlock()
+	return el.events.Len()
+}
+
 func (el *EventListener) HandleEvent(event Event) {
-	encodedEvent := el.encodeEvent(event)
 	el.cond.L.Lock()
 	defer el.cond.L.Unlock()
+	//a busy listener gets the tick events one by one
+	if _, ok := event.(*TickEvent); ok && el.hasQueuedEvent(event.GetType()) {
+		log.WithFields(log.Fields{"eventListener": el.pool, "event": event.GetType()}).Debug("the event listener is busy, skip the tick event")
+		return
+	}
 	if el.events.Len() <= el.buffer_size {
-		el.events.PushBack(encodedEvent)
+		el.events.PushBack(&queuedEvent{eventType: event.GetType(), data: el.encodeEvent(event)})
 		el.cond.Signal()
 	} else {
 		log.WithFields(log.Fields{"eventListener": el.pool}).Error("events reaches the buffer_size, discard the events")
@@ -260,31 +295,41 @@ func init() {
 	startTickTimer()
 }
 
-func startTickTimer() {
-	tickConfigs := map[string]int64{"TICK_5": 5,
-		"TICK_60":   60,
-		"TICK_3600": 3600}
+var tickConfigs = map[string]int64{"TICK_5": 5,
+	"TICK_60":   60,
+	"TICK_3600": 3600}
 
+func startTickTimer() {
 	//start a Tick timer
 	go func() {
 		lastTickSlice := make(map[string]int64)
 
 		c := time.Tick(1 * time.Second)
 		for now := range c {
-			for tickType, period := range tickConfigs {
-				time_slice := now.Unix() / period
-				last_time_slice, ok := lastTickSlice[tickType]
-				if !ok {
-					lastTickSlice[tickType] = time_slice
-				} else if last_time_slice != time_slice {
-					lastTickSlice[tickType] = time_slice
-					EmitEvent(NewTickEvent(tickType, now.Unix()))
-				}
+			for _, event := range createTickEvents(lastTickSlice, now) {
+				EmitEvent(event)
 			}
 		}
 	}()
 }
 
+//create the tick events whose period is passed since the last tick, the
+//ticks are aligned to the wall clock and "when" is the start of the period
+func createTickEvents(lastTickSlice map[string]int64, now time.Time) []Event {
+	result := make([]Event, 0)
+	for tickType, period := range tickConfigs {
+		time_slice := now.Unix() / period
+		last_time_slice, ok := lastTickSlice[tickType]
+		if !ok {
+			lastTickSlice[tickType] = time_slice
+		} else if last_time_slice != time_slice {
+			lastTickSlice[tickType] = time_slice
+			result = append(result, NewTickEvent(tickType, time_slice*period))
+		}
+	}
+	return result
+}
+
 func nextEventSerial() uint64 {
 	return atomic.AddUint64(&eventSerial, 1)
 }
@@ -297,7 +342,11 @@ func NewEventListenerManager() *EventListenerManager {
 func (em *EventListenerManager) registerEventListener(eventListenerName string,
 	events []string,
 	listener *EventListener) {
+	em.lock.Lock()
+	defer em.lock.Unlock()
 
+	//the listener of a restarted event listener program replaces the old one
+	em.removeEventListener(eventListenerName)
 	em.namedListeners[eventListenerName] = listener
 	all_events := make(map[string]bool)
 	for _, event := range events {
@@ -329,6 +378,14 @@ func RegisterEventListener(eventListenerName string,
 }
 
 func (em *EventListenerManager) unregisterEventListener(eventListenerName string) *EventListener {
+	em.lock.Lock()
+	defer em.lock.Unlock()
+
+	return em.removeEventListener(eventListenerName)
+}
+
+//remove the event listener, the lock must be held by the caller
+func (em *EventListenerManager) removeEventListener(eventListenerName string) *EventListener {
 	listener, ok := em.namedListeners[eventListenerName]
 	if ok {
 		delete(em.namedListeners, eventListenerName)
@@ -349,10 +406,20 @@ func UnregisterEventListener(eventListenerName string) *EventListener {
 }
 
 func (em *EventListenerManager) EmitEvent(event Event) {
+	em.lock.RLock()
+	defer em.lock.RUnlock()
+
 	listeners, ok := em.eventListeners[event.GetType()]
 	if ok {
 		log.WithFields(log.Fields{"event": event.GetType()}).Info("process event")
+		//the event is sent to only one listener of a pool, the least busy one
+		pools := make(map[string]*EventListener)
 		for listener := range listeners {
+			if selected, ok := pools[listener.pool]; !ok || listener.queueLength() < selected.queueLength() {
+				pools[listener.pool] = listener
+			}
+		}
+		for _, listener := range pools {
 			log.WithFields(log.Fields{"eventListener": listener.pool, "event": event.GetType()}).Info("receive event on listener")
 			listener.HandleEvent(event)
 		}
@@ -420,99 +487,115 @@ func (te *TickEvent) GetBody() string {
 	return fmt.Sprintf("when:%d", te.when)
 }
 
+// ProcCommEventCapture captures the output of a process between
+// PROC_COMMON_BEGIN_STR and PROC_COMMON_END_STR and emits it as a process
+// communication event, the captured data over captureMaxBytes is truncated
 type ProcCommEventCapture struct {
-	reader          io.Reader
+	lock            sync.Mutex
 	captureMaxBytes int
 	stdType         string
 	procName        string
 	groupName       string
 	pid             int
-	eventBuffer     string
-	eventBeginPos   int
+	//the output which may be the beginning of a marker
+	pending string
+	//in capture mode if the begin marker is found
+	capturing bool
+	captured  string
+	truncated bool
 }
 
-func NewProcCommEventCapture(reader io.Reader,
-	captureMaxBytes int,
+func NewProcCommEventCapture(captureMaxBytes int,
 	stdType string,
 	procName string,
 	groupName string) *ProcCommEventCapture {
-	pec := &ProcCommEventCapture{reader: reader,
-		captureMaxBytes: captureMaxBytes,
-		stdType:         stdType,
-		procName:        procName,
-		groupName:       groupName,
-		pid:             -1,
-		eventBuffer:     "",
-		eventBeginPos:   -1}
-	pec.startCapture()
-	return pec
+	return &ProcCommEventCapture{captureMaxBytes: captureMaxBytes,
+		stdType:   stdType,
+		procName:  procName,
+		groupName: groupName,
+		pid:       -1}
 }
 
 func (pec *ProcCommEventCapture) SetPid(pid int) {
+	pec.lock.Lock()
+	defer pec.lock.Unlock()
 	pec.pid = pid
 }
-func (pec *ProcCommEventCapture) startCapture() {
-	go func() {
-		buf := make([]byte, 10240)
-		for {
-			n, err := pec.reader.Read(buf)
-			if err != nil {
-				break
-			}
-			pec.eventBuffer += string(buf[0:n])
-			for {
-				event := pec.captureEvent()
-				if event == nil {
-					break
-				}
-				EmitEvent(event)
+
+// Capture processes the output of the process and returns the output out of
+// the capture mode, it is written to the log as usual
+func (pec *ProcCommEventCapture) Capture(data string) string {
+	pec.lock.Lock()
+	defer pec.lock.Unlock()
+
+	output := ""
+	pec.pending += data
+	for {
+		marker := PROC_COMMON_BEGIN_STR
+		if pec.capturing {
+			marker = PROC_COMMON_END_STR
+		}
+		pos := strings.Index(pec.pending, marker)
+		if pos == -1 {
+			n := len(pec.pending) - partialMarkerLen(pec.pending, marker)
+			if pec.capturing {
+				pec.appendCaptured(pec.pending[0:n])
+			} else {
+				output += pec.pending[0:n]
 			}
+			pec.pending = pec.pending[n:]
+			return output
 		}
-	}()
+		if pec.capturing {
+			pec.appendCaptured(pec.pending[0:pos])
+			EmitEvent(NewProcCommEvent(pec.stdType,
+				pec.procName,
+				pec.groupName,
+				pec.pid,
+				pec.captured))
+			pec.captured = ""
+			pec.truncated = false
+		} else {
+			output += pec.pending[0:pos]
+		}
+		pec.capturing = !pec.capturing
+		pec.pending = pec.pending[pos+len(marker):]
+	}
 }
 
-func (pec *ProcCommEventCapture) captureEvent() Event {
-	pec.findBeginStr()
-	end_pos := pec.findEndStr()
-	if end_pos == -1 {
-		return nil
+// Flush returns the output kept for matching a marker if not in capture
+// mode, it is called when the output is closed
+func (pec *ProcCommEventCapture) Flush() string {
+	pec.lock.Lock()
+	defer pec.lock.Unlock()
+	if pec.capturing {
+		return ""
 	}
-	data := pec.eventBuffer[pec.eventBeginPos+len(PROC_COMMON_BEGIN_STR) : end_pos]
-	pec.eventBuffer = pec.eventBuffer[end_pos+len(PROC_COMMON_END_STR):]
-	pec.eventBeginPos = -1
-	return NewProcCommEvent(pec.stdType,
-		pec.procName,
-		pec.groupName,
-		pec.pid,
-		data)
-}
-
-func (pec *ProcCommEventCapture) findBeginStr() {
-	if pec.eventBeginPos == -1 {
-		pec.eventBeginPos = strings.Index(pec.eventBuffer, PROC_COMMON_BEGIN_STR)
-		if pec.eventBeginPos == -1 {
-			//remove some string
-			n := len(pec.eventBuffer)
-			if n > len(PROC_COMMON_BEGIN_STR) {
-				pec.eventBuffer = pec.eventBuffer[n-len(PROC_COMMON_BEGIN_STR):]
-			}
+	output := pec.pending
+	pec.pending = ""
+	return output
+}
+
+func (pec *ProcCommEventCapture) appendCaptured(data string) {
+	if n := pec.captureMaxBytes - len(pec.captured); n < len(data) {
+		if !pec.truncated {
+			log.WithFields(log.Fields{"program": pec.procName}).Warn("the captured data exceeds the capture_maxbytes, it is truncated")
+			pec.truncated = true
 		}
+		data = data[0:n]
 	}
+	pec.captured += data
 }
 
-func (pec *ProcCommEventCapture) findEndStr() int {
-	if pec.eventBeginPos == -1 {
-		return -1
-	}
-	end_pos := strings.Index(pec.eventBuffer, PROC_COMMON_END_STR)
-	if end_pos == -1 {
-		if len(pec.eventBuffer) > pec.captureMaxBytes {
-			log.WithFields(log.Fields{"program": pec.procName}).Warn("The capture buffer is overflow, discard the content")
-			pec.eventBeginPos = -1
-			pec.eventBuffer = ""
+// get the length of the longest suffix of s which is the beginning of the
+// marker
+func partialMarkerLen(s string, marker string) int {
+	for n := len(marker) - 1; n > 0; n-- {
+		if strings.HasSuffix(s, marker[0:n]) {
+			return n
 		}
 	}
-	return end_pos
+	return 0
 }
 
 type ProcessStateEvent struct {
@@ -687,14 +770,16 @@ type ProcessLogEvent struct {
 	process_name string
 	group_name   string
 	pid          int
+	channel      string
 	data         string
 }
 
 func (pe *ProcessLogEvent) GetBody() string {
-	return fmt.Sprintf("processname:%s groupname:%s pid:%d\n%s",
+	return fmt.Sprintf("processname:%s groupname:%s pid:%d channel:%s\n%s",
 		pe.process_name,
 		pe.group_name,
 		pe.pid,
+		pe.channel,
 		pe.data)
 }
 
@@ -705,6 +790,7 @@ func CreateProcessLogStdoutEvent(process_name string,
 	r := &ProcessLogEvent{process_name: process_name,
 		group_name: group_name,
 		pid:        pid,
+		channel:    "stdout",
 		data:       data}
 	r.eventType = "PROCESS_LOG_STDOUT"
 	r.serial = nextEventSerial()
@@ -718,6 +804,7 @@ func CreateProcessLogStderrEvent(process_name string,
 	r := &ProcessLogEvent{process_name: process_name,
 		group_name: group_name,
 		pid:        pid,
+		channel:    "stderr",
 		data:       data}
 	r.eventType = "PROCESS_LOG_STDERR"
 	r.serial = nextEventSerial()
@@ -88,10 +88,9 @@ func TestProcCommEventCapture(t *testing.T) {
 	r1, w1 := io.Pipe()
 	r2, w2 := io.Pipe()
 	reader := bufio.NewReader(r1)
+	defer eventListenerManager.unregisterEventListener("pool-1")
 
-	capture_reader, capture_writer := io.Pipe()
-	eventCapture := NewProcCommEventCapture(capture_reader,
-		10240,
+	eventCapture := NewProcCommEventCapture(10240,
 		"PROCESS_COMMUNICATION_STDOUT",
 		"proc-1",
 		"group-1")
@@ -105,15 +104,49 @@ func TestProcCommEventCapture(t *testing.T) {
 		[]string{"PROCESS_COMMUNICATION"},
 		listener)
 	w2.Write([]byte("READY\n"))
-	capture_writer.Write([]byte(`this is unuseful information, seems it is very 
-	long and not useful, just used for testing purpose.
-	let's input more unuseful information, ok.....
-	haha...<!--XSUPERVISOR:BEGIN-->this is a proc event test<!--XSUPERVISOR:END--> also
-	add some other unuseful`))
+	// the markers may be split in the output
+	output := eventCapture.Capture("not captured <!--XSUPER")
+	output += eventCapture.Capture("VISOR:BEGIN-->this is a proc event test<!--XSUPERVISOR:E")
+	output += eventCapture.Capture("ND--> also not captured <")
+	output += eventCapture.Flush()
+	if output != "not captured  also not captured <" {
+		t.Errorf("Wrong output out of capture mode: %s", output)
+	}
 	_, body := readEvent(reader)
 	expect_body := "processname:proc-1 groupname:group-1 pid:99\nthis is a proc event test"
 	if body != expect_body {
-		t.Error("Fail to get the process communication event")
+		t.Errorf("Fail to get the process communication event: %s", body)
+	}
+	w2.Close()
+	r2.Close()
+	r1.Close()
+	w1.Close()
+}
+
+func TestProcCommEventCaptureTruncated(t *testing.T) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	reader := bufio.NewReader(r1)
+	defer eventListenerManager.unregisterEventListener("pool-truncated")
+
+	eventCapture := NewProcCommEventCapture(10,
+		"PROCESS_COMMUNICATION_STDERR",
+		"proc-1",
+		"group-1")
+	listener := NewEventListener("pool-truncated",
+		"supervisor",
+		r2,
+		w1,
+		10)
+	eventListenerManager.registerEventListener("pool-truncated",
+		[]string{"PROCESS_COMMUNICATION_STDERR"},
+		listener)
+	w2.Write([]byte("READY\n"))
+	eventCapture.Capture("<!--XSUPERVISOR:BEGIN-->0123456")
+	eventCapture.Capture("789abcdef<!--XSUPERVISOR:END-->")
+	header, body := readEvent(reader)
+	if !strings.Contains(header, "eventname:PROCESS_COMMUNICATION_STDERR ") || body != "processname:proc-1 groupname:group-1 pid:-1\n0123456789" {
+		t.Errorf("The captured data should be truncated, header=%s, body=%s", header, body)
 	}
 	w2.Close()
 	r2.Close()
@@ -200,3 +233,127 @@ func TestProcessUnknownEvent(t *testing.T) {
 		t.Error("Fail to encode the process unknown event")
 	}
 }
+
+func TestProcessLogEvent(t *testing.T) {
+	event := CreateProcessLogStderrEvent("proc-1", "group-1", 2766, "error line\n")
+	if event.GetType() != "PROCESS_LOG_STDERR" {
+		t.Error("Fail to creating the process log event")
+	}
+	if event.GetBody() != "processname:proc-1 groupname:group-1 pid:2766 channel:stderr\nerror line\n" {
+		t.Errorf("Fail to encode the process log event: %s", event.GetBody())
+	}
+}
+
+func TestProcessStateEventListener(t *testing.T) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	reader := bufio.NewReader(r1)
+	defer eventListenerManager.unregisterEventListener("pool-state")
+
+	listener := NewEventListener("pool-state",
+		"supervisor",
+		r2,
+		w1,
+		10)
+	RegisterEventListener("pool-state", []string{"PROCESS_STATE"}, listener)
+	w2.Write([]byte("READY\n"))
+	EmitEvent(CreateProcessRunningEvent("proc-1", "group-1", "STARTING", 2766))
+	header, body := readEvent(reader)
+	if !strings.HasPrefix(header, "ver:3.0 server:supervisor ") || !strings.Contains(header, " pool:pool-state poolserial:1 eventname:PROCESS_STATE_RUNNING ") {
+		t.Errorf("Wrong event header: %s", header)
+	}
+	if body != "processname:proc-1 groupname:group-1 from_state:STARTING pid:2766" {
+		t.Errorf("Wrong event body: %s", body)
+	}
+	// the event is sent again after an unknown result
+	w2.Write([]byte("RESULT 3\nBAD"))
+	w2.Write([]byte("READY\n"))
+	if _, body = readEvent(reader); body != "processname:proc-1 groupname:group-1 from_state:STARTING pid:2766" {
+		t.Errorf("The event should be sent again, body: %s", body)
+	}
+	w2.Write([]byte("RESULT 2\nOK"))
+	w2.Write([]byte("READY\n"))
+	EmitEvent(CreateProcessExitedEvent("proc-1", "group-1", "RUNNING", 1, 2766))
+	if header, _ = readEvent(reader); !strings.Contains(header, " poolserial:2 eventname:PROCESS_STATE_EXITED ") {
+		t.Errorf("Wrong event header: %s", header)
+	}
+	w2.Close()
+	r2.Close()
+	r1.Close()
+	w1.Close()
+}
+
+func TestReplaceEventListener(t *testing.T) {
+	defer eventListenerManager.unregisterEventListener("pool-replace")
+	r1, w1 := io.Pipe()
+	defer w1.Close()
+	r2, w2 := io.Pipe()
+	defer w2.Close()
+	listener1 := NewEventListener("pool-replace", "supervisor", r1, io.Discard, 10)
+	listener2 := NewEventListener("pool-replace", "supervisor", r2, io.Discard, 10)
+	RegisterEventListener("pool-replace", []string{"TICK_5"}, listener1)
+	RegisterEventListener("pool-replace", []string{"TICK_60"}, listener2)
+
+	eventListenerManager.lock.RLock()
+	defer eventListenerManager.lock.RUnlock()
+	if eventListenerManager.eventListeners["TICK_5"][listener1] || !eventListenerManager.eventListeners["TICK_60"][listener2] {
+		t.Error("The event listener with the same name should be replaced")
+	}
+}
+
+func TestCreateTickEvents(t *testing.T) {
+	lastTickSlice := make(map[string]int64)
+	if len(createTickEvents(lastTickSlice, time.Unix(3598, 0))) != 0 {
+		t.Error("No tick events should be created at the beginning")
+	}
+	events := createTickEvents(lastTickSlice, time.Unix(3601, 0))
+	bodies := make(map[string]string)
+	for _, event := range events {
+		bodies[event.GetType()] = event.GetBody()
+	}
+	if len(bodies) != 3 || bodies["TICK_5"] != "when:3600" || bodies["TICK_60"] != "when:3600" || bodies["TICK_3600"] != "when:3600" {
+		t.Errorf("Wrong tick events: %v", bodies)
+	}
+	events = createTickEvents(lastTickSlice, time.Unix(3605, 0))
+	if len(events) != 1 || events[0].GetType() != "TICK_5" || events[0].GetBody() != "when:3605" {
+		t.Error("Only TICK_5 should be created")
+	}
+}
+
+func TestSkipTickEventIfBusy(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	listener := NewEventListener("pool-tick", "supervisor", r, io.Discard, 10)
+	// the listener is not ready, so the events are queued
+	listener.HandleEvent(NewTickEvent("TICK_5", 5))
+	listener.HandleEvent(NewTickEvent("TICK_5", 10))
+	listener.HandleEvent(NewTickEvent("TICK_60", 60))
+	listener.HandleEvent(NewRemoteCommunicationEvent("type-1", "data"))
+	listener.HandleEvent(NewRemoteCommunicationEvent("type-1", "data"))
+
+	listener.cond.L.Lock()
+	defer listener.cond.L.Unlock()
+	if listener.events.Len() != 4 {
+		t.Errorf("The tick event should be skipped if the same tick is waiting, events=%d", listener.events.Len())
+	}
+}
+
+func TestEventListenerPool(t *testing.T) {
+	defer eventListenerManager.unregisterEventListener("pool-x_0")
+	defer eventListenerManager.unregisterEventListener("pool-x_1")
+	r1, w1 := io.Pipe()
+	defer w1.Close()
+	r2, w2 := io.Pipe()
+	defer w2.Close()
+	// the listeners are not ready, so the events are queued
+	listener1 := NewEventListener("pool-x", "supervisor", r1, io.Discard, 10)
+	listener2 := NewEventListener("pool-x", "supervisor", r2, io.Discard, 10)
+	RegisterEventListener("pool-x_0", []string{"REMOTE_COMMUNICATION"}, listener1)
+	RegisterEventListener("pool-x_1", []string{"REMOTE_COMMUNICATION"}, listener2)
+
+	EmitEvent(NewRemoteCommunicationEvent("type-1", "data-1"))
+	EmitEvent(NewRemoteCommunicationEvent("type-1", "data-2"))
+	if listener1.queueLength() != 1 || listener2.queueLength() != 1 {
+		t.Errorf("The events should be sent to one listener of the pool, queued=%d,%d", listener1.queueLength(), listener2.queueLength())
+	}
+}
@@ -25,6 +25,8 @@ const (
 	CANT_REREAD           = 92
 )
 
+// create a fault with the code, the fault is returned by value because
+// the xml codec only writes a xmlrpc.Fault value as <fault> with its code
 func NewFault(code int, desc string) error {
-	return &xmlrpc.Fault{Code: code, String: desc}
+	return xmlrpc.Fault{Code: code, String: desc}
 }
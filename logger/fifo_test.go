@@ -0,0 +1,94 @@
+// +build !windows,!nacl,!plan9
+
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func createTestFifo(t *testing.T) (string, func()) {
+	dir, _ := ioutil.TempDir("", "logger")
+	name := filepath.Join(dir, "test.fifo")
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("Fail to create the named pipe: %v", err)
+	}
+	return name, func() { os.RemoveAll(dir) }
+}
+
+func openFifoReader(t *testing.T, name string) *os.File {
+	reader, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("Fail to open the named pipe for reading: %v", err)
+	}
+	return reader
+}
+
+func readFifo(reader *os.File) string {
+	reader.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, _ := reader.Read(buf)
+	return string(buf[0:n])
+}
+
+func TestFifoLogger(t *testing.T) {
+	name, cleanup := createTestFifo(t)
+	defer cleanup()
+
+	logger := NewLogger("test", name, &sync.Mutex{}, 1024, 1, NewNullLogEventEmitter())
+	defer logger.Close()
+	if _, ok := logger.(*FifoLogger); !ok {
+		t.Fatalf("The named pipe should be written by FifoLogger, got %T", logger)
+	}
+	//no reader, the log is dropped without blocking
+	if n, err := logger.Write([]byte("dropped\n")); n != 8 || err != nil {
+		t.Errorf("Fail to write without reader, n=%d, err=%v", n, err)
+	}
+
+	reader := openFifoReader(t, name)
+	logger.Write([]byte("hello\n"))
+	if s := readFifo(reader); s != "hello\n" {
+		t.Errorf("Wrong log read from the named pipe: %q", s)
+	}
+
+	//the reader comes again after it is gone
+	reader.Close()
+	logger.Write([]byte("lost\n"))
+	reader = openFifoReader(t, name)
+	defer reader.Close()
+	logger.Write([]byte("again\n"))
+	if s := readFifo(reader); s != "again\n" {
+		t.Errorf("The named pipe is not opened again after the reader is back: %q", s)
+	}
+}
+
+func TestFifoLoggerNotBlockedWhenFull(t *testing.T) {
+	name, cleanup := createTestFifo(t)
+	defer cleanup()
+
+	logger := NewLogger("test", name, &sync.Mutex{}, 1024, 1, NewNullLogEventEmitter())
+	defer logger.Close()
+	reader := openFifoReader(t, name)
+	defer reader.Close()
+
+	done := make(chan struct{})
+	go func() {
+		line := []byte(strings.Repeat("x", 1023) + "\n")
+		for i := 0; i < 1024; i++ {
+			logger.Write(line)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The write is blocked when the pipe buffer is full")
+	}
+}
@@ -0,0 +1,90 @@
+// +build !windows,!nacl,!plan9
+
+package logger
+
+import (
+	"os"
+	"sync"
+	"syscall"
+)
+
+// FifoLogger writes the log to a named pipe without blocking the program.
+// The pipe is opened when a reader is present and opened again after the
+// reader goes away, the log written without a reader or when the pipe
+// buffer is full is dropped
+type FifoLogger struct {
+	NullLogger
+	name   string
+	fd     int
+	locker sync.Locker
+}
+
+// create a logger if the logFile is a named pipe
+func newFifoLogger(logFile string, locker sync.Locker, logEventEmitter LogEventEmitter) (Logger, bool) {
+	fileInfo, err := os.Stat(logFile)
+	if err != nil || fileInfo.Mode()&os.ModeNamedPipe == 0 {
+		return nil, false
+	}
+	return NewFifoLogger(logFile, locker, logEventEmitter), true
+}
+
+func NewFifoLogger(name string, locker sync.Locker, logEventEmitter LogEventEmitter) *FifoLogger {
+	return &FifoLogger{NullLogger: NullLogger{logEventEmitter: logEventEmitter},
+		name:   name,
+		fd:     -1,
+		locker: locker}
+}
+
+// open the pipe for writing, it fails with ENXIO if no reader is present
+func (l *FifoLogger) open() bool {
+	if l.fd >= 0 {
+		return true
+	}
+	fd, err := syscall.Open(l.name, syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return false
+	}
+	l.fd = fd
+	return true
+}
+
+// Write never blocks and never fails, so the output of the program is
+// always consumed
+func (l *FifoLogger) Write(p []byte) (int, error) {
+	l.logEventEmitter.emitLogEvent(string(p))
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	for b := p; len(b) > 0 && l.open(); {
+		n, err := syscall.Write(l.fd, b)
+		if n > 0 {
+			b = b[n:]
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			//the pipe buffer is full, drop the rest
+			break
+		}
+		if err != nil {
+			//the reader is gone, open the pipe again in next write
+			syscall.Close(l.fd)
+			l.fd = -1
+			break
+		}
+	}
+	return len(p), nil
+}
+
+func (l *FifoLogger) Close() error {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.fd < 0 {
+		return nil
+	}
+	err := syscall.Close(l.fd)
+	l.fd = -1
+	return err
+}
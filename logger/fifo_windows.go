@@ -0,0 +1,12 @@
+// +build windows plan9 nacl
+
+package logger
+
+import (
+	"sync"
+)
+
+// the named pipe is not supported, the logFile is written as a file
+func newFifoLogger(logFile string, locker sync.Locker, logEventEmitter LogEventEmitter) (Logger, bool) {
+	return nil, false
+}
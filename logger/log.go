@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"bytes"
+	"compress/gzip"
 	"errors"
 	"fmt"
 	"github.com/csxuejin/supervisord/events"
@@ -8,8 +10,6 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path"
-	"strconv"
 	"strings"
 	"sync"
 )
@@ -21,6 +21,8 @@ type Logger interface {
 	SetPid(pid int)
 	ReadLog(offset int64, length int64) (string, error)
 	ReadTailLog(offset int64, length int64) (string, int64, bool, error)
+	ReadLogRange(offset int64, length int64) (string, error)
+	ReadBackupLog(index int, offset int64, length int64) (string, error)
 	ClearCurLogFile() error
 	ClearAllLogFile() error
 }
@@ -29,11 +31,12 @@ type LogEventEmitter interface {
 	emitLogEvent(data string)
 }
 
+//the log is written to file "name", it is rotated to "name.1", "name.2",
+//... up to "name.<backups>" when its size exceeds maxSize
 type FileLogger struct {
 	name            string
 	maxSize         int64
 	backups         int
-	curRotate       int
 	fileSize        int64
 	file            *os.File
 	logEventEmitter LogEventEmitter
@@ -57,12 +60,11 @@ func NewFileLogger(name string, maxSize int64, backups int, logEventEmitter LogE
 	logger := &FileLogger{name: name,
 		maxSize:         maxSize,
 		backups:         backups,
-		curRotate:       -1,
 		fileSize:        0,
 		file:            nil,
 		logEventEmitter: logEventEmitter,
 		locker:          locker}
-	logger.updateLatestLog()
+	logger.openFile(false)
 	return logger
 }
 
@@ -70,76 +72,61 @@ func (l *FileLogger) SetPid(pid int) {
 	//NOTHING TO DO
 }
 
-// return the next log file name
-func (l *FileLogger) nextLogFile() {
-	l.curRotate++
-	if l.curRotate >= l.backups {
-		l.curRotate = 0
-	}
-}
-
-func (l *FileLogger) updateLatestLog() {
-	dir := path.Dir(l.name)
-	files, err := ioutil.ReadDir(dir)
-	baseName := path.Base(l.name)
-
-	if err != nil {
-		l.curRotate = 0
-	} else {
-		//find all the rotate files
-		var latestFile os.FileInfo
-		latestNum := -1
-		for _, fileInfo := range files {
-			if !fileInfo.IsDir() && strings.HasPrefix(fileInfo.Name(), baseName+".") {
-				n, err := strconv.Atoi(fileInfo.Name()[len(baseName)+1:])
-				if err == nil && n >= 0 && n < l.backups {
-					if latestFile == nil || latestFile.ModTime().Before(fileInfo.ModTime()) {
-						latestFile = fileInfo
-						latestNum = n
-					}
-				}
-			}
-		}
-		l.curRotate = latestNum
-		if latestFile != nil {
-			l.fileSize = latestFile.Size()
-		} else {
-			l.fileSize = int64(0)
+// rotate the log files: "name.<backups-1>" is renamed to "name.<backups>",
+// ..., "name" is renamed to "name.1" and a new "name" is created. The
+// compressed backups "name.<i>.gz" are shifted with the plain ones and the
+// oldest backup is dropped. The log is just truncated if no backups
+func (l *FileLogger) rotate() error {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	if l.backups > 0 {
+		os.Remove(l.getLogFileName(l.backups))
+		os.Remove(l.getLogFileName(l.backups) + ".gz")
+		for i := l.backups - 1; i > 0; i-- {
+			os.Rename(l.getLogFileName(i), l.getLogFileName(i+1))
+			os.Rename(l.getLogFileName(i)+".gz", l.getLogFileName(i+1)+".gz")
 		}
-		if l.fileSize >= l.maxSize || latestFile == nil {
-			l.nextLogFile()
-			l.openFile(true)
-		} else {
-			l.openFile(false)
+		if err := os.Rename(l.name, l.getLogFileName(1)); err != nil && !os.IsNotExist(err) {
+			return err
 		}
 	}
+	return l.openFile(true)
 }
 
 // open the file and truncate the file if trunc is true
 func (l *FileLogger) openFile(trunc bool) error {
 	if l.file != nil {
 		l.file.Close()
+		l.file = nil
 	}
-	var err error
-	fileName := l.GetCurrentLogFile()
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
 	if trunc {
-		l.file, err = os.Create(fileName)
-	} else {
-		l.file, err = os.OpenFile(fileName, os.O_RDWR|os.O_APPEND, 0666)
+		flag |= os.O_TRUNC
 	}
-	return err
+	file, err := os.OpenFile(l.name, flag, 0666)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.fileSize = fileInfo.Size()
+	return nil
 }
 
 // get the name of current log file
 func (l *FileLogger) GetCurrentLogFile() string {
-	return l.getLogFileName(l.curRotate)
+	return l.name
 }
 
 // get the name of previous log file
 func (l *FileLogger) GetPrevLogFile() string {
-	i := (l.curRotate - 1 + l.backups) % l.backups
-
-	return l.getLogFileName(i)
+	return l.getLogFileName(1)
 }
 
 func (l *FileLogger) getLogFileName(index int) string {
@@ -158,14 +145,14 @@ func (l *FileLogger) ClearAllLogFile() error {
 	l.locker.Lock()
 	defer l.locker.Unlock()
 
-	for i := 0; i < l.backups && i <= l.curRotate; i++ {
-		logFile := l.getLogFileName(i)
-		err := os.Remove(logFile)
-		if err != nil {
-			return faults.NewFault(faults.FAILED, err.Error())
+	for i := 1; i <= l.backups; i++ {
+		for _, name := range []string{l.getLogFileName(i), l.getLogFileName(i) + ".gz"} {
+			err := os.Remove(name)
+			if err != nil && !os.IsNotExist(err) {
+				return faults.NewFault(faults.FAILED, err.Error())
+			}
 		}
 	}
-	l.curRotate = 0
 	err := l.openFile(true)
 	if err != nil {
 		return faults.NewFault(faults.FAILED, err.Error())
@@ -231,6 +218,12 @@ func (l *FileLogger) ReadLog(offset int64, length int64) (string, error) {
 	return string(b[:n]), nil
 }
 
+// ReadTailLog reads at most length bytes from offset of the current log file
+// and returns them with the offset after them. If the offset is not less
+// than the size of the log file, nothing is read and the size is returned as
+// the offset with the overflow true, so a client can get the size by an
+// offset beyond the end, e.g. math.MaxInt64, like the tailFile of python
+// supervisord
 func (l *FileLogger) ReadTailLog(offset int64, length int64) (string, int64, bool, error) {
 	if offset < 0 {
 		return "", offset, false, fmt.Errorf("offset should not be less than 0")
@@ -276,11 +269,134 @@ func (l *FileLogger) ReadTailLog(offset int64, length int64) (string, int64, boo
 
 }
 
-// Override the function in io.Writer
+// ReadLogRange reads length bytes from offset of the log files, the offset
+// 0 is the beginning of the oldest backup and the current log file follows
+// the backups, so a range can span the rotated and the current log. The
+// backup "name.<index>.gz" compressed after rotation is decompressed. A
+// length 0 reads to the end of the current log file
+func (l *FileLogger) ReadLogRange(offset int64, length int64) (string, error) {
+	if offset < 0 || length < 0 {
+		return "", faults.NewFault(faults.BAD_ARGUMENTS, "BAD_ARGUMENTS")
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	var buf bytes.Buffer
+	for i := l.backups; i >= 0 && (length == 0 || int64(buf.Len()) < length); i-- {
+		r, err := l.openLogFile(i)
+		if err != nil {
+			return "", faults.NewFault(faults.FAILED, err.Error())
+		}
+		if r == nil {
+			continue
+		}
+		//skip the offset in this file, the rest is skipped in next files
+		skipped, err := io.CopyN(ioutil.Discard, r, offset)
+		offset -= skipped
+		if err == nil {
+			if length == 0 {
+				_, err = io.Copy(&buf, r)
+			} else {
+				_, err = io.CopyN(&buf, r, length-int64(buf.Len()))
+			}
+		}
+		r.Close()
+		if err != nil && err != io.EOF {
+			return "", faults.NewFault(faults.FAILED, err.Error())
+		}
+	}
+	return buf.String(), nil
+}
+
+// ReadBackupLog reads length bytes from offset of the rotated backup
+// "name.<index>", the index is from 1 to the backups. The compressed backup
+// "name.<index>.gz" is decompressed. A length 0 reads to the end of the
+// backup, a NO_FILE fault is returned if the backup doesn't exist
+func (l *FileLogger) ReadBackupLog(index int, offset int64, length int64) (string, error) {
+	if index < 1 || index > l.backups {
+		return "", faults.NewFault(faults.BAD_ARGUMENTS, fmt.Sprintf("BAD_ARGUMENTS: the backup index %d is not in 1..%d", index, l.backups))
+	}
+	if offset < 0 || length < 0 {
+		return "", faults.NewFault(faults.BAD_ARGUMENTS, "BAD_ARGUMENTS")
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	r, err := l.openLogFile(index)
+	if err != nil {
+		return "", faults.NewFault(faults.FAILED, err.Error())
+	}
+	if r == nil {
+		return "", faults.NewFault(faults.NO_FILE, fmt.Sprintf("NO_FILE: %s", l.getLogFileName(index)))
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	_, err = io.CopyN(ioutil.Discard, r, offset)
+	if err == nil {
+		if length == 0 {
+			_, err = io.Copy(&buf, r)
+		} else {
+			_, err = io.CopyN(&buf, r, length)
+		}
+	}
+	if err != nil && err != io.EOF {
+		return "", faults.NewFault(faults.FAILED, err.Error())
+	}
+	return buf.String(), nil
+}
+
+// open the log file with index, 0 is the current log file. The compressed
+// backup is opened if the backup is not found, nil is returned if neither
+// exists
+func (l *FileLogger) openLogFile(index int) (io.ReadCloser, error) {
+	name := l.name
+	if index > 0 {
+		name = l.getLogFileName(index)
+	}
+	f, err := os.Open(name)
+	if err == nil {
+		return f, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	} else if index == 0 {
+		return nil, nil
+	}
+	f, err = os.Open(name + ".gz")
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: gz, file: f}, nil
+}
+
+// gzipFile closes the compressed file after reading it
+type gzipFile struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// Override the function in io.Writer, the log is rotated if its size
+// exceeds maxSize. A maxSize <= 0 means no rotation
 func (l *FileLogger) Write(p []byte) (int, error) {
 	l.locker.Lock()
 	defer l.locker.Unlock()
 
+	if l.file == nil {
+		if err := l.openFile(false); err != nil {
+			return 0, err
+		}
+	}
 	n, err := l.file.Write(p)
 
 	if err != nil {
@@ -288,24 +404,20 @@ func (l *FileLogger) Write(p []byte) (int, error) {
 	}
 	l.logEventEmitter.emitLogEvent(string(p))
 	l.fileSize += int64(n)
-	if l.fileSize >= l.maxSize {
-		fileInfo, errStat := os.Stat(fmt.Sprintf("%s.%d", l.name, l.curRotate))
-		if errStat == nil {
-			l.fileSize = fileInfo.Size()
-		} else {
-			return n, errStat
-		}
-	}
-	if l.fileSize >= l.maxSize {
-		l.nextLogFile()
-		l.openFile(true)
+	if l.maxSize > 0 && l.fileSize >= l.maxSize {
+		err = l.rotate()
 	}
 	return n, err
 }
 
 func (l *FileLogger) Close() error {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
 	if l.file != nil {
-		return l.file.Close()
+		err := l.file.Close()
+		l.file = nil
+		return err
 	}
 	return nil
 }
@@ -349,6 +461,14 @@ func (l *NullLogger) ReadTailLog(offset int64, length int64) (string, int64, boo
 	return "", 0, false, faults.NewFault(faults.NO_FILE, "NO_FILE")
 }
 
+func (l *NullLogger) ReadLogRange(offset int64, length int64) (string, error) {
+	return "", faults.NewFault(faults.NO_FILE, "NO_FILE")
+}
+
+func (l *NullLogger) ReadBackupLog(index int, offset int64, length int64) (string, error) {
+	return "", faults.NewFault(faults.NO_FILE, "NO_FILE")
+}
+
 func (l *NullLogger) ClearCurLogFile() error {
 	return fmt.Errorf("No log")
 }
@@ -380,7 +500,7 @@ func NewStdoutLogger(logEventEmitter LogEventEmitter) *StdLogger {
 
 func (l *StdLogger) Write(p []byte) (int, error) {
 	n, err := l.writer.Write(p)
-	if err != nil {
+	if err == nil {
 		l.logEventEmitter.emitLogEvent(string(p))
 	}
 	return n, err
@@ -391,10 +511,12 @@ func NewStderrLogger(logEventEmitter LogEventEmitter) *StdLogger {
 		writer: os.Stderr}
 }
 
+// LogCaptureLogger writes the output of a process to the underline logger
+// except the data in capture mode, which is emitted as a process
+// communication event
 type LogCaptureLogger struct {
-	underlineLogger        Logger
-	procCommEventCapWriter io.Writer
-	procCommEventCapture   *events.ProcCommEventCapture
+	underlineLogger      Logger
+	procCommEventCapture *events.ProcCommEventCapture
 }
 
 func NewLogCaptureLogger(underlineLogger Logger,
@@ -402,15 +524,12 @@ func NewLogCaptureLogger(underlineLogger Logger,
 	stdType string,
 	procName string,
 	groupName string) *LogCaptureLogger {
-	r, w := io.Pipe()
-	eventCapture := events.NewProcCommEventCapture(r,
-		captureMaxBytes,
+	eventCapture := events.NewProcCommEventCapture(captureMaxBytes,
 		stdType,
 		procName,
 		groupName)
 	return &LogCaptureLogger{underlineLogger: underlineLogger,
-		procCommEventCapWriter: w,
-		procCommEventCapture:   eventCapture}
+		procCommEventCapture: eventCapture}
 }
 
 func (l *LogCaptureLogger) SetPid(pid int) {
@@ -418,11 +537,18 @@ func (l *LogCaptureLogger) SetPid(pid int) {
 }
 
 func (l *LogCaptureLogger) Write(p []byte) (int, error) {
-	l.procCommEventCapWriter.Write(p)
-	return l.underlineLogger.Write(p)
+	if output := l.procCommEventCapture.Capture(string(p)); len(output) > 0 {
+		if _, err := l.underlineLogger.Write([]byte(output)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
 }
 
 func (l *LogCaptureLogger) Close() error {
+	if output := l.procCommEventCapture.Flush(); len(output) > 0 {
+		l.underlineLogger.Write([]byte(output))
+	}
 	return l.underlineLogger.Close()
 }
 
@@ -434,6 +560,14 @@ func (l *LogCaptureLogger) ReadTailLog(offset int64, length int64) (string, int6
 	return l.underlineLogger.ReadTailLog(offset, length)
 }
 
+func (l *LogCaptureLogger) ReadLogRange(offset int64, length int64) (string, error) {
+	return l.underlineLogger.ReadLogRange(offset, length)
+}
+
+func (l *LogCaptureLogger) ReadBackupLog(index int, offset int64, length int64) (string, error) {
+	return l.underlineLogger.ReadBackupLog(index, offset, length)
+}
+
 func (l *LogCaptureLogger) ClearCurLogFile() error {
 	return l.underlineLogger.ClearCurLogFile()
 }
@@ -537,12 +671,13 @@ func NewLogger(programName string, logFile string, locker sync.Locker, maxBytes
 	}
 	if strings.HasPrefix(logFile, "syslog") {
 		fields := strings.Split(logFile, "@")
-		fields[0] = strings.TrimSpace(fields[0])
-		fields[1] = strings.TrimSpace(fields[1])
-		if len(fields) == 2 && fields[0] == "syslog" {
-			return NewRemoteSysLogger(programName, fields[1], logEventEmitter)
+		if len(fields) == 2 && strings.TrimSpace(fields[0]) == "syslog" {
+			return NewRemoteSysLogger(programName, strings.TrimSpace(fields[1]), logEventEmitter)
 		}
 	}
+	if fifoLogger, ok := newFifoLogger(logFile, locker, logEventEmitter); ok {
+		return fifoLogger
+	}
 	if len(logFile) > 0 {
 		return NewFileLogger(logFile, maxBytes, backups, logEventEmitter, locker)
 	}
@@ -1,7 +1,14 @@
 package logger
 
 import (
+	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -12,3 +19,243 @@ func TestWriteSingleLog(t *testing.T) {
 	}
 	logger.Close()
 }
+
+func fileSize(name string) int64 {
+	fileInfo, err := os.Stat(name)
+	if err != nil {
+		return -1
+	}
+	return fileInfo.Size()
+}
+
+// write 10 lines, 17 bytes per line
+func writeTestLines(logger *FileLogger) {
+	for i := 0; i < 10; i++ {
+		logger.Write([]byte(fmt.Sprintf("this is a test %d\n", i)))
+	}
+}
+
+func TestRotateLogBySize(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewFileLogger(name, int64(50), 2, NewNullLogEventEmitter(), NewNullLocker())
+	writeTestLines(logger)
+	logger.Close()
+
+	// rotated after every 3 lines, the oldest backup is dropped
+	if fileSize(name) != 17 || fileSize(name+".1") != 51 || fileSize(name+".2") != 51 || fileSize(name+".3") != -1 {
+		t.Errorf("Wrong rotated log files, sizes: %d, %d, %d, %d", fileSize(name), fileSize(name+".1"), fileSize(name+".2"), fileSize(name+".3"))
+	}
+	if s, _ := logger.ReadLog(0, 0); s != "this is a test 9\n" {
+		t.Errorf("The current log should be read, log=%q", s)
+	}
+}
+
+func TestRotateLogWithoutBackups(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewFileLogger(name, int64(50), 0, NewNullLogEventEmitter(), NewNullLocker())
+	writeTestLines(logger)
+	logger.Close()
+
+	if fileSize(name) != 17 || fileSize(name+".1") != -1 {
+		t.Errorf("The log should be truncated without backups, sizes: %d, %d", fileSize(name), fileSize(name+".1"))
+	}
+}
+
+func TestNoRotateIfMaxBytesIsZero(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewFileLogger(name, int64(0), 2, NewNullLogEventEmitter(), NewNullLocker())
+	writeTestLines(logger)
+	logger.Close()
+
+	if fileSize(name) != 170 || fileSize(name+".1") != -1 {
+		t.Errorf("The log should not be rotated, sizes: %d, %d", fileSize(name), fileSize(name+".1"))
+	}
+}
+
+func TestAppendToExistingLog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	ioutil.WriteFile(name, []byte("0123456789012345678901234567890123456789"), 0666)
+	logger := NewFileLogger(name, int64(50), 2, NewNullLogEventEmitter(), NewNullLocker())
+	logger.Write([]byte("0123456789"))
+	logger.Close()
+
+	// the size of existing log is counted
+	if fileSize(name) != 0 || fileSize(name+".1") != 50 {
+		t.Errorf("The existing log should be rotated, sizes: %d, %d", fileSize(name), fileSize(name+".1"))
+	}
+}
+
+// compress the file to "<name>.gz" and remove it
+func compressFile(t *testing.T, name string) {
+	b, _ := ioutil.ReadFile(name)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	if err := ioutil.WriteFile(name+".gz", buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(name)
+}
+
+func TestRotateCompressedBackup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewFileLogger(name, int64(50), 3, NewNullLogEventEmitter(), NewNullLocker())
+	writeTestLines(logger)
+	defer logger.Close()
+	// the lines 6-8 in the backup 1 are compressed and then shifted to the
+	// backup 2 by the next rotation, the lines 0-2 in the oldest are dropped
+	compressFile(t, name+".1")
+	expected := ""
+	for i := 3; i < 10; i++ {
+		expected += fmt.Sprintf("this is a test %d\n", i)
+	}
+	for _, c := range "abc" {
+		line := fmt.Sprintf("this is a test %c\n", c)
+		logger.Write([]byte(line))
+		expected += line
+	}
+
+	if fileSize(name+".2.gz") <= 0 || fileSize(name+".2") >= 0 || fileSize(name+".1.gz") >= 0 {
+		t.Errorf("The compressed backup is not shifted, sizes: %d, %d, %d", fileSize(name+".2.gz"), fileSize(name+".2"), fileSize(name+".1.gz"))
+	}
+	if s, err := logger.ReadLogRange(0, 0); err != nil || s != expected {
+		t.Errorf("Wrong log history after rotation: %q, err=%v", s, err)
+	}
+
+	// the compressed oldest backup is dropped
+	for i := 0; i < 6; i++ {
+		logger.Write([]byte("this is a test x\n"))
+	}
+	if fileSize(name+".3.gz") >= 0 || fileSize(name+".4.gz") >= 0 {
+		t.Errorf("The compressed oldest backup is not dropped")
+	}
+}
+
+func TestReadLogRange(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewFileLogger(name, int64(50), 2, NewNullLogEventEmitter(), NewNullLocker())
+	writeTestLines(logger)
+	defer logger.Close()
+	// the lines 3-5 are in the compressed backup, 6-8 in the backup and 9
+	// in the current log
+	compressFile(t, name+".2")
+
+	tests := []struct {
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{0, 17, "this is a test 3\n"},
+		{34, 34, "this is a test 5\nthis is a test 6\n"},
+		{85, 0, "this is a test 8\nthis is a test 9\n"},
+		{102, 0, "this is a test 9\n"},
+		{200, 0, ""},
+	}
+	for _, test := range tests {
+		if s, err := logger.ReadLogRange(test.offset, test.length); err != nil || s != test.expected {
+			t.Errorf("Wrong log read from %d, length %d: %q, err=%v", test.offset, test.length, s, err)
+		}
+	}
+	if _, err := logger.ReadLogRange(-1, 0); err == nil {
+		t.Error("The negative offset should be rejected")
+	}
+}
+
+func TestReadTailLogBeyondEnd(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	logger := NewFileLogger(filepath.Join(dir, "test.log"), int64(1024), 1, NewNullLogEventEmitter(), NewNullLocker())
+	defer logger.Close()
+	writeTestLines(logger)
+
+	// the offset beyond the end gets the size of the log
+	s, offset, overflow, err := logger.ReadTailLog(math.MaxInt64, 0)
+	if err != nil || s != "" || offset != 170 || !overflow {
+		t.Errorf("Wrong tail beyond the end: %q, offset=%d, overflow=%v, err=%v", s, offset, overflow, err)
+	}
+	s, offset, overflow, err = logger.ReadTailLog(153, 100)
+	if err != nil || s != "this is a test 9\n" || offset != 170 || overflow {
+		t.Errorf("Wrong tail of the last line: %q, offset=%d, overflow=%v, err=%v", s, offset, overflow, err)
+	}
+}
+
+func TestReadBackupLog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	logger := NewFileLogger(name, int64(50), 3, NewNullLogEventEmitter(), NewNullLocker())
+	writeTestLines(logger)
+	defer logger.Close()
+	// the lines 0-2 are in the backup 3, 3-5 in the compressed backup 2 and
+	// 6-8 in the backup 1
+	compressFile(t, name+".2")
+
+	tests := []struct {
+		index    int
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{1, 0, 17, "this is a test 6\n"},
+		{1, 34, 0, "this is a test 8\n"},
+		{2, 17, 17, "this is a test 4\n"},
+		{3, 0, 0, "this is a test 0\nthis is a test 1\nthis is a test 2\n"},
+		{3, 100, 0, ""},
+	}
+	for _, test := range tests {
+		if s, err := logger.ReadBackupLog(test.index, test.offset, test.length); err != nil || s != test.expected {
+			t.Errorf("Wrong log read from backup %d, offset %d, length %d: %q, err=%v", test.index, test.offset, test.length, s, err)
+		}
+	}
+	for _, index := range []int{0, 4} {
+		if _, err := logger.ReadBackupLog(index, 0, 0); err == nil || !strings.Contains(err.Error(), "BAD_ARGUMENTS") {
+			t.Errorf("The backup index %d should be rejected, err=%v", index, err)
+		}
+	}
+	os.Remove(name + ".3")
+	if _, err := logger.ReadBackupLog(3, 0, 0); err == nil || !strings.Contains(err.Error(), "NO_FILE") {
+		t.Errorf("The missing backup should be NO_FILE, err=%v", err)
+	}
+}
+
+func TestSysLogger(t *testing.T) {
+	logger, ok := NewLogger("test", "syslog", NewNullLocker(), 0, 0, NewNullLogEventEmitter()).(*SysLogger)
+	if !ok {
+		t.Fatal("The syslog logger should be created")
+	}
+	defer logger.Close()
+	if _, err := logger.ReadLog(0, 0); err == nil {
+		t.Error("The syslog can't be read")
+	}
+}
+
+func TestLogCaptureLogger(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "test.log")
+	logger := NewLogCaptureLogger(NewFileLogger(logFile, 0, 0, NewNullLogEventEmitter(), NewNullLocker()),
+		1024,
+		"PROCESS_COMMUNICATION_STDOUT",
+		"test",
+		"test")
+	logger.Write([]byte("line 1\n<!--XSUPERVISOR:BEGIN-->captured"))
+	logger.Write([]byte(" data<!--XSUPERVISOR:END-->line 2\n"))
+	logger.Close()
+	// the data in capture mode is not logged
+	if b, _ := ioutil.ReadFile(logFile); string(b) != "line 1\nline 2\n" {
+		t.Errorf("Wrong log: %q", string(b))
+	}
+}
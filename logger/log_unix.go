@@ -10,9 +10,10 @@ import (
 	"strings"
 )
 
-// create a local syslog
+// create a local syslog, the log is tagged with the program name in the
+// user-level facility
 func NewSysLogger(name string, logEventEmitter LogEventEmitter) *SysLogger {
-	writer, err := syslog.New(syslog.LOG_DEBUG, name)
+	writer, err := syslog.New(syslog.LOG_USER|syslog.LOG_INFO, name)
 	logger := &SysLogger{logEventEmitter: logEventEmitter}
 	if err == nil {
 		logger.logWriter = writer
@@ -2,8 +2,24 @@
 
 package logger
 
+import (
+	"errors"
+)
+
+// syslog is not supported, writing to it always fails
+type unsupportedSysLogWriter struct {
+}
+
+func (w *unsupportedSysLogWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("syslog is not supported in this platform")
+}
+
+func (w *unsupportedSysLogWriter) Close() error {
+	return nil
+}
+
 func NewSysLogger(name string, logEventEmitter LogEventEmitter) *SysLogger {
-	return &SysLogger{logEventEmitter: logEventEmitter, logWriter: nil}
+	return &SysLogger{logEventEmitter: logEventEmitter, logWriter: &unsupportedSysLogWriter{}}
 }
 
 func NewRemoteSysLogger(name string, config string, logEventEmitter LogEventEmitter) *SysLogger {
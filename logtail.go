@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/csxuejin/supervisord/logger"
+	"github.com/csxuejin/supervisord/process"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// the interval to poll the new log of the process
+var logtailPollInterval = 200 * time.Millisecond
+
+// the max bytes of log not sent to a slow client, the older log is dropped
+const logtailMaxBacklog = 64 * 1024
+
+// the time to wait for a slow client to receive a message
+const logtailWriteTimeout = 10 * time.Second
+
+// LogtailMessage is a message sent on the "/logtail/{name}" websocket, the
+// Dropped is the number of bytes dropped before Data because the client is
+// too slow to receive them
+type LogtailMessage struct {
+	Channel string `json:"channel"`
+	Data    string `json:"data"`
+	Dropped int64  `json:"dropped"`
+}
+
+// logtailHandler streams the new stdout and stderr log of a process on the
+// websocket "/logtail/{name}", the log written before connecting is not sent
+type logtailHandler struct {
+	supervisor *Supervisor
+	upgrader   websocket.Upgrader
+}
+
+func NewLogtailHandler(supervisor *Supervisor) *logtailHandler {
+	return &logtailHandler{supervisor: supervisor}
+}
+
+// the tail position of stdout or stderr log
+type logTail struct {
+	channel   string
+	getLogger func() logger.Logger
+	offset    int64
+}
+
+// get the size of log, the offset beyond the log gets its size
+func (t *logTail) size() (int64, error) {
+	_, size, _, err := t.getLogger().ReadTailLog(math.MaxInt64, 0)
+	return size, err
+}
+
+// read the log written since last read, only the latest logtailMaxBacklog
+// bytes are read from the first complete line if there are more
+func (t *logTail) read() (*LogtailMessage, error) {
+	size, err := t.size()
+	if err != nil {
+		return nil, err
+	}
+	if size < t.offset {
+		//the log is rotated or cleared
+		t.offset = 0
+	}
+	if size == t.offset {
+		return nil, nil
+	}
+	msg := &LogtailMessage{Channel: t.channel}
+	if size-t.offset > logtailMaxBacklog {
+		msg.Dropped = size - logtailMaxBacklog - t.offset
+		t.offset = size - logtailMaxBacklog
+	}
+	data, offset, _, err := t.getLogger().ReadTailLog(t.offset, size-t.offset)
+	if err != nil {
+		return nil, err
+	}
+	t.offset = offset
+	if pos := strings.IndexByte(data, '\n'); msg.Dropped > 0 && pos >= 0 {
+		msg.Dropped += int64(pos + 1)
+		data = data[pos+1:]
+	}
+	msg.Data = data
+	return msg, nil
+}
+
+func (h *logtailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/logtail/")
+	proc := h.supervisor.procMgr.Find(name)
+	if proc == nil {
+		http.Error(w, "no such process "+name, http.StatusNotFound)
+		return
+	}
+	tails := make([]*logTail, 0)
+	for _, tail := range []*logTail{
+		{channel: "stdout", getLogger: func() logger.Logger { return proc.StdoutLog }},
+		{channel: "stderr", getLogger: func() logger.Logger { return proc.StderrLog }},
+	} {
+		//the log not written to a file can't be tailed
+		if size, err := tail.size(); err == nil {
+			tail.offset = size
+			tails = append(tails, tail)
+		}
+	}
+	if len(tails) == 0 {
+		http.Error(w, "no log file of process "+name, http.StatusNotFound)
+		return
+	}
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		//the error is replied by the upgrader
+		return
+	}
+	defer conn.Close()
+	log.WithFields(log.Fields{"program": name, "remote": r.RemoteAddr}).Debug("start to stream log")
+	h.streamLog(conn, proc, tails)
+}
+
+// send the new log until the client closes the connection
+func (h *logtailHandler) streamLog(conn *websocket.Conn, proc *process.Process, tails []*logTail) {
+	closed := make(chan struct{})
+	go func() {
+		//the messages from client are discarded, an error means it is closed
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(logtailPollInterval)
+	defer ticker.Stop()
+	for {
+		for _, tail := range tails {
+			msg, err := tail.read()
+			if err != nil || msg == nil {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(logtailWriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
+				log.WithFields(log.Fields{"program": proc.GetName()}).Debug("fail to send log: ", err)
+				return
+			}
+		}
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+	}
+}
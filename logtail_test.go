@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csxuejin/supervisord/logger"
+	"github.com/gorilla/websocket"
+)
+
+func TestLogtail(t *testing.T) {
+	logtailPollInterval = 10 * time.Millisecond
+	defer func() { logtailPollInterval = 200 * time.Millisecond }()
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	triggerFile := filepath.Join(dir, "trigger")
+	// the program writes the lines after the websocket is connected
+	s := createTestSupervisor(t, dir, fmt.Sprintf(`[program:test]
+command=/bin/sh -c "echo old; while [ ! -f %s ]; do sleep 0.05; done; echo new line; echo error line >&2; sleep 60"
+startsecs=0
+stdout_logfile=%s
+stderr_logfile=%s
+`, triggerFile, filepath.Join(dir, "stdout.log"), filepath.Join(dir, "stderr.log")))
+	defer s.procMgr.StopAllProcesses()
+	proc := s.procMgr.Find("test")
+	proc.Start(true)
+	time.Sleep(200 * time.Millisecond)
+
+	server := httptest.NewServer(NewLogtailHandler(s))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/logtail/test"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ioutil.WriteFile(triggerFile, nil, os.ModePerm)
+
+	received := make(map[string]string)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for received["stdout"] == "" || received["stderr"] == "" {
+		var msg LogtailMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Fail to receive log, received=%v, err=%v", received, err)
+		}
+		received[msg.Channel] += msg.Data
+	}
+	if received["stdout"] != "new line\n" || received["stderr"] != "error line\n" {
+		t.Errorf("Only the new log should be streamed: %v", received)
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(strings.TrimSuffix(url, "test")+"nonexistent", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("The unknown process should be rejected, err=%v", err)
+	}
+}
+
+func TestLogtailDropsBacklog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "test.log")
+	fileLogger := logger.NewFileLogger(logFile, 0, 0, logger.NewNullLogEventEmitter(), logger.NewNullLocker())
+	defer fileLogger.Close()
+	tail := &logTail{channel: "stdout", getLogger: func() logger.Logger { return fileLogger }}
+
+	line := strings.Repeat("x", 99) + "\n"
+	fileLogger.Write([]byte(strings.Repeat(line, 1000)))
+	msg, err := tail.read()
+	if err != nil || msg == nil {
+		t.Fatalf("Fail to read the log, err=%v", err)
+	}
+	// only the latest complete lines are kept
+	if len(msg.Data) > logtailMaxBacklog || !strings.HasPrefix(msg.Data, "x") || msg.Dropped+int64(len(msg.Data)) != 100000 {
+		t.Errorf("Wrong dropped log, dropped=%d, data length=%d", msg.Dropped, len(msg.Data))
+	}
+	if msg, err := tail.read(); err != nil || msg != nil {
+		t.Errorf("No new log should be read, msg=%v, err=%v", msg, err)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"syscall"
 	"unicode"
 
+	"github.com/csxuejin/supervisord/types"
 	"github.com/jessevdk/go-flags"
 	log "github.com/sirupsen/logrus"
 )
@@ -18,28 +19,50 @@ type Options struct {
 	Configuration string `short:"c" long:"configuration" description:"the configuration file" default:"supervisord.conf"`
 	Daemon        bool   `short:"d" long:"daemon" description:"run as daemon"`
 	EnvFile       string `long:"env-file" description:"the environment file"`
+	ConfigTest    bool   `long:"configtest" description:"validate the configuration and exit"`
+	LogFormat     string `long:"log-format" description:"the format of supervisord log" choice:"text" choice:"json" default:"text"`
 }
 
 func init() {
 	log.SetOutput(os.Stdout)
-	if runtime.GOOS == "windows" {
-		log.SetFormatter(&log.TextFormatter{DisableColors: true, FullTimestamp: true})
-	} else {
-		log.SetFormatter(&log.TextFormatter{DisableColors: false, FullTimestamp: true})
-	}
+	log.SetFormatter(newLogFormatter(runtime.GOOS != "windows"))
 	log.SetLevel(log.DebugLevel)
 }
 
-func initSignals(s *Supervisor) {
+// get the formatter of supervisord log by the --log-format option. Each line
+// of the json log is an object with the timestamp, level and message and the
+// fields of the log like program and pid
+func newLogFormatter(colors bool) log.Formatter {
+	if options.LogFormat == "json" {
+		return &log.JSONFormatter{FieldMap: log.FieldMap{
+			log.FieldKeyTime: "timestamp",
+			log.FieldKeyMsg:  "message",
+		}}
+	}
+	return &log.TextFormatter{DisableColors: !colors, FullTimestamp: true}
+}
+
+// handle the signals of supervisord, SIGHUP reloads the configuration and
+// SIGINT/SIGTERM stop all the processes and exit. The returned function stops
+// handling the signals
+func initSignals(s *Supervisor) func() {
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		sig := <-sigs
-		log.WithFields(log.Fields{"signal": sig}).Info("receive a signal to stop all process & exit")
-		s.procMgr.StopAllProcesses()
-		os.Exit(-1)
+		for sig := range sigs {
+			if sig == syscall.SIGHUP {
+				log.WithFields(log.Fields{"signal": sig}).Info("receive a signal to reload the configuration")
+				s.ReloadConfig(nil, &struct{}{}, &types.ReloadConfigResult{})
+				continue
+			}
+			log.WithFields(log.Fields{"signal": sig}).Info("receive a signal to stop all process & exit")
+			s.ShutdownAndExit(0)
+		}
 	}()
-
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
 }
 
 var options Options
@@ -90,11 +113,12 @@ func RunServer() {
 	LoadEnvFile()
 	for true {
 		s := NewSupervisor(options.Configuration)
-		initSignals(s)
-		if sErr, _, _, _ := s.Reload(); sErr != nil {
+		stopSignals := initSignals(s)
+		if _, sErr := s.Reload(); sErr != nil {
 			panic(sErr)
 		}
 		s.WaitForExit()
+		stopSignals()
 	}
 }
 
@@ -107,7 +131,10 @@ func main() {
 				fmt.Fprintln(os.Stdout, err)
 				os.Exit(0)
 			case flags.ErrCommandRequired:
-				if options.Daemon {
+				log.SetFormatter(newLogFormatter(runtime.GOOS != "windows"))
+				if options.ConfigTest {
+					validateCommand.Execute(nil)
+				} else if options.Daemon {
 					Deamonize(RunServer)
 				} else {
 					RunServer()
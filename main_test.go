@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestJSONLogFormat(t *testing.T) {
+	options.LogFormat = "json"
+	defer func() { options.LogFormat = "text" }()
+	buf := &bytes.Buffer{}
+	logger := log.New()
+	logger.SetOutput(buf)
+	logger.SetFormatter(newLogFormatter(false))
+	logger.WithFields(log.Fields{"program": "test", "pid": 100}).Info("success to start program")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("The log is not json: %s", buf.String())
+	}
+	if line["timestamp"] == nil || line["level"] != "info" || line["program"] != "test" || line["pid"] != 100.0 || line["message"] != "success to start program" {
+		t.Errorf("Wrong json log: %s", buf.String())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/csxuejin/supervisord/process"
+)
+
+// MetricsHandler exports the status of the processes in the prometheus text
+// format
+type MetricsHandler struct {
+	supervisor *Supervisor
+}
+
+func NewMetricsHandler(supervisor *Supervisor) *MetricsHandler {
+	return &MetricsHandler{supervisor: supervisor}
+}
+
+// one sample of a metric
+type metricSample struct {
+	labels string
+	value  float64
+}
+
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+// escape the label value in the prometheus text format
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func (m *MetricsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(m.collect())
+}
+
+// collect the metrics of all the processes
+func (m *MetricsHandler) collect() []byte {
+	procs := make([]*process.Process, 0)
+	m.supervisor.procMgr.ForEachProcess(func(proc *process.Process) {
+		procs = append(procs, proc)
+	})
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].GetName() < procs[j].GetName()
+	})
+
+	state := metric{name: "supervisord_process_state", typ: "gauge",
+		help: "The state of the process, 0 STOPPED, 10 STARTING, 20 RUNNING, 30 BACKOFF, 40 STOPPING, 100 EXITED, 200 FATAL, 1000 UNKNOWN"}
+	uptime := metric{name: "supervisord_process_uptime_seconds", typ: "gauge",
+		help: "The seconds since the process is started, 0 if it is not running"}
+	restarts := metric{name: "supervisord_process_restarts_total", typ: "counter",
+		help: "How many times the process is restarted"}
+	cpu := metric{name: "supervisord_process_cpu_seconds_total", typ: "counter",
+		help: "The user and system cpu time of the running process in seconds"}
+	rss := metric{name: "supervisord_process_resident_memory_bytes", typ: "gauge",
+		help: "The resident memory of the running process in bytes"}
+	for _, proc := range procs {
+		labels := fmt.Sprintf(`name="%s",group="%s"`, escapeLabelValue(proc.GetName()), escapeLabelValue(proc.GetGroup()))
+		procState := proc.GetState()
+		state.samples = append(state.samples, metricSample{labels, float64(procState)})
+		upSeconds := 0.0
+		if procState == process.RUNNING {
+			upSeconds = time.Now().Sub(proc.GetStartTime()).Seconds()
+		}
+		uptime.samples = append(uptime.samples, metricSample{labels, upSeconds})
+		restarts.samples = append(restarts.samples, metricSample{labels, float64(proc.GetRestartCount())})
+		if cpuSeconds, rssBytes, err := proc.GetResourceUsage(); err == nil {
+			cpu.samples = append(cpu.samples, metricSample{labels, cpuSeconds})
+			rss.samples = append(rss.samples, metricSample{labels, float64(rssBytes)})
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for _, metric := range []metric{state, uptime, restarts, cpu, rss} {
+		if len(metric.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", metric.name, metric.typ)
+		for _, sample := range metric.samples {
+			fmt.Fprintf(buf, "%s{%s} %g\n", metric.name, sample.labels, sample.value)
+		}
+	}
+	return buf.Bytes()
+}
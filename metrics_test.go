@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:test]\ncommand=/bin/sleep 60\nstartsecs=0\nautostart=false\n\n[program:idle]\ncommand=/bin/sleep 60\nautostart=false\n")
+	proc := s.procMgr.Find("test")
+	proc.Start(true)
+	defer proc.Stop(true)
+	proc.Stop(true)
+	proc.Start(true)
+	time.Sleep(100 * time.Millisecond)
+
+	w := httptest.NewRecorder()
+	NewMetricsHandler(s).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	expected := []string{
+		"# TYPE supervisord_process_state gauge\n",
+		`supervisord_process_state{name="test",group="test"} 20` + "\n",
+		`supervisord_process_state{name="idle",group="idle"} 0` + "\n",
+		`supervisord_process_restarts_total{name="test",group="test"} 1` + "\n",
+		`supervisord_process_uptime_seconds{name="idle",group="idle"} 0` + "\n",
+	}
+	if runtime.GOOS == "linux" {
+		expected = append(expected, `supervisord_process_resident_memory_bytes{name="test",group="test"} `)
+	}
+	for _, s := range expected {
+		if !strings.Contains(body, s) {
+			t.Errorf("%q is not found in the metrics:\n%s", s, body)
+		}
+	}
+	if strings.Contains(body, `supervisord_process_cpu_seconds_total{name="idle"`) {
+		t.Error("The cpu time of the stopped process should not be exported")
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if escapeLabelValue("a\"b\\c\nd") != `a\"b\\c\nd` {
+		t.Error("Fail to escape the label value")
+	}
+}
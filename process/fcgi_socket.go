@@ -0,0 +1,72 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/csxuejin/supervisord/config"
+)
+
+// fcgiSocket is the listening socket of a fcgi-program, it is created by
+// supervisord and shared by all the processes of the program
+type fcgiSocket struct {
+	listener net.Listener
+	//the socket passed to the processes as their stdin
+	file *os.File
+	//the processes using the socket
+	users map[string]bool
+}
+
+// create the listening socket from "tcp://host:port" or "unix:///path"
+func newFcgiSocket(entry *config.ConfigEntry) (*fcgiSocket, error) {
+	socket := entry.GetStringExpression("socket", "")
+	var listener net.Listener
+	var err error
+	if strings.HasPrefix(socket, "tcp://") {
+		listener, err = net.Listen("tcp", socket[len("tcp://"):])
+	} else if strings.HasPrefix(socket, "unix://") {
+		path := socket[len("unix://"):]
+		//remove the socket file left by the previous supervisord
+		os.Remove(path)
+		listener, err = net.Listen("unix", path)
+		if err == nil && entry.HasParameter("socket_mode") {
+			err = chmodSocket(path, entry.GetString("socket_mode", ""))
+		}
+	} else {
+		return nil, fmt.Errorf("invalid socket %s, it should be tcp://host:port or unix:///path", socket)
+	}
+	if err != nil {
+		if listener != nil {
+			listener.Close()
+		}
+		return nil, err
+	}
+	var file *os.File
+	switch l := listener.(type) {
+	case *net.TCPListener:
+		file, err = l.File()
+	case *net.UnixListener:
+		file, err = l.File()
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &fcgiSocket{listener: listener, file: file, users: make(map[string]bool)}, nil
+}
+
+func chmodSocket(path string, mode string) error {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid socket_mode %s", mode)
+	}
+	return os.Chmod(path, os.FileMode(m))
+}
+
+func (s *fcgiSocket) close() {
+	s.file.Close()
+	s.listener.Close()
+}
@@ -0,0 +1,105 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the health of a program which has healthcheck_url
+const (
+	HEALTH_UNKNOWN   = "UNKNOWN"
+	HEALTH_HEALTHY   = "HEALTHY"
+	HEALTH_UNHEALTHY = "UNHEALTHY"
+)
+
+// probe the health check url. The http or https url is healthy if its status
+// code is less than 400 and the tcp://host:port is healthy if it can be
+// connected
+func probe(url string, timeout time.Duration) error {
+	if strings.HasPrefix(url, "tcp://") {
+		conn, err := net.DialTimeout("tcp", url[len("tcp://"):], timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("unsupported health check url %s", url)
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returns status %s", resp.Status)
+	}
+	return nil
+}
+
+// get the health of the program, empty if no healthcheck_url
+func (p *Process) GetHealth() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.health
+}
+
+func (p *Process) hasHealthCheck() bool {
+	return p.config.GetString("healthcheck_url", "") != ""
+}
+
+// check the health of the program every healthcheck_interval seconds until
+// done is closed. The program is UNHEALTHY after healthcheck_retries
+// successive failures and it is restarted if healthcheck_autorestart is true
+func (p *Process) checkHealth(done <-chan struct{}) {
+	url := p.config.GetString("healthcheck_url", "")
+	interval := time.Duration(p.config.GetInt("healthcheck_interval", 10)) * time.Second
+	timeout := time.Duration(p.config.GetInt("healthcheck_timeout", 5)) * time.Second
+	retries := p.config.GetInt("healthcheck_retries", 3)
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if p.GetState() != RUNNING {
+			continue
+		}
+		err := probe(url, timeout)
+		p.lock.Lock()
+		if err == nil {
+			failures = 0
+			p.health = HEALTH_HEALTHY
+		} else {
+			failures++
+			log.WithFields(log.Fields{"program": p.GetName(), "url": url, "failures": failures}).Warnf("fail to check the health of program:%v", err)
+			if failures >= retries {
+				p.health = HEALTH_UNHEALTHY
+			}
+		}
+		p.lock.Unlock()
+		if failures >= retries && p.config.GetBool("healthcheck_autorestart", false) {
+			log.WithFields(log.Fields{"program": p.GetName()}).Warn("the program is unhealthy and will be restarted")
+			p.restartUnhealthy()
+			return
+		}
+	}
+}
+
+// stop the unhealthy program, it is started again after it exits
+func (p *Process) restartUnhealthy() {
+	p.forceRestart("the program is unhealthy")
+}
@@ -0,0 +1,73 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// get a tcp address on which nothing is listening
+func closedTCPAddr() string {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	if err := probe(server.URL+"/health", time.Second); err != nil {
+		t.Errorf("The http check should be passed, err=%v", err)
+	}
+	if probe(server.URL+"/other", time.Second) == nil {
+		t.Error("The http check with status 503 should be failed")
+	}
+	if err := probe("tcp://"+server.Listener.Addr().String(), time.Second); err != nil {
+		t.Errorf("The tcp check should be passed, err=%v", err)
+	}
+	if probe("tcp://"+closedTCPAddr(), time.Second) == nil {
+		t.Error("The tcp check of closed port should be failed")
+	}
+	if probe("udp://127.0.0.1:53", time.Second) == nil {
+		t.Error("The unsupported url should be failed")
+	}
+}
+
+func TestRestartUnhealthyProgram(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sleep 60
+startsecs=0
+autorestart=false
+healthcheck_url=tcp://%s
+healthcheck_interval=1
+healthcheck_timeout=1
+healthcheck_retries=2
+healthcheck_autorestart=true
+`, closedTCPAddr()))
+
+	proc.Start(false)
+	defer proc.Stop(true)
+	time.Sleep(200 * time.Millisecond)
+	pid := proc.GetPid()
+	if proc.GetHealth() != HEALTH_UNKNOWN {
+		t.Errorf("The health should be unknown before checking, health=%s", proc.GetHealth())
+	}
+	for i := 0; i < 50 && (proc.GetPid() == pid || proc.GetState() != RUNNING); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if proc.GetPid() == pid || proc.GetState() != RUNNING {
+		t.Errorf("The unhealthy program should be restarted, state=%v", proc.GetState())
+	}
+}
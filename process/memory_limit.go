@@ -0,0 +1,56 @@
+package process
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// the interval to check the memory of the program which has memory_limit
+var memoryCheckInterval = statsSampleInterval
+
+func (p *Process) hasMemoryLimit() bool {
+	return p.config.GetBytes("memory_limit", 0) > 0
+}
+
+// check the resident memory of the program until done is closed. The
+// program is restarted with its stop signals if the memory exceeds the
+// memory_limit for memory_limit_secs seconds, it is only supported in linux
+func (p *Process) checkMemory(done <-chan struct{}) {
+	limit := int64(p.config.GetBytes("memory_limit", 0))
+	duration := time.Duration(p.config.GetInt("memory_limit_secs", 30)) * time.Second
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+
+	var exceededSince time.Time
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		if p.GetState() != RUNNING {
+			exceededSince = time.Time{}
+			continue
+		}
+		stats, err := p.GetStats()
+		if err != nil {
+			continue
+		}
+		if stats.Rss <= limit {
+			exceededSince = time.Time{}
+			continue
+		}
+		if exceededSince.IsZero() {
+			exceededSince = stats.SampleTime
+			log.WithFields(log.Fields{"program": p.GetName(), "rss": stats.Rss, "memory_limit": limit}).Warn("the memory of program exceeds the memory_limit")
+		}
+		if stats.SampleTime.Sub(exceededSince) >= duration {
+			reason := fmt.Sprintf("the memory %d bytes exceeds the memory_limit %d bytes for %v", stats.Rss, limit, duration)
+			log.WithFields(log.Fields{"program": p.GetName()}).Warn(reason, ", the program will be restarted")
+			p.forceRestart(reason)
+			return
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRestartProgramExceedingMemoryLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the memory usage is only supported in linux")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sleep 60
+startsecs=0
+autorestart=false
+memory_limit=1KB
+memory_limit_secs=1
+`)
+	proc.Start(false)
+	defer proc.Stop(true)
+	time.Sleep(200 * time.Millisecond)
+	pid := proc.GetPid()
+	if proc.GetRestartReason() != "" {
+		t.Errorf("No restart reason before the program is restarted, reason=%s", proc.GetRestartReason())
+	}
+	for i := 0; i < 50 && (proc.GetPid() == pid || proc.GetState() != RUNNING); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if proc.GetPid() == pid || proc.GetState() != RUNNING {
+		t.Errorf("The program exceeding the memory limit should be restarted, state=%v", proc.GetState())
+	}
+	if !strings.Contains(proc.GetRestartReason(), "memory_limit") {
+		t.Errorf("Wrong restart reason %s", proc.GetRestartReason())
+	}
+}
+
+func TestNotRestartProgramInMemoryLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the memory usage is only supported in linux")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sleep 60
+startsecs=0
+memory_limit=1GB
+memory_limit_secs=0
+`)
+	proc.Start(false)
+	defer proc.Stop(true)
+	time.Sleep(200 * time.Millisecond)
+	pid := proc.GetPid()
+	time.Sleep(2 * time.Second)
+	if proc.GetPid() != pid || proc.GetRestartReason() != "" {
+		t.Errorf("The program in the memory limit should not be restarted, reason=%s", proc.GetRestartReason())
+	}
+}
@@ -0,0 +1,31 @@
+// +build !windows
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+//check if the process is running and it is started by the command. The
+//command line of the process is checked if the procfs is available, so the
+//pid reused by another program is not taken as the process
+func isCommandRunning(pid int, command string) bool {
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return true
+	}
+	//the command may be run by an interpreter like "/bin/sh script"
+	for _, arg := range strings.Split(string(b), "\x00") {
+		if arg != "" && filepath.Base(arg) == filepath.Base(command) {
+			return true
+		}
+	}
+	return false
+}
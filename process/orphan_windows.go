@@ -0,0 +1,8 @@
+// +build windows
+
+package process
+
+//the process left by the last supervisord is not monitored on windows
+func isCommandRunning(_ int, _ string) bool {
+	return false
+}
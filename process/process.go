@@ -3,6 +3,8 @@ package process
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"os"
 	"os/exec"
 	"os/user"
@@ -53,6 +55,12 @@ func (p ProcessState) String() string {
 	}
 }
 
+//the time to wait for the exit of a program after sending SIGKILL to it
+const killWaitTime = 5 * time.Second
+
+//the interval to check if the process left by the last supervisord exits
+var orphanPollInterval = 500 * time.Millisecond
+
 type Process struct {
 	supervisor_id string
 	config        *config.ConfigEntry
@@ -65,10 +73,40 @@ type Process struct {
 	//true if the process is stopped by user
 	stopByUser bool
 	retryTimes int
-	lock       sync.RWMutex
-	stdin      io.WriteCloser
-	StdoutLog  logger.Logger
-	StderrLog  logger.Logger
+	//how many times the program is spawned
+	startCount int
+	//how many times the program is restarted automatically since it is
+	//RUNNING last time
+	restarts int
+	//how many times the program exits quickly in a row, it is reset after
+	//the program stays up longer than startsecs
+	failures int
+	//the delay before starting the program again in BACKOFF
+	backoffDelay time.Duration
+	//the exit status of the last run, -1 if it is never exited
+	lastExitStatus int
+	//the reason why the program can't be spawned
+	spawnErr string
+	//the health of the program checked by healthcheck_url
+	health string
+	//the readiness of the program and the watcher of its ready_regex
+	ready        string
+	readyWatcher *readyWatcher
+	//true if the program is stopped because it is unhealthy or exceeds its
+	//memory_limit and it should be started again
+	forcedRestart bool
+	//the reason of the last restart forced by the health check or the
+	//memory_limit
+	restartReason string
+	//the listening socket of fcgi-program, it is created by the manager
+	fcgiSocket *os.File
+	//the last sample of the resource usage
+	stats     ResourceStats
+	statsLock sync.Mutex
+	lock      sync.RWMutex
+	stdin     io.WriteCloser
+	StdoutLog logger.Logger
+	StderrLog logger.Logger
 }
 
 func NewProcess(supervisor_id string, config *config.ConfigEntry) *Process {
@@ -83,6 +121,7 @@ func NewProcess(supervisor_id string, config *config.ConfigEntry) *Process {
 		retryTimes: 0}
 	proc.config = config
 	proc.cmd = nil
+	proc.lastExitStatus = -1
 
 	//start the process if autostart is set to true
 	//if proc.isAutoStart() {
@@ -115,7 +154,12 @@ func (p *Process) Start(wait bool) {
 	go func() {
 		p.retryTimes = 0
 
-		for {
+		for runs := 0; ; runs++ {
+			if runs > 0 {
+				p.lock.Lock()
+				p.restarts++
+				p.lock.Unlock()
+			}
 			if wait {
 				runCond.L.Lock()
 			}
@@ -126,23 +170,67 @@ func (p *Process) Start(wait bool) {
 					runCond.Signal()
 				}
 			})
-			if (p.stopTime.Unix() - p.startTime.Unix()) < int64(p.getStartSeconds()) {
-				p.retryTimes++
-			} else {
-				p.retryTimes = 0
-			}
 			if p.stopByUser {
 				log.WithFields(log.Fields{"program": p.GetName()}).Info("Stopped by user, don't start it again")
 				break
 			}
-			if !p.isAutoRestart() {
-				log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because its autorestart flag is false")
+			state := p.GetState()
+			if state == FATAL {
 				break
 			}
-			if p.retryTimes >= p.getStartRetries() {
-				log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because its retry times ", p.retryTimes, " is greater than start retries ", p.getStartRetries())
+			p.countFailure()
+			//the program exits before startsecs, it is failed to start and
+			//is started again until it fails more than startretries times
+			if state == BACKOFF {
+				p.retryTimes++
+				if p.retryTimes > p.getStartRetries() {
+					log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because its retry times ", p.retryTimes, " is greater than start retries ", p.getStartRetries())
+					p.lock.Lock()
+					p.changeStateTo(FATAL)
+					p.lock.Unlock()
+					break
+				}
+				//wait one more second after each failure by default, the
+				//program stays in BACKOFF before it is started again
+				delay := time.Duration(p.retryTimes) * time.Second
+				if _, _, ok := p.getAutoRestartBackoff(); ok {
+					delay = p.getBackoffDelay()
+				}
+				if !p.waitBackoff(delay + p.getAutoRestartJitter()) {
+					break
+				}
+				continue
+			}
+			p.retryTimes = 0
+			p.lock.Lock()
+			forcedRestart := p.forcedRestart
+			p.forcedRestart = false
+			restartReason := p.restartReason
+			p.lock.Unlock()
+			if forcedRestart {
+				log.WithFields(log.Fields{"program": p.GetName(), "reason": restartReason}).Info("start the program again after it is restarted by supervisord")
+				continue
+			}
+			if !p.isAutoRestart() {
+				log.WithFields(log.Fields{"program": p.GetName()}).Info("Don't start the stopped program because its autorestart flag is false or its exit code is expected")
+				p.failUnexpectedExit()
 				break
 			}
+			//the program exiting quickly again and again is restarted
+			//after an increasing delay, the random jitter spreads the
+			//restarts of the programs exiting at the same time
+			if delay := p.getBackoffDelay() + p.getAutoRestartJitter(); delay > 0 {
+				p.lock.Lock()
+				if p.stopByUser {
+					p.lock.Unlock()
+					break
+				}
+				p.changeStateTo(BACKOFF)
+				p.lock.Unlock()
+				if !p.waitBackoff(delay) {
+					break
+				}
+			}
 		}
 		p.lock.Lock()
 		p.inStart = false
@@ -180,18 +268,68 @@ func (p *Process) GetDescription() string {
 			return fmt.Sprintf("pid %d, uptime %d days, %d:%02d:%02d", p.cmd.Process.Pid, days, hours%24, minutes%60, seconds%60)
 		}
 		return fmt.Sprintf("pid %d, uptime %d:%02d:%02d", p.cmd.Process.Pid, hours%24, minutes%60, seconds%60)
+	} else if p.state == FATAL && p.spawnErr != "" {
+		return p.spawnErr
 	} else if p.state != STOPPED {
 		return p.stopTime.String()
 	}
 	return ""
 }
 
+// Get how many times the program is restarted after its first start
+func (p *Process) GetRestartCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.startCount <= 1 {
+		return 0
+	}
+	return p.startCount - 1
+}
+
+// Get the cpu time in seconds and the resident memory in bytes used by the
+// running program
+func (p *Process) GetResourceUsage() (float64, int64, error) {
+	pid := p.GetPid()
+	if pid == 0 {
+		return 0, 0, fmt.Errorf("the program is not running")
+	}
+	return getResourceUsage(pid)
+}
+
+// Get the reason of the last restart forced by the health check or the
+// memory_limit, empty if the program is never restarted by them
+func (p *Process) GetRestartReason() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.restartReason
+}
+
+// stop the running program for the reason and start it again after it exits
+func (p *Process) forceRestart(reason string) {
+	p.lock.Lock()
+	if p.state != RUNNING || p.stopByUser {
+		p.lock.Unlock()
+		return
+	}
+	p.forcedRestart = true
+	p.restartReason = reason
+	p.lock.Unlock()
+	p.stop(p.getStopSignals(), false)
+}
+
+// Get the reason why the program can't be spawned
+func (p *Process) GetSpawnErr() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.spawnErr
+}
+
 func (p *Process) GetExitstatus() int {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	if p.state == EXITED || p.state == BACKOFF {
-		if p.cmd.ProcessState == nil {
+	if p.state == EXITED || p.state == BACKOFF || p.state == FATAL {
+		if p.cmd == nil || p.cmd.ProcessState == nil {
 			return 0
 		}
 		status, ok := p.cmd.ProcessState.Sys().(syscall.WaitStatus)
@@ -202,6 +340,21 @@ func (p *Process) GetExitstatus() int {
 	return 0
 }
 
+// Get how many times the program is restarted automatically since it is
+// RUNNING after startsecs last time
+func (p *Process) GetRestarts() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.restarts
+}
+
+// Get the exit status of the last run of the program, -1 if it never exits
+func (p *Process) GetLastExitStatus() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.lastExitStatus
+}
+
 func (p *Process) GetPid() int {
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -243,7 +396,11 @@ func (p *Process) GetStdoutLogfile() string {
 	return expand_file
 }
 
+// Get the stderr log file, it is empty if the stderr is redirected to stdout
 func (p *Process) GetStderrLogfile() string {
+	if p.IsRedirectStderr() {
+		return ""
+	}
 	file_name := p.config.GetStringExpression("stderr_logfile", "/dev/null")
 	expand_file, err := Path_expand(file_name)
 	if err != nil {
@@ -252,10 +409,164 @@ func (p *Process) GetStderrLogfile() string {
 	return expand_file
 }
 
+// LogInfo is the configuration of the stdout or stderr log of a program
+type LogInfo struct {
+	Logfile  string
+	MaxBytes int64
+	Backups  int
+	//the process communication is captured from the output
+	CaptureEnabled bool
+	//the PROCESS_LOG events are emitted, it is disabled by capturing
+	EventsEnabled bool
+}
+
+// Get the configuration of the stdout log
+func (p *Process) GetStdoutLogInfo() LogInfo {
+	return p.getLogInfo("stdout", p.GetStdoutLogfile())
+}
+
+// Get the configuration of the stderr log, it is empty if the stderr is
+// redirected to stdout
+func (p *Process) GetStderrLogInfo() LogInfo {
+	if p.IsRedirectStderr() {
+		return LogInfo{}
+	}
+	return p.getLogInfo("stderr", p.GetStderrLogfile())
+}
+
+func (p *Process) getLogInfo(stdType string, logfile string) LogInfo {
+	captureEnabled := p.config.GetBytes(stdType+"_capture_maxbytes", 0) > 0
+	return LogInfo{Logfile: logfile,
+		MaxBytes:       int64(p.config.GetBytes(stdType+"_logfile_maxbytes", 50*1024*1024)),
+		Backups:        p.config.GetInt(stdType+"_logfile_backups", 10),
+		CaptureEnabled: captureEnabled,
+		EventsEnabled:  !captureEnabled && p.config.GetBool(stdType+"_events_enabled", false)}
+}
+
+//check if the stderr of program is merged into its stdout
+func (p *Process) IsRedirectStderr() bool {
+	return p.config.IsProgram() && p.config.GetBool("redirect_stderr", false)
+}
+
+func (p *Process) getPriority() int {
+	return p.config.GetInt("priority", 999)
+}
+
+//the stop signals are sent one by one until the program exits
+func (p *Process) getStopSignals() []string {
+	return strings.Fields(p.config.GetString("stopsignal", "TERM"))
+}
+
 func (p *Process) getStartSeconds() int {
 	return p.config.GetInt("startsecs", 1)
 }
 
+// get the base and the cap of the exponential delay between the automatic
+// restarts from "autorestart_backoff=base,cap" in seconds, the cap is 60
+// seconds if it is not set
+func (p *Process) getAutoRestartBackoff() (time.Duration, time.Duration, bool) {
+	fields := strings.Split(p.config.GetString("autorestart_backoff", ""), ",")
+	base, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	if err != nil || base <= 0 {
+		return 0, 0, false
+	}
+	maxDelay := 60.0
+	if len(fields) > 1 {
+		if maxDelay, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64); err != nil || maxDelay < base {
+			maxDelay = base
+		}
+	}
+	return time.Duration(base * float64(time.Second)), time.Duration(maxDelay * float64(time.Second)), true
+}
+
+// count the failure if the program exits before it stays up longer than
+// startsecs (at least one second), otherwise the failures are reset
+func (p *Process) countFailure() {
+	minUptime := time.Duration(p.getStartSeconds()) * time.Second
+	if minUptime < time.Second {
+		minUptime = time.Second
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopTime.Sub(p.startTime) < minUptime {
+		p.failures++
+	} else {
+		p.failures = 0
+	}
+}
+
+// get the delay before restarting the program after the failures in a row,
+// it is doubled after each failure from the base of autorestart_backoff up
+// to its cap. 0 is returned if no failure or autorestart_backoff is not set
+func (p *Process) getBackoffDelay() time.Duration {
+	base, maxDelay, ok := p.getAutoRestartBackoff()
+	p.lock.RLock()
+	failures := p.failures
+	p.lock.RUnlock()
+	if !ok || failures <= 0 {
+		return 0
+	}
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// get a random delay up to "autorestart_jitter" seconds which is added
+// to the delay before restarting the program, 0 if it is not set
+func (p *Process) getAutoRestartJitter() time.Duration {
+	jitter, err := strconv.ParseFloat(p.config.GetString("autorestart_jitter", "0"), 64)
+	if err != nil || jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter*float64(time.Second)) + 1))
+}
+
+// wait in BACKOFF before starting the program again, false is returned if
+// the program is stopped by user during the wait
+func (p *Process) waitBackoff(delay time.Duration) bool {
+	p.lock.Lock()
+	p.backoffDelay = delay
+	p.lock.Unlock()
+	defer func() {
+		p.lock.Lock()
+		p.backoffDelay = 0
+		p.lock.Unlock()
+	}()
+	endTime := time.Now().Add(delay)
+	for {
+		p.lock.RLock()
+		stopByUser := p.stopByUser
+		p.lock.RUnlock()
+		if stopByUser {
+			return false
+		}
+		remaining := time.Until(endTime)
+		if remaining <= 0 {
+			return true
+		}
+		if remaining > 100*time.Millisecond {
+			remaining = 100 * time.Millisecond
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// Get the delay before the program in BACKOFF is started again, 0 if it is
+// not waiting to be started
+func (p *Process) GetBackoffDelay() time.Duration {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.state != BACKOFF {
+		return 0
+	}
+	return p.backoffDelay
+}
+
 func (p *Process) getStartRetries() int {
 	return p.config.GetInt("startretries", 3)
 }
@@ -303,6 +614,23 @@ func (p *Process) isAutoRestart() bool {
 
 }
 
+// a one-shot program with autorestart=false is FATAL if it exits with an
+// exit code not in the "exitcodes", it stays EXITED if the exit is expected
+func (p *Process) failUnexpectedExit() {
+	if p.config.GetString("autorestart", "unexpected") != "false" {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.state != EXITED || p.cmd == nil {
+		return
+	}
+	if exitCode, err := p.getExitCode(); err == nil && !p.inExitCodes(exitCode) {
+		p.spawnErr = fmt.Sprintf("exited with unexpected status %d", exitCode)
+		p.changeStateTo(FATAL)
+	}
+}
+
 func (p *Process) inExitCodes(exitCode int) bool {
 	for _, code := range p.getExitCodes() {
 		if code == exitCode {
@@ -328,7 +656,7 @@ func (p *Process) getExitCodes() []int {
 	strExitCodes := strings.Split(p.config.GetString("exitcodes", "0,2"), ",")
 	result := make([]int, 0)
 	for _, val := range strExitCodes {
-		i, err := strconv.Atoi(val)
+		i, err := strconv.Atoi(strings.TrimSpace(val))
 		if err == nil {
 			result = append(result, i)
 		}
@@ -336,15 +664,39 @@ func (p *Process) getExitCodes() []int {
 	return result
 }
 
+//get the umask of the program in octal, return -1 if it is not set
+func (p *Process) getUmask() (int, error) {
+	s := p.config.GetString("umask", "")
+	if s == "" {
+		return -1, nil
+	}
+	umask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return -1, fmt.Errorf("invalid umask %s", s)
+	}
+	return int(umask), nil
+}
+
+//the program can't be spawned, it is FATAL with the reason.
+//
+//The lock must be held by the caller
+func (p *Process) failToSpawn(reason string) {
+	log.WithFields(log.Fields{"program": p.GetName()}).Error(reason)
+	p.spawnErr = reason
+	p.stopTime = time.Now()
+	p.changeStateTo(FATAL)
+}
+
 func (p *Process) run(finishCb func()) {
 	args, err := parseCommand(p.config.GetStringExpression("command", ""))
 
+	p.lock.Lock()
 	if err != nil {
-		log.Error("the command is empty string")
+		p.failToSpawn("the command is empty string")
+		p.lock.Unlock()
 		finishCb()
 		return
 	}
-	p.lock.Lock()
 	if p.cmd != nil && p.cmd.ProcessState != nil {
 		status := p.cmd.ProcessState.Sys().(syscall.WaitStatus)
 		if status.Continued() {
@@ -354,76 +706,286 @@ func (p *Process) run(finishCb func()) {
 			return
 		}
 	}
+	orphanPid := p.findOrphan(args[0])
 	p.cmd = exec.Command(args[0])
 	if len(args) > 1 {
 		p.cmd.Args = args
 	}
 	p.cmd.SysProcAttr = &syscall.SysProcAttr{}
-	if p.setUser() != nil {
-		log.WithFields(log.Fields{"user": p.config.GetString("user", "")}).Error("fail to run as user")
+	if err = p.setUser(); err != nil {
+		p.failToSpawn(fmt.Sprintf("fail to run as user %s: %v", p.config.GetString("user", ""), err))
 		p.lock.Unlock()
 		finishCb()
 		return
 	}
+	//the program runs in its own process group, so signaling the group
+	//doesn't reach supervisord
 	set_deathsig(p.cmd.SysProcAttr)
-	p.setEnv()
-	p.setDir()
+	if err = p.setEnv(); err != nil {
+		p.failToSpawn(err.Error())
+		p.lock.Unlock()
+		finishCb()
+		return
+	}
+	if err = p.setDir(); err != nil {
+		p.failToSpawn(err.Error())
+		p.lock.Unlock()
+		finishCb()
+		return
+	}
+	umask, err := p.getUmask()
+	if err != nil {
+		p.failToSpawn(err.Error())
+		p.lock.Unlock()
+		finishCb()
+		return
+	}
+	nofile, err := p.getNofile()
+	if err != nil {
+		p.failToSpawn(err.Error())
+		p.lock.Unlock()
+		finishCb()
+		return
+	}
+	readyRegex, err := p.getReadyRegex()
+	if err != nil {
+		p.failToSpawn(err.Error())
+		p.lock.Unlock()
+		finishCb()
+		return
+	}
+	//the output of the process left by the last supervisord is lost
+	p.readyWatcher = nil
+	if readyRegex != nil && orphanPid <= 0 {
+		p.readyWatcher = newReadyWatcher(readyRegex)
+	}
 	p.setLog()
 
-	p.stdin, _ = p.cmd.StdinPipe()
+	if p.config.IsFcgiProgram() {
+		if p.fcgiSocket == nil {
+			p.failToSpawn("the socket of fcgi-program is not created")
+			p.lock.Unlock()
+			finishCb()
+			return
+		}
+		//the fastcgi program accepts the connections from its stdin
+		p.cmd.Stdin = p.fcgiSocket
+	} else if orphanPid > 0 {
+		//the stdin of the process left by the last supervisord is lost
+		p.stdin = nil
+	} else {
+		p.stdin, _ = p.cmd.StdinPipe()
+	}
 	p.startTime = time.Now()
 	p.changeStateTo(STARTING)
-	err = p.cmd.Start()
+	wait := p.cmd.Wait
+	if orphanPid > 0 {
+		//the process is not the child of this supervisord, so it is polled
+		//until it exits
+		log.WithFields(log.Fields{"program": p.GetName(), "pid": orphanPid}).Info("monitor the running process left by the last supervisord instead of starting a new one")
+		p.cmd.Process, err = os.FindProcess(orphanPid)
+		wait = func() error {
+			for isCommandRunning(orphanPid, args[0]) {
+				time.Sleep(orphanPollInterval)
+			}
+			return nil
+		}
+	} else {
+		err = startWithNofile(p.cmd, nofile, umask)
+	}
 	if err != nil {
-		log.WithFields(log.Fields{"program": p.GetName()}).Errorf("fail to start program with error:%v", err)
-		p.changeStateTo(FATAL)
-		p.stopTime = time.Now()
+		p.failToSpawn(fmt.Sprintf("fail to start program with error:%v", err))
 		p.lock.Unlock()
 		finishCb()
 	} else {
+		p.spawnErr = ""
+		p.startCount++
+		if p.hasHealthCheck() {
+			p.health = HEALTH_UNKNOWN
+		}
+		p.ready = ""
+		if p.readyWatcher != nil {
+			p.ready = READY_WAITING
+		}
+		watcher := p.readyWatcher
 		if p.StdoutLog != nil {
 			p.StdoutLog.SetPid(p.cmd.Process.Pid)
 		}
 		if p.StderrLog != nil {
 			p.StderrLog.SetPid(p.cmd.Process.Pid)
 		}
-		log.WithFields(log.Fields{"program": p.GetName()}).Info("success to start program")
-		startSecs := p.config.GetInt("startsecs", 1)
+		log.WithFields(log.Fields{"program": p.GetName(), "pid": p.cmd.Process.Pid}).Info("success to start program")
+		p.writePidFile()
+		cmd := p.cmd
+		p.lock.Unlock()
+
+		exited := make(chan error, 1)
+		go func() {
+			exited <- wait()
+		}()
+
+		//the program is RUNNING if it is still running after startsecs.
 		//Set startsec to 0 to indicate that the program needn't stay
 		//running for any particular amount of time.
-		if startSecs <= 0 {
+		startSecs := p.getStartSeconds()
+		if orphanPid > 0 {
+			startSecs = 0
+		}
+		var err error
+		waitExit := true
+		notReady := false
+		if watcher != nil {
+			//the program is RUNNING once it prints the ready_regex
+			readyTimeout := p.getReadyTimeout()
+			select {
+			case err = <-exited:
+				waitExit = false
+			case <-watcher.ready:
+				p.lock.Lock()
+				if p.state == STARTING {
+					p.ready = READY_READY
+					p.changeStateTo(RUNNING)
+					p.restarts = 0
+				}
+				p.lock.Unlock()
+			case <-time.After(readyTimeout):
+				p.lock.Lock()
+				if p.state == STARTING {
+					notReady = true
+					p.ready = READY_TIMEOUT
+					p.spawnErr = fmt.Sprintf("the program is not ready in %v", readyTimeout)
+				}
+				p.lock.Unlock()
+			}
+			if notReady {
+				log.WithFields(log.Fields{"program": p.GetName(), "ready_timeout": readyTimeout}).Warn("stop the program because the ready_regex is not found in its output")
+				p.stop(p.getStopSignals(), false)
+			}
+		} else if startSecs <= 0 {
+			p.lock.Lock()
 			p.changeStateTo(RUNNING)
-
+			p.restarts = 0
+			p.lock.Unlock()
 		} else {
-			time.Sleep(time.Duration(startSecs) * time.Second)
-			if tmpProc, err := os.FindProcess(p.cmd.Process.Pid); err == nil && tmpProc != nil {
-				p.changeStateTo(RUNNING)
+			select {
+			case err = <-exited:
+				waitExit = false
+			case <-time.After(time.Duration(startSecs) * time.Second):
+				p.lock.Lock()
+				if p.state == STARTING {
+					p.changeStateTo(RUNNING)
+					p.restarts = 0
+				}
+				p.lock.Unlock()
 			}
 		}
-		p.lock.Unlock()
-		log.WithFields(log.Fields{"program": p.GetName()}).Debug("wait program exit")
-		finishCb()
-		err = p.cmd.Wait()
+		//the caller waits until the program not ready is FATAL
+		if !notReady {
+			finishCb()
+		}
+		checkDone := make(chan struct{})
+		if p.hasHealthCheck() && waitExit {
+			go p.checkHealth(checkDone)
+		}
+		if p.hasMemoryLimit() && waitExit {
+			go p.checkMemory(checkDone)
+		}
+		if waitExit {
+			log.WithFields(log.Fields{"program": p.GetName()}).Debug("wait program exit")
+			err = <-exited
+		}
+		close(checkDone)
+		exitFields := log.Fields{"program": p.GetName(), "pid": cmd.Process.Pid}
+		if cmd.ProcessState != nil {
+			exitFields["exitstatus"] = cmd.ProcessState.ExitCode()
+		}
 		if err == nil {
-			if p.cmd.ProcessState != nil {
-				log.WithFields(log.Fields{"program": p.GetName()}).Infof("program stopped with status:%v", p.cmd.ProcessState)
+			if cmd.ProcessState != nil {
+				log.WithFields(exitFields).Infof("program stopped with status:%v", cmd.ProcessState)
 			} else {
-				log.WithFields(log.Fields{"program": p.GetName()}).Info("program stopped")
+				log.WithFields(exitFields).Info("program stopped")
 			}
 		} else {
-			log.WithFields(log.Fields{"program": p.GetName()}).Errorf("program stopped with error:%v", err)
+			log.WithFields(exitFields).Errorf("program stopped with error:%v", err)
 		}
 
+		//the events can't be sent to the exited event listener
+		if p.config.IsEventListener() {
+			p.unregisterEventListener(p.config.GetEventListenerName())
+		}
+
+		p.removePidFile()
 		p.lock.Lock()
 		p.stopTime = time.Now()
-		if p.stopTime.Unix()-p.startTime.Unix() < int64(startSecs) {
+		if cmd.ProcessState != nil {
+			if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok {
+				p.lastExitStatus = status.ExitStatus()
+			}
+		}
+		//the program exits before it is RUNNING, it is failed to start
+		if notReady {
+			p.changeStateTo(FATAL)
+		} else if p.state == STOPPING {
+			p.changeStateTo(STOPPED)
+		} else if p.state == STARTING {
 			p.changeStateTo(BACKOFF)
 		} else {
 			p.changeStateTo(EXITED)
 		}
 		p.lock.Unlock()
+		if notReady {
+			finishCb()
+		}
+	}
+
+}
+
+//get the "pidfile" of the program where the pid of the running process is
+//written, it is empty if not set
+func (p *Process) getPidFile() string {
+	pidfile := p.config.GetStringExpression("pidfile", "")
+	if pidfile == "" {
+		return ""
+	}
+	if expandFile, err := Path_expand(pidfile); err == nil {
+		return expandFile
+	}
+	return pidfile
+}
+
+func (p *Process) writePidFile() {
+	pidfile := p.getPidFile()
+	if pidfile == "" {
+		return
+	}
+	if err := ioutil.WriteFile(pidfile, []byte(fmt.Sprintf("%d\n", p.cmd.Process.Pid)), 0644); err != nil {
+		log.WithFields(log.Fields{"program": p.GetName(), "pidfile": pidfile}).Error("fail to write the pid file: ", err)
 	}
+}
 
+func (p *Process) removePidFile() {
+	if pidfile := p.getPidFile(); pidfile != "" {
+		os.Remove(pidfile)
+	}
+}
+
+//get the pid in the "pidfile" of the program if the process is still
+//running. It is the process left by the last supervisord which is killed
+//before stopping its programs, 0 if there is no such process
+func (p *Process) findOrphan(command string) int {
+	pidfile := p.getPidFile()
+	if pidfile == "" || p.config.IsFcgiProgram() || !p.config.IsProgram() {
+		return 0
+	}
+	b, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 || pid == os.Getpid() || !isCommandRunning(pid, command) {
+		return 0
+	}
+	return pid
 }
 
 func (p *Process) changeStateTo(procState ProcessState) {
@@ -453,48 +1015,151 @@ func (p *Process) changeStateTo(procState ProcessState) {
 			events.EmitEvent(events.CreateProcessUnknownEvent(progName, groupName, p.state.String()))
 		}
 	}
+	if p.state != procState {
+		fields := log.Fields{"program": p.GetName(), "from_state": p.state.String(), "to_state": procState.String()}
+		if p.cmd != nil && p.cmd.Process != nil {
+			fields["pid"] = p.cmd.Process.Pid
+		}
+		log.WithFields(fields).Info("program state changed")
+	}
 	p.state = procState
 }
 
-func (p *Process) Signal(sig os.Signal) error {
+//send signal to the program, the signal is also sent to the children of
+//the program if sigChildren is true
+func (p *Process) Signal(sig os.Signal, sigChildren bool) error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	return p.sendSignal(sig)
+	return p.sendSignal(sig, sigChildren)
 }
 
-func (p *Process) sendSignal(sig os.Signal) error {
+func (p *Process) sendSignal(sig os.Signal, sigChildren bool) error {
 	if p.cmd != nil && p.cmd.Process != nil {
-		err := signals.Kill(p.cmd.Process, sig)
+		err := signals.Kill(p.cmd.Process, sig, sigChildren)
 		return err
 	}
 	return fmt.Errorf("process is not started")
 }
 
-func (p *Process) setEnv() {
-	env := p.config.GetEnv("environment")
+// EffectiveConfig is the configuration the program is started with after
+// the expressions, the env_file and the user are resolved
+type EffectiveConfig struct {
+	Command string
+	Args    []string
+	//the working directory, it is the directory of supervisord if the
+	//"directory" is not set
+	Directory string
+	//the environment set by supervisord, the environment of the supervisord
+	//process is inherited as well
+	Environment []string
+	User        string
+	Uid         int
+	Gid         int
+	//the umask is -1 if it is inherited from supervisord
+	Umask int
+}
+
+// Get the configuration used to start the program, an error is returned if
+// the program can't be started with it
+func (p *Process) GetEffectiveConfig() (EffectiveConfig, error) {
+	command := p.config.GetStringExpression("command", "")
+	args, err := parseCommand(command)
+	if err != nil {
+		return EffectiveConfig{}, fmt.Errorf("the command is empty string")
+	}
+	env, err := p.getEnvironment()
+	if err != nil {
+		return EffectiveConfig{}, err
+	}
+	dir := p.config.GetStringExpression("directory", "")
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return EffectiveConfig{}, err
+		}
+	}
+	umask, err := p.getUmask()
+	if err != nil {
+		return EffectiveConfig{}, err
+	}
+	effective := EffectiveConfig{Command: command,
+		Args:        args,
+		Directory:   dir,
+		Environment: env,
+		User:        p.config.GetString("user", ""),
+		Uid:         os.Getuid(),
+		Gid:         os.Getgid(),
+		Umask:       umask}
+	if effective.User != "" {
+		uid, gid, _, err := p.getUserIds()
+		if err != nil {
+			return EffectiveConfig{}, fmt.Errorf("fail to find user %s: %v", effective.User, err)
+		}
+		effective.Uid = int(uid)
+		effective.Gid = int(gid)
+	}
+	return effective, nil
+}
+
+//set the environment of the program, the "env_file" is read each time the
+//program is started so the change of it is taken by restarting the program
+func (p *Process) setEnv() error {
+	env, err := p.getEnvironment()
+	if err != nil {
+		return err
+	}
 	if len(env) != 0 {
 		p.cmd.Env = append(os.Environ(), env...)
 	} else {
 		p.cmd.Env = os.Environ()
 	}
+	return nil
+}
+
+//get the environment set by supervisord for the program, it doesn't include
+//the environment inherited from the supervisord process
+func (p *Process) getEnvironment() ([]string, error) {
+	envFile := p.config.GetStringExpression("env_file", "")
+	if envFile == "" {
+		return p.config.GetEnvironment(), nil
+	}
+	if expandFile, err := Path_expand(envFile); err == nil {
+		envFile = expandFile
+	}
+	fileEnv, err := config.ReadEnvFile(envFile)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read env_file: %v", err)
+	}
+	return p.config.MergeEnvironment(fileEnv), nil
 }
 
-func (p *Process) setDir() {
+//set the working directory of the program, return error if the
+//directory doesn't exist
+func (p *Process) setDir() error {
 	dir := p.config.GetStringExpression("directory", "")
-	if dir != "" {
-		p.cmd.Dir = dir
+	if dir == "" {
+		return nil
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("fail to change to directory %s: %v", dir, err)
 	}
+	if !fi.IsDir() {
+		return fmt.Errorf("fail to change to directory %s: not a directory", dir)
+	}
+	p.cmd.Dir = dir
+	return nil
 }
 
 func (p *Process) setLog() {
 	if p.config.IsProgram() {
-		p.StdoutLog = p.createLogger(p.GetStdoutLogfile(),
-			int64(p.config.GetBytes("stdout_logfile_maxbytes", 50*1024*1024)),
-			p.config.GetInt("stdout_logfile_backups", 10),
+		stdoutLogInfo := p.GetStdoutLogInfo()
+		p.StdoutLog = p.createLogger(stdoutLogInfo.Logfile,
+			stdoutLogInfo.MaxBytes,
+			stdoutLogInfo.Backups,
 			p.createStdoutLogEventEmitter())
 		capture_bytes := p.config.GetBytes("stdout_capture_maxbytes", 0)
-		if capture_bytes > 0 {
+		if stdoutLogInfo.CaptureEnabled {
 			log.WithFields(log.Fields{"program": p.config.GetProgramName()}).Info("capture stdout process communication")
 			p.StdoutLog = logger.NewLogCaptureLogger(p.StdoutLog,
 				capture_bytes,
@@ -503,29 +1168,34 @@ func (p *Process) setLog() {
 				p.GetGroup())
 		}
 
-		p.cmd.Stdout = p.StdoutLog
+		p.cmd.Stdout = p.watchReady(p.StdoutLog)
 
-		if p.config.GetBool("redirect_stderr", false) {
-			p.StderrLog = p.StdoutLog
-		} else {
-			p.StderrLog = p.createLogger(p.GetStderrLogfile(),
-				int64(p.config.GetBytes("stderr_logfile_maxbytes", 50*1024*1024)),
-				p.config.GetInt("stderr_logfile_backups", 10),
-				p.createStderrLogEventEmitter())
+		if p.IsRedirectStderr() {
+			//the stdout and stderr of program share one pipe if they are
+			//the same writer, so the order of the output is kept
+			p.StderrLog = logger.NewNullLogger(logger.NewNullLogEventEmitter())
+			p.cmd.Stderr = p.cmd.Stdout
+			return
 		}
 
+		stderrLogInfo := p.GetStderrLogInfo()
+		p.StderrLog = p.createLogger(stderrLogInfo.Logfile,
+			stderrLogInfo.MaxBytes,
+			stderrLogInfo.Backups,
+			p.createStderrLogEventEmitter())
+
 		capture_bytes = p.config.GetBytes("stderr_capture_maxbytes", 0)
 
-		if capture_bytes > 0 {
+		if stderrLogInfo.CaptureEnabled {
 			log.WithFields(log.Fields{"program": p.config.GetProgramName()}).Info("capture stderr process communication")
-			p.StderrLog = logger.NewLogCaptureLogger(p.StdoutLog,
+			p.StderrLog = logger.NewLogCaptureLogger(p.StderrLog,
 				capture_bytes,
 				"PROCESS_COMMUNICATION_STDERR",
 				p.GetName(),
 				p.GetGroup())
 		}
 
-		p.cmd.Stderr = p.StderrLog
+		p.cmd.Stderr = p.watchReady(p.StderrLog)
 
 	} else if p.config.IsEventListener() {
 		in, err := p.cmd.StdoutPipe()
@@ -552,8 +1222,8 @@ func (p *Process) setLog() {
 }
 
 func (p *Process) createStdoutLogEventEmitter() logger.LogEventEmitter {
-	if p.config.GetBytes("stdout_capture_maxbytes", 0) <= 0 && p.config.GetBool("stdout_events_enabled", false) {
-		return logger.NewStdoutLogEventEmitter(p.config.GetProgramName(), p.config.GetGroupName(), func() int {
+	if p.GetStdoutLogInfo().EventsEnabled {
+		return logger.NewStdoutLogEventEmitter(p.GetName(), p.GetGroup(), func() int {
 			return p.GetPid()
 		})
 	}
@@ -561,8 +1231,8 @@ func (p *Process) createStdoutLogEventEmitter() logger.LogEventEmitter {
 }
 
 func (p *Process) createStderrLogEventEmitter() logger.LogEventEmitter {
-	if p.config.GetBytes("stderr_capture_maxbytes", 0) <= 0 && p.config.GetBool("stderr_events_enabled", false) {
-		return logger.NewStdoutLogEventEmitter(p.config.GetProgramName(), p.config.GetGroupName(), func() int {
+	if p.GetStderrLogInfo().EventsEnabled {
+		return logger.NewStderrLogEventEmitter(p.GetName(), p.GetGroup(), func() int {
 			return p.GetPid()
 		})
 	}
@@ -573,7 +1243,8 @@ func (p *Process) registerEventListener(eventListenerName string,
 	_events []string,
 	stdin io.Reader,
 	stdout io.Writer) {
-	eventListener := events.NewEventListener(eventListenerName,
+	//the processes of an eventlistener section are in the same pool
+	eventListener := events.NewEventListener(p.GetGroup(),
 		p.supervisor_id,
 		stdin,
 		stdout,
@@ -586,14 +1257,26 @@ func (p *Process) unregisterEventListener(eventListenerName string) {
 }
 
 func (p *Process) createLogger(logFile string, maxBytes int64, backups int, logEventEmitter logger.LogEventEmitter) logger.Logger {
-	return logger.NewLogger(p.GetName(), logFile, logger.NewNullLocker(), maxBytes, backups, logEventEmitter)
+	return logger.NewLogger(p.GetName(), logFile, &sync.Mutex{}, maxBytes, backups, logEventEmitter)
 }
 
+//run the program as the "user" in the format "user[:group]", the user and
+//group can be names or ids. The program runs in the primary group of the
+//user if the group is not set
 func (p *Process) setUser() error {
-	userName := p.config.GetString("user", "")
-	if len(userName) == 0 {
+	if len(p.config.GetString("user", "")) == 0 {
 		return nil
 	}
+	uid, gid, groups, err := p.getUserIds()
+	if err != nil {
+		return err
+	}
+	return set_user_id(p.cmd.SysProcAttr, uid, gid, groups)
+}
+
+//get the uid, gid and supplementary groups of the "user"
+func (p *Process) getUserIds() (uint32, uint32, []uint32, error) {
+	userName := p.config.GetString("user", "")
 
 	//check if group is provided
 	pos := strings.Index(userName, ":")
@@ -602,74 +1285,166 @@ func (p *Process) setUser() error {
 		groupName = userName[pos+1:]
 		userName = userName[0:pos]
 	}
-	u, err := user.Lookup(userName)
+	u, err := lookupUser(userName)
 	if err != nil {
-		return err
+		return 0, 0, nil, err
 	}
 	uid, err := strconv.ParseUint(u.Uid, 10, 32)
 	if err != nil {
-		return err
+		return 0, 0, nil, err
 	}
 	gid, err := strconv.ParseUint(u.Gid, 10, 32)
 	if err != nil && groupName == "" {
-		return err
+		return 0, 0, nil, err
 	}
+	groups := []uint32{uint32(gid)}
 	if groupName != "" {
-		g, err := user.LookupGroup(groupName)
+		g, err := lookupGroup(groupName)
 		if err != nil {
-			return err
+			return 0, 0, nil, err
 		}
 		gid, err = strconv.ParseUint(g.Gid, 10, 32)
 		if err != nil {
-			return err
+			return 0, 0, nil, err
+		}
+		groups = []uint32{uint32(gid)}
+	} else if groupIds, err := u.GroupIds(); err == nil {
+		//the program gets all the groups of the user like login
+		groups = make([]uint32, 0)
+		for _, groupId := range groupIds {
+			if id, err := strconv.ParseUint(groupId, 10, 32); err == nil {
+				groups = append(groups, uint32(id))
+			}
 		}
 	}
-	set_user_id(p.cmd.SysProcAttr, uint32(uid), uint32(gid))
-	return nil
+	return uint32(uid), uint32(gid), groups, nil
+}
+
+//find the user by name or by the uid if it is a number
+func lookupUser(name string) (*user.User, error) {
+	u, err := user.Lookup(name)
+	if err == nil {
+		return u, nil
+	}
+	if _, e := strconv.ParseUint(name, 10, 32); e == nil {
+		return user.LookupId(name)
+	}
+	return nil, err
+}
+
+//find the group by name or by the gid if it is a number
+func lookupGroup(name string) (*user.Group, error) {
+	g, err := user.LookupGroup(name)
+	if err == nil {
+		return g, nil
+	}
+	if _, e := strconv.ParseUint(name, 10, 32); e == nil {
+		return user.LookupGroupId(name)
+	}
+	return nil, err
 }
 
-//send signal to process to stop it
+//send signal to process to stop it. The signals in stopsignal are sent one
+//by one, the program is killed by SIGKILL if it is still running after
+//waiting stopwaitsecs seconds for each signal
 func (p *Process) Stop(wait bool) {
-	p.lock.RLock()
+	p.lock.Lock()
 	p.stopByUser = true
-	p.lock.RUnlock()
+	p.lock.Unlock()
+	p.stop(p.getStopSignals(), wait)
+}
+
+//stop the program with the signal instead of the stopsignal in config
+func (p *Process) StopWithSignal(sig string, wait bool) {
+	p.lock.Lock()
+	p.stopByUser = true
+	p.lock.Unlock()
+	p.stop([]string{sig}, wait)
+}
+
+//send the stop signals to the program and kill it if it is still running
+//after them
+func (p *Process) stop(sigs []string, wait bool) {
+	p.lock.Lock()
+	switch p.state {
+	case STARTING, RUNNING:
+		p.changeStateTo(STOPPING)
+	case BACKOFF:
+		//the program is waiting to be started again
+		p.changeStateTo(STOPPED)
+		p.lock.Unlock()
+		return
+	case STOPPING:
+		//the stop signals are already sent
+		p.lock.Unlock()
+		if wait {
+			p.waitStopped(0)
+		}
+		return
+	default:
+		p.lock.Unlock()
+		return
+	}
+	p.lock.Unlock()
 	log.WithFields(log.Fields{"program": p.GetName()}).Info("stop the program")
-	sigs := strings.Fields(p.config.GetString("stopsignal", ""))
-	waitsecs := time.Duration(p.config.GetInt("stopwaitsecs", 10)) * time.Second
+	waitsecs := p.config.GetInt("stopwaitsecs", 10)
+	stopasgroup := p.config.GetBool("stopasgroup", false)
+	//stopasgroup implies killasgroup
+	killasgroup := stopasgroup || p.config.GetBool("killasgroup", false)
 	go func() {
 		stopped := false
 		for i := 0; i < len(sigs) && !stopped; i++ {
 			// send signal to process
 			sig, err := signals.ToSignal(sigs[i])
 			if err != nil {
-				continue
+				//the unknown stop signal is reported by the validation
+				log.WithFields(log.Fields{"program": p.GetName(), "signal": sigs[i]}).Warn("unknown stop signal, send TERM instead")
+				sig = syscall.SIGTERM
 			}
 			log.WithFields(log.Fields{"program": p.GetName(), "signal": sigs[i]}).Info("send stop signal to program")
-			p.Signal(sig)
-			endTime := time.Now().Add(waitsecs)
+			p.Signal(sig, stopasgroup)
 			//wait at most "stopwaitsecs" seconds for one signal
-			for endTime.After(time.Now()) {
-				//if it already exits
-				if p.state != STARTING && p.state != RUNNING && p.state != STOPPING {
-					stopped = true
-					break
-				}
-				time.Sleep(1 * time.Second)
-			}
+			stopped = p.waitStopped(time.Duration(waitsecs) * time.Second)
 		}
 		if !stopped {
-			log.WithFields(log.Fields{"program": p.GetName()}).Info("force to kill the program")
-			p.Signal(syscall.SIGKILL)
+			log.WithFields(log.Fields{"program": p.GetName(), "stopwaitsecs": waitsecs}).Warn("the program is still running after the stop signal, force to kill it with SIGKILL")
+			p.Signal(syscall.SIGKILL, killasgroup)
 		}
 	}()
 	if wait {
-		for {
-			// if the program exits
-			if p.state != STARTING && p.state != RUNNING && p.state != STOPPING {
-				break
-			}
-			time.Sleep(1 * time.Second)
+		p.waitStopped(0)
+	}
+}
+
+//stop the program and wait until it exits. If the program is still running
+//after all the stop signals and SIGKILL, it is killed with its children
+//again and the waiting is given up, so the stopping always completes
+func (p *Process) stopUntilExit() {
+	p.Stop(false)
+	sigs := p.getStopSignals()
+	waitsecs := p.config.GetInt("stopwaitsecs", 10)
+	timeout := time.Duration(waitsecs*len(sigs))*time.Second + killWaitTime
+	if !p.waitStopped(timeout) {
+		log.WithFields(log.Fields{"program": p.GetName()}).Error("the program is still running after stopping it, kill it with its children")
+		p.Signal(syscall.SIGKILL, true)
+		p.waitStopped(killWaitTime)
+	}
+}
+
+//wait until the program exits, a timeout <= 0 means no timeout.
+//
+//Return true if the program exits
+func (p *Process) waitStopped(timeout time.Duration) bool {
+	endTime := time.Now().Add(timeout)
+	for {
+		state := p.GetState()
+		if state != STARTING && state != RUNNING && state != STOPPING {
+			return true
+		}
+		if timeout > 0 && time.Now().After(endTime) {
+			return false
 		}
+		time.Sleep(100 * time.Millisecond)
 	}
 }
 
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"sort"
 	"strings"
 	"sync"
 
@@ -11,12 +12,15 @@ import (
 type ProcessManager struct {
 	procs          map[string]*Process
 	eventListeners map[string]*Process
-	lock           sync.Mutex
+	//the sockets of fcgi-programs, the key is the socket url
+	fcgiSockets map[string]*fcgiSocket
+	lock        sync.Mutex
 }
 
 func NewProcessManager() *ProcessManager {
 	return &ProcessManager{procs: make(map[string]*Process),
 		eventListeners: make(map[string]*Process),
+		fcgiSockets:    make(map[string]*fcgiSocket),
 	}
 }
 
@@ -32,12 +36,73 @@ func (pm *ProcessManager) CreateProcess(supervisor_id string, config *config.Con
 	}
 }
 
+// start the autostart programs in the ascending order of priority, the
+// programs with the same priority are started together and the programs
+// with a larger priority are started after they are started
 func (pm *ProcessManager) StartAutoStartPrograms() {
-	pm.ForEachProcess(func(proc *Process) {
-		if proc.isAutoStart() {
-			proc.Start(false)
+	pm.lock.Lock()
+	procs := pm.getAllProcess()
+	pm.lock.Unlock()
+
+	startAutoStartPrograms(procs)
+}
+
+// start the autostart programs in the names, other programs are not touched
+func (pm *ProcessManager) StartAutoStartProgramsIn(names []string) {
+	pm.lock.Lock()
+	procs := make([]*Process, 0)
+	for _, proc := range pm.getAllProcess() {
+		for _, name := range names {
+			if proc.GetName() == name {
+				procs = append(procs, proc)
+				break
+			}
 		}
-	})
+	}
+	pm.lock.Unlock()
+
+	startAutoStartPrograms(procs)
+}
+
+// start the autostart programs by ascending priority, the programs with
+// same priority are started concurrently. A program with depends_on is
+// started after the programs it depends on are RUNNING, it is not started
+// if any of them fails to reach RUNNING
+func startAutoStartPrograms(procs []*Process) {
+	started := make(map[string]chan struct{})
+	procsByName := make(map[string]*Process)
+	for _, proc := range procs {
+		started[proc.GetName()] = make(chan struct{})
+		procsByName[proc.GetName()] = proc
+	}
+	for i := 0; i < len(procs); {
+		priority := procs[i].getPriority()
+		var wg sync.WaitGroup
+		for ; i < len(procs) && procs[i].getPriority() == priority; i++ {
+			wg.Add(1)
+			go func(proc *Process) {
+				defer wg.Done()
+				defer close(started[proc.GetName()])
+				if !proc.isAutoStart() {
+					return
+				}
+				//the programs depended on are sorted before this one
+				for _, dependsOn := range proc.config.GetDependsOn() {
+					ch, ok := started[dependsOn]
+					if !ok {
+						continue
+					}
+					<-ch
+					if procsByName[dependsOn].GetState() != RUNNING {
+						log.WithFields(log.Fields{"program": proc.GetName()}).Warn("not started because the program it depends on is not running: ", dependsOn)
+						return
+					}
+				}
+				proc.Start(true)
+			}(procs[i])
+		}
+		wg.Wait()
+	}
 }
 
 func (pm *ProcessManager) createProgram(supervisor_id string, config *config.ConfigEntry) *Process {
@@ -47,12 +112,50 @@ func (pm *ProcessManager) createProgram(supervisor_id string, config *config.Con
 
 	if !ok {
 		proc = NewProcess(supervisor_id, config)
+		if config.IsFcgiProgram() {
+			pm.attachFcgiSocket(proc)
+		}
 		pm.procs[procName] = proc
 	}
 	log.Info("create process:", procName)
 	return proc
 }
 
+// create the socket of fcgi-program before its processes are spawned, the
+// processes of the same socket share one socket. The lock must be held
+func (pm *ProcessManager) attachFcgiSocket(proc *Process) {
+	url := proc.config.GetStringExpression("socket", "")
+	socket, ok := pm.fcgiSockets[url]
+	if !ok {
+		var err error
+		socket, err = newFcgiSocket(proc.config)
+		if err != nil {
+			log.WithFields(log.Fields{"program": proc.GetName(), "socket": url}).Errorf("fail to create the socket of fcgi-program:%v", err)
+			return
+		}
+		log.WithFields(log.Fields{"program": proc.GetName(), "socket": url}).Info("create the socket of fcgi-program")
+		pm.fcgiSockets[url] = socket
+	}
+	socket.users[proc.GetName()] = true
+	proc.fcgiSocket = socket.file
+}
+
+// close the socket of fcgi-program after all its processes are removed. The
+// lock must be held
+func (pm *ProcessManager) releaseFcgiSocket(proc *Process) {
+	url := proc.config.GetStringExpression("socket", "")
+	socket, ok := pm.fcgiSockets[url]
+	if !ok {
+		return
+	}
+	delete(socket.users, proc.GetName())
+	if len(socket.users) == 0 {
+		log.WithFields(log.Fields{"program": proc.GetName(), "socket": url}).Info("close the socket of fcgi-program")
+		socket.close()
+		delete(pm.fcgiSockets, url)
+	}
+}
+
 func (pm *ProcessManager) createEventListener(supervisor_id string, config *config.ConfigEntry) *Process {
 	eventListenerName := config.GetEventListenerName()
 
@@ -84,6 +187,9 @@ func (pm *ProcessManager) Remove(name string) *Process {
 	defer pm.lock.Unlock()
 	proc, _ := pm.procs[name]
 	delete(pm.procs, name)
+	if proc != nil && proc.fcgiSocket != nil {
+		pm.releaseFcgiSocket(proc)
+	}
 	log.Info("remove process:", name)
 	return proc
 }
@@ -111,6 +217,10 @@ func (pm *ProcessManager) Find(name string) *Process {
 func (pm *ProcessManager) Clear() {
 	pm.lock.Lock()
 	defer pm.lock.Unlock()
+	for _, socket := range pm.fcgiSockets {
+		socket.close()
+	}
+	pm.fcgiSockets = make(map[string]*fcgiSocket)
 	pm.procs = make(map[string]*Process)
 }
 
@@ -132,13 +242,78 @@ func (pm *ProcessManager) getAllProcess() []*Process {
 	return sortProcess(tmpProcs)
 }
 
+// stop all the programs in the reverse order of starting them and then the
+// event listeners, a process is stopped before stopping the next one
 func (pm *ProcessManager) StopAllProcesses() {
-	pm.ForEachProcess(func(proc *Process) {
-		proc.Stop(true)
-	})
+	pm.lock.Lock()
+	procs := pm.getAllProcess()
+	for _, evtListener := range pm.eventListeners {
+		procs = append([]*Process{evtListener}, procs...)
+	}
+	pm.lock.Unlock()
+
+	for i := len(procs) - 1; i >= 0; i-- {
+		procs[i].stopUntilExit()
+	}
+}
+
+// restart the processes in the group and return them. If serial is true,
+// the processes are restarted one by one in the order of starting them and
+// the next one is restarted after the previous one is RUNNING, the restart
+// is given up if a process fails to start so the rest ones keep running.
+// Otherwise all the processes are stopped and then started together. If wait
+// is false, the processes are returned without waiting for the restart
+func (pm *ProcessManager) RestartGroup(group string, serial bool, wait bool) []*Process {
+	pm.lock.Lock()
+	procs := make([]*Process, 0)
+	for _, proc := range pm.getAllProcess() {
+		if proc.GetGroup() == group {
+			procs = append(procs, proc)
+		}
+	}
+	pm.lock.Unlock()
+
+	if wait {
+		restartProcesses(group, procs, serial)
+	} else {
+		go restartProcesses(group, procs, serial)
+	}
+	return procs
+}
+
+func restartProcesses(group string, procs []*Process, serial bool) {
+	if serial {
+		for _, proc := range procs {
+			proc.Stop(true)
+			proc.Start(true)
+			if proc.GetState() != RUNNING {
+				log.WithFields(log.Fields{"group": group, "program": proc.GetName()}).Warn("the program fails to start, give up restarting the group")
+				break
+			}
+		}
+		return
+	}
+	for _, change := range []func(proc *Process){
+		func(proc *Process) { proc.Stop(true) },
+		func(proc *Process) { proc.Start(true) },
+	} {
+		var wg sync.WaitGroup
+		for _, proc := range procs {
+			wg.Add(1)
+			go func(proc *Process) {
+				defer wg.Done()
+				change(proc)
+			}(proc)
+		}
+		wg.Wait()
+	}
 }
 
 func sortProcess(procs []*Process) []*Process {
+	//the programs with same priority are sorted by name
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].GetName() < procs[j].GetName()
+	})
 	prog_configs := make([]*config.ConfigEntry, 0)
 	for _, proc := range procs {
 		if proc.config.IsProgram() {
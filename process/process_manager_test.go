@@ -1,7 +1,16 @@
 package process
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/csxuejin/supervisord/config"
 )
 
 var procs *ProcessManager = NewProcessManager()
@@ -29,3 +38,179 @@ func TestProcMgrRemove(t *testing.T) {
 		t.Error("fail to remove process")
 	}
 }
+
+// create the processes of all the programs in the config
+func createTestProcessManager(t *testing.T, dir string, configContent string) *ProcessManager {
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte(configContent), os.ModePerm)
+	cfg := config.NewConfig(configFile)
+	if _, err := cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	pm := NewProcessManager()
+	for _, entry := range cfg.GetPrograms() {
+		pm.CreateProcess("supervisor", entry)
+	}
+	return pm
+}
+
+func TestStopAllProcesses(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	pm := createTestProcessManager(t, dir, `[program:a]
+command=/bin/sh -c "trap '' TERM; exec sleep 60"
+startsecs=0
+stopwaitsecs=1
+
+[program:b]
+command=/bin/sleep 60
+startsecs=0
+`)
+	pm.ForEachProcess(func(proc *Process) {
+		proc.Start(true)
+	})
+
+	start := time.Now()
+	pm.StopAllProcesses()
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("The processes should be stopped in time, elapsed=%v", time.Since(start))
+	}
+	pm.ForEachProcess(func(proc *Process) {
+		if proc.GetState() != STOPPED {
+			t.Errorf("The program %s should be stopped, state=%v", proc.GetName(), proc.GetState())
+		}
+	})
+}
+
+func TestStartAndStopByPriority(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	startFile := filepath.Join(dir, "start")
+	stopFile := filepath.Join(dir, "stop")
+	program := func(name string, priority int) string {
+		return fmt.Sprintf("[program:%s]\npriority=%d\nstartsecs=1\n"+
+			"command=/bin/sh -c \"trap 'echo %s >> %s; exit 0' TERM; echo %s >> %s; while true; do sleep 0.1; done\"\n\n",
+			name, priority, name, stopFile, name, startFile)
+	}
+	pm := createTestProcessManager(t, dir, program("worker", 300)+program("db", 100)+program("cache", 200)+program("api", 300))
+
+	pm.StartAutoStartPrograms()
+	b, _ := ioutil.ReadFile(startFile)
+	started := strings.Fields(string(b))
+	if len(started) != 4 || started[0] != "db" || started[1] != "cache" {
+		t.Errorf("The programs should be started in the ascending order of priority: %v", started)
+	}
+	pm.StopAllProcesses()
+	b, _ = ioutil.ReadFile(stopFile)
+	if stopped := strings.Fields(string(b)); strings.Join(stopped, " ") != "worker api cache db" {
+		t.Errorf("The programs should be stopped in the descending order of priority: %v", stopped)
+	}
+}
+
+func TestStartAndStopByDependsOn(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	startFile := filepath.Join(dir, "start")
+	stopFile := filepath.Join(dir, "stop")
+	program := func(name string, dependsOn string) string {
+		return fmt.Sprintf("[program:%s]\ndepends_on=%s\nstartsecs=1\n"+
+			"command=/bin/sh -c \"trap 'echo %s >> %s; exit 0' TERM; echo %s >> %s; while true; do sleep 0.1; done\"\n\n",
+			name, dependsOn, name, stopFile, name, startFile)
+	}
+	// the broken program never reaches RUNNING
+	pm := createTestProcessManager(t, dir, program("worker", "app")+program("app", "db")+program("db", "")+
+		"[program:broken]\ncommand=/bin/false\nstartsecs=1\nstartretries=0\n\n"+program("consumer", "broken"))
+
+	pm.StartAutoStartPrograms()
+	b, _ := ioutil.ReadFile(startFile)
+	if started := strings.Fields(string(b)); strings.Join(started, " ") != "db app worker" {
+		t.Errorf("The programs should be started after the programs they depend on: %v", started)
+	}
+	if proc := pm.Find("consumer"); proc.GetState() != STOPPED {
+		t.Errorf("The program depending on a failed program should not be started, state=%v", proc.GetState())
+	}
+	pm.StopAllProcesses()
+	b, _ = ioutil.ReadFile(stopFile)
+	if stopped := strings.Fields(string(b)); strings.Join(stopped, " ") != "worker app db" {
+		t.Errorf("The programs should be stopped in the reverse order of starting: %v", stopped)
+	}
+}
+
+func TestFcgiProgramSharesSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the stdin of process is checked by /proc")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	sockFile := filepath.Join(dir, "fcgi.sock")
+	pm := createTestProcessManager(t, dir, fmt.Sprintf(`[fcgi-program:php]
+command=/bin/sleep 60
+socket=unix://%s
+socket_mode=0600
+numprocs=2
+process_name=%%(program_name)s_%%(process_num)s
+startsecs=0
+`, sockFile))
+	defer pm.StopAllProcesses()
+
+	if info, err := os.Stat(sockFile); err != nil || info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("The socket should be created before spawning, err=%v", err)
+	}
+	sockets := make(map[string]bool)
+	for _, name := range []string{"php_0", "php_1"} {
+		proc := pm.Find(name)
+		proc.Start(true)
+		// the socket is the stdin of the process
+		link, err := os.Readlink(fmt.Sprintf("/proc/%d/fd/0", proc.GetPid()))
+		if err != nil || !strings.HasPrefix(link, "socket:") {
+			t.Fatalf("The stdin of %s should be the socket, stdin=%s, err=%v", name, link, err)
+		}
+		sockets[link] = true
+	}
+	if len(sockets) != 1 {
+		t.Errorf("The processes should share one socket, sockets=%v", sockets)
+	}
+
+	pm.Remove("php_0").Stop(true)
+	if _, err := os.Stat(sockFile); err != nil {
+		t.Error("The socket should not be closed before all processes are removed")
+	}
+	pm.Remove("php_1").Stop(true)
+	if _, err := os.Stat(sockFile); err == nil {
+		t.Error("The socket should be closed after all processes are removed")
+	}
+}
+
+func TestRestartGroup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	eventFile := filepath.Join(dir, "events")
+	program := func(name string) string {
+		return fmt.Sprintf("[program:%s]\nstartsecs=1\n"+
+			"command=/bin/sh -c \"trap 'echo stop-%s >> %s; exit 0' TERM; echo start-%s >> %s; while true; do sleep 0.1; done\"\n\n",
+			name, name, eventFile, name, eventFile)
+	}
+	pm := createTestProcessManager(t, dir, "[group:pool]\nprograms=a,b\n\n"+program("a")+program("b"))
+	defer pm.StopAllProcesses()
+
+	for _, serial := range []bool{true, false} {
+		pm.ForEachProcess(func(proc *Process) {
+			proc.Start(true)
+		})
+		os.Remove(eventFile)
+		if procs := pm.RestartGroup("pool", serial, true); len(procs) != 2 {
+			t.Fatalf("All the processes in the group should be restarted: %v", procs)
+		}
+		b, _ := ioutil.ReadFile(eventFile)
+		events := strings.Join(strings.Fields(string(b)), " ")
+		if serial && events != "stop-a start-a stop-b start-b" {
+			t.Errorf("The processes should be restarted one by one: %s", events)
+		}
+		if !serial && (len(strings.Fields(events)) != 4 || strings.Index(events, "start-") < strings.LastIndex(events, "stop-")) {
+			t.Errorf("The processes should be stopped before starting any one: %s", events)
+		}
+	}
+	if len(pm.RestartGroup("nonexistent", false, true)) != 0 {
+		t.Error("No process should be restarted for the nonexistent group")
+	}
+}
@@ -0,0 +1,657 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/csxuejin/supervisord/config"
+	"github.com/csxuejin/supervisord/events"
+)
+
+// create the process of program "test" from the program section
+func createTestProcess(t *testing.T, dir string, programSection string) *Process {
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[program:test]\n"+programSection), os.ModePerm)
+	cfg := config.NewConfig(configFile)
+	if _, err := cfg.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return NewProcess("supervisor", cfg.GetProgram("test"))
+}
+
+// wait until the process is not in start
+func waitStartFinished(proc *Process, timeout time.Duration) bool {
+	endTime := time.Now().Add(timeout)
+	for time.Now().Before(endTime) {
+		proc.lock.RLock()
+		inStart := proc.inStart
+		proc.lock.RUnlock()
+		if !inStart {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+// count the lines of the file written by the started processes
+func countRuns(file string) int {
+	b, _ := ioutil.ReadFile(file)
+	return strings.Count(string(b), "\n")
+}
+
+// a command which exits with unexpectedCode in the first runs-1 runs and
+// exits with lastCode in the last run
+func exitCommand(runFile string, runs int, unexpectedCode int, lastCode int) string {
+	return fmt.Sprintf(`/bin/sh -c "echo run >> %s; test $(wc -l < %s) -ge %d && exit %d; exit %d"`,
+		runFile, runFile, runs, lastCode, unexpectedCode)
+}
+
+func TestAutoRestartUnexpected(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=%s\nstartsecs=0\nautorestart=unexpected\nexitcodes=0, 2\n", exitCommand(runFile, 3, 1, 2)))
+
+	proc.Start(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is still restarted")
+	}
+	if countRuns(runFile) != 3 || proc.GetState() != EXITED || proc.GetExitstatus() != 2 {
+		t.Errorf("The program should be restarted until the exit code is expected, runs=%d, state=%v", countRuns(runFile), proc.GetState())
+	}
+}
+
+func TestAutoRestartFalse(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=%s\nstartsecs=0\nautorestart=false\n", exitCommand(runFile, 3, 1, 0)))
+
+	proc.Start(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is still restarted")
+	}
+	// the one-shot program exiting with an unexpected code is failed
+	if countRuns(runFile) != 1 || proc.GetState() != FATAL || proc.GetExitstatus() != 1 || proc.GetSpawnErr() != "exited with unexpected status 1" {
+		t.Errorf("The program should not be restarted, runs=%d, state=%v, exitstatus=%d", countRuns(runFile), proc.GetState(), proc.GetExitstatus())
+	}
+}
+
+func TestAutoRestartFalseExpectedExit(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=%s\nstartsecs=0\nautorestart=false\nexitcodes=0,3\n", exitCommand(runFile, 1, 1, 3)))
+
+	proc.Start(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is still restarted")
+	}
+	if countRuns(runFile) != 1 || proc.GetState() != EXITED || proc.GetExitstatus() != 3 || proc.GetSpawnErr() != "" {
+		t.Errorf("The one-shot program should be EXITED, runs=%d, state=%v, exitstatus=%d", countRuns(runFile), proc.GetState(), proc.GetExitstatus())
+	}
+}
+
+func TestAutoRestartTrue(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	// exits with the expected code 0 twice and then keeps running
+	command := fmt.Sprintf(`/bin/sh -c "echo run >> %s; test $(wc -l < %s) -ge 3 && exec sleep 60; exit 0"`, runFile, runFile)
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=%s\nstartsecs=0\nautorestart=true\n", command))
+
+	proc.Start(false)
+	endTime := time.Now().Add(10 * time.Second)
+	for countRuns(runFile) < 3 && time.Now().Before(endTime) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	proc.Stop(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is not stopped")
+	}
+	if countRuns(runFile) != 3 {
+		t.Errorf("The program exited with expected code should be restarted, runs=%d", countRuns(runFile))
+	}
+}
+
+func TestFatalAfterStartRetries(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=%s\nstartsecs=1\nstartretries=2\n", exitCommand(runFile, 100, 1, 1)))
+
+	proc.Start(false)
+	sawBackoff := false
+	endTime := time.Now().Add(20 * time.Second)
+	for proc.GetState() != FATAL && time.Now().Before(endTime) {
+		if proc.GetState() == BACKOFF {
+			sawBackoff = true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if proc.GetState() != FATAL || !sawBackoff {
+		t.Errorf("The program should be in BACKOFF and then FATAL, state=%v", proc.GetState())
+	}
+	// the first start and 2 retries
+	if countRuns(runFile) != 3 {
+		t.Errorf("The program should be started 3 times, runs=%d", countRuns(runFile))
+	}
+}
+
+func TestRunningAfterStartSecs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, "command=/bin/sleep 60\nstartsecs=1\n")
+
+	proc.Start(false)
+	time.Sleep(200 * time.Millisecond)
+	if proc.GetState() != STARTING {
+		t.Errorf("The program should be STARTING before startsecs, state=%v", proc.GetState())
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if proc.GetState() != RUNNING {
+		t.Errorf("The program should be RUNNING after startsecs, state=%v", proc.GetState())
+	}
+	proc.Stop(true)
+}
+
+func TestStopWithStopSignal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "trap 'exit 0' INT; while true; do sleep 0.1; done"
+startsecs=0
+stopsignal=INT
+stopwaitsecs=10
+`)
+
+	proc.Start(false)
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	proc.Stop(true)
+	if proc.GetState() != STOPPED || time.Since(start) > 5*time.Second {
+		t.Errorf("The program should be stopped by the stop signal, state=%v, elapsed=%v", proc.GetState(), time.Since(start))
+	}
+}
+
+func TestStopWithSignal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	// the stopsignal TERM is ignored, only the given signal stops it
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "trap '' TERM; trap 'exit 0' QUIT; while true; do sleep 0.1; done"
+startsecs=0
+stopwaitsecs=10
+`)
+
+	proc.Start(false)
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	proc.StopWithSignal("SIGQUIT", true)
+	if proc.GetState() != STOPPED || time.Since(start) > 5*time.Second {
+		t.Errorf("The program should be stopped by the given signal, state=%v, elapsed=%v", proc.GetState(), time.Since(start))
+	}
+}
+
+func TestKillAfterStopWaitSecs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	// the ignored SIGTERM is inherited by sleep after exec
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "trap '' TERM; exec sleep 60"
+startsecs=0
+stopwaitsecs=1
+`)
+
+	proc.Start(false)
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	proc.Stop(true)
+	elapsed := time.Since(start)
+	if proc.GetState() != STOPPED {
+		t.Errorf("The program should be STOPPED, state=%v", proc.GetState())
+	}
+	if elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("The program should be killed after stopwaitsecs, elapsed=%v", elapsed)
+	}
+}
+
+// check if the process is running, a zombie process is not running
+func isProcessRunning(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	// the state follows the command name in parentheses
+	fields := strings.Fields(string(b[strings.LastIndex(string(b), ")")+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+// start a shell which forks a sleeper, stop it and return the pid of the sleeper
+func stopProgramWithChild(t *testing.T, dir string, stopasgroup bool) int {
+	pidFile := filepath.Join(dir, "child.pid")
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=/bin/sh -c \"sleep 60 >/dev/null 2>&1 & echo $! > %s; wait\"\nstartsecs=0\nstopasgroup=%v\n", pidFile, stopasgroup))
+
+	proc.Start(false)
+	pid := 0
+	endTime := time.Now().Add(5 * time.Second)
+	for pid == 0 && time.Now().Before(endTime) {
+		b, _ := ioutil.ReadFile(pidFile)
+		pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pid == 0 {
+		t.Fatal("The child process is not started")
+	}
+	proc.Stop(true)
+	return pid
+}
+
+func TestStopAsGroup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+
+	pid := stopProgramWithChild(t, dir, true)
+	time.Sleep(100 * time.Millisecond)
+	if isProcessRunning(pid) {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Error("The child process should be stopped with the program")
+	}
+}
+
+func TestStopWithoutGroup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+
+	pid := stopProgramWithChild(t, dir, false)
+	defer syscall.Kill(pid, syscall.SIGKILL)
+	if !isProcessRunning(pid) {
+		t.Error("Only the program should be stopped without stopasgroup")
+	}
+}
+
+func TestEnvironmentDirectoryAndUmask(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	os.Setenv("SUPERVISORD_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("SUPERVISORD_TEST_INHERITED")
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "echo $FOO $SUPERVISORD_TEST_INHERITED > out; pwd >> out; umask >> out"
+directory=%s
+environment=FOO="bar"
+umask=077
+startsecs=0
+autorestart=false
+`, dir))
+
+	proc.Start(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is not finished")
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "out"))
+	realDir, _ := filepath.EvalSymlinks(dir)
+	expected := fmt.Sprintf("bar inherited\n%s\n0077\n", realDir)
+	if string(b) != expected {
+		t.Errorf("The program should be started with the environment, directory and umask, output=%q", string(b))
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, ".env")
+	ioutil.WriteFile(envFile, []byte("FOO=file\nBAR='file bar'\n"), os.ModePerm)
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "echo $FOO $BAR > %s"
+env_file=%s
+environment=FOO="inline"
+startsecs=0
+autorestart=false
+`, filepath.Join(dir, "out"), envFile))
+
+	for _, expected := range []string{"inline file bar\n", "inline changed\n"} {
+		proc.Start(false)
+		if !waitStartFinished(proc, 10*time.Second) {
+			t.Fatal("The program is not finished")
+		}
+		b, _ := ioutil.ReadFile(filepath.Join(dir, "out"))
+		if string(b) != expected {
+			t.Errorf("Wrong environment from env_file, output=%q, expected=%q", string(b), expected)
+		}
+		// the env_file is read again when the program is started
+		ioutil.WriteFile(envFile, []byte("BAR=changed\n"), os.ModePerm)
+	}
+
+	os.Remove(envFile)
+	proc.Start(true)
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "env_file") {
+		t.Errorf("The program should be FATAL without the env_file, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+}
+
+func TestInvalidDirectory(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, fmt.Sprintf("command=/bin/sleep 60\ndirectory=%s\n", filepath.Join(dir, "none")))
+
+	proc.Start(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is not finished")
+	}
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "none") {
+		t.Errorf("The program should be FATAL with the reason, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+}
+
+func TestRedirectStderr(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	stdoutLog := filepath.Join(dir, "stdout.log")
+	stderrLog := filepath.Join(dir, "stderr.log")
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "echo out1; echo err1 >&2; echo out2; echo err2 >&2"
+startsecs=0
+autorestart=false
+redirect_stderr=true
+stdout_logfile=%s
+stderr_logfile=%s
+`, stdoutLog, stderrLog))
+
+	proc.Start(false)
+	if !waitStartFinished(proc, 10*time.Second) {
+		t.Fatal("The program is not finished")
+	}
+	stdout, _ := proc.StdoutLog.ReadLog(0, 0)
+	if stdout != "out1\nerr1\nout2\nerr2\n" {
+		t.Errorf("The stderr should be merged into stdout in order, stdout=%q", stdout)
+	}
+	files, _ := filepath.Glob(stderrLog + "*")
+	if len(files) != 0 || proc.GetStderrLogfile() != "" {
+		t.Error("The stderr log should be disabled")
+	}
+	if _, err := proc.StderrLog.ReadLog(0, 0); err == nil {
+		t.Error("The stderr log should not be read")
+	}
+}
+
+func TestRestartsAndLastExitStatus(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "echo run >> %s; test $(wc -l < %s) -ge 3 && exec sleep 60; exit 3"
+startsecs=1
+startretries=5
+`, runFile, runFile))
+	if proc.GetLastExitStatus() != -1 {
+		t.Error("The last exit status should be -1 before the program exits")
+	}
+
+	proc.Start(false)
+	defer proc.Stop(true)
+	for i := 0; i < 100 && countRuns(runFile) < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if proc.GetRestarts() != 2 || proc.GetLastExitStatus() != 3 {
+		t.Errorf("Wrong restarts %d or last exit status %d", proc.GetRestarts(), proc.GetLastExitStatus())
+	}
+	for i := 0; i < 30 && proc.GetState() != RUNNING; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if proc.GetState() != RUNNING || proc.GetRestarts() != 0 {
+		t.Errorf("The restarts should be reset after the program is RUNNING, state=%v, restarts=%d", proc.GetState(), proc.GetRestarts())
+	}
+}
+
+// read an event sent to the event listener and acknowledge it
+func readListenerEvent(t *testing.T, reader *bufio.Reader, writer io.Writer) (string, string) {
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.TrimSpace(header), ":")
+	n, _ := strconv.Atoi(fields[len(fields)-1])
+	body := make([]byte, n)
+	io.ReadFull(reader, body)
+	writer.Write([]byte("RESULT 2\nOKREADY\n"))
+	return header, string(body)
+}
+
+func TestLogEvents(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	defer func() {
+		events.UnregisterEventListener("log-listener")
+		w2.Close()
+		r1.Close()
+	}()
+	listener := events.NewEventListener("log-listener", "supervisor", r2, w1, 10)
+	events.RegisterEventListener("log-listener", []string{"PROCESS_LOG"}, listener)
+	w2.Write([]byte("READY\n"))
+
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "echo out line; sleep 0.2; echo error line >&2; sleep 60"
+startsecs=0
+stdout_logfile=%s
+stderr_logfile=%s
+stdout_events_enabled=true
+stderr_events_enabled=true
+`, filepath.Join(dir, "stdout.log"), filepath.Join(dir, "stderr.log")))
+	proc.Start(true)
+	defer proc.Stop(true)
+
+	reader := bufio.NewReader(r1)
+	header, body := readListenerEvent(t, reader, w2)
+	expected := fmt.Sprintf("processname:test groupname:test pid:%d channel:stdout\nout line\n", proc.GetPid())
+	if !strings.Contains(header, "eventname:PROCESS_LOG_STDOUT ") || body != expected {
+		t.Errorf("Wrong stdout log event, header=%s, body=%s", header, body)
+	}
+	header, body = readListenerEvent(t, reader, w2)
+	expected = fmt.Sprintf("processname:test groupname:test pid:%d channel:stderr\nerror line\n", proc.GetPid())
+	if !strings.Contains(header, "eventname:PROCESS_LOG_STDERR ") || body != expected {
+		t.Errorf("Wrong stderr log event, header=%s, body=%s", header, body)
+	}
+}
+
+func TestAutoRestartBackoff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	runFile := filepath.Join(dir, "runs")
+	// the 5th run stays up longer than startsecs and resets the backoff
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "echo run >> %s; test $(wc -l < %s) -eq 5 && sleep 1.2; exit 1"
+startsecs=0
+autorestart=true
+autorestart_backoff=0.1,0.4
+`, runFile, runFile))
+	proc.Start(false)
+	defer proc.Stop(true)
+
+	delays := make([]time.Duration, 0)
+	for i := 0; i < 1000 && len(delays) < 5; i++ {
+		delay := proc.GetBackoffDelay()
+		if delay > 0 && (len(delays) == 0 || delays[len(delays)-1] != delay) {
+			delays = append(delays, delay)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond}
+	if fmt.Sprint(delays) != fmt.Sprint(expected) {
+		t.Errorf("Wrong backoff delays %v, expected %v", delays, expected)
+	}
+}
+
+func TestAutoRestartJitter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "exit 1"
+startsecs=0
+autorestart=true
+autorestart_jitter=0.5
+`)
+	delays := make(map[time.Duration]bool)
+	for i := 0; i < 10; i++ {
+		delay := proc.getAutoRestartJitter()
+		if delay < 0 || delay > 500*time.Millisecond {
+			t.Fatalf("The jitter %v is out of the window", delay)
+		}
+		delays[delay] = true
+	}
+	if len(delays) <= 1 {
+		t.Errorf("The restart delays should be random: %v", delays)
+	}
+
+	// the program is restarted after the jitter in BACKOFF
+	proc.Start(false)
+	defer proc.Stop(true)
+	backoff := false
+	for i := 0; i < 200 && !backoff; i++ {
+		backoff = proc.GetBackoffDelay() > 0
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !backoff {
+		t.Error("The program should wait the jitter in BACKOFF before restarting")
+	}
+}
+
+func TestMonitorOrphanProcess(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	orphanPollInterval = 10 * time.Millisecond
+	defer func() { orphanPollInterval = 500 * time.Millisecond }()
+	// the process left by the last supervisord
+	orphan := exec.Command("/bin/sleep", "60")
+	orphan.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := orphan.Start(); err != nil {
+		t.Fatal(err)
+	}
+	orphanExited := make(chan struct{})
+	go func() {
+		orphan.Wait()
+		close(orphanExited)
+	}()
+	defer orphan.Process.Kill()
+	pidFile := filepath.Join(dir, "test.pid")
+	ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", orphan.Process.Pid)), os.ModePerm)
+
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sleep 60
+startsecs=1
+pidfile=%s
+`, pidFile))
+	proc.Start(true)
+	if proc.GetState() != RUNNING || proc.GetPid() != orphan.Process.Pid {
+		t.Fatalf("The running process should be monitored, state=%v, pid=%d", proc.GetState(), proc.GetPid())
+	}
+	proc.Stop(true)
+	select {
+	case <-orphanExited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The monitored process should be stopped")
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Errorf("The pid file should be removed after the process exits, err=%v", err)
+	}
+
+	// the pid in the stale pid file is not running, a new process is started
+	ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", orphan.Process.Pid)), os.ModePerm)
+	proc.Start(true)
+	defer proc.Stop(true)
+	b, _ := ioutil.ReadFile(pidFile)
+	if proc.GetState() != RUNNING || proc.GetPid() == orphan.Process.Pid || string(b) != fmt.Sprintf("%d\n", proc.GetPid()) {
+		t.Errorf("A new process should be started and written to the pid file, pid=%d, pidfile=%s", proc.GetPid(), string(b))
+	}
+}
+
+func TestOrphanProcessWithOtherCommand(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	// the pid in the pid file is reused by the test itself
+	pidFile := filepath.Join(dir, "test.pid")
+	ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", os.Getppid())), os.ModePerm)
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sleep 60
+startsecs=0
+pidfile=%s
+`, pidFile))
+	if pid := proc.findOrphan("/bin/sleep"); pid != 0 {
+		t.Errorf("The process running other command should not be monitored, pid=%d", pid)
+	}
+}
+
+// run "id" as the user and get its output
+func runAsUser(t *testing.T, dir string, userName string) (*Process, string) {
+	logFile := filepath.Join(dir, "id.log")
+	os.Remove(logFile)
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "id -u; id -g; id -G"
+user=%s
+startsecs=0
+autorestart=false
+stdout_logfile=%s
+`, userName, logFile))
+	proc.Start(true)
+	waitStartFinished(proc, 5*time.Second)
+	b, _ := ioutil.ReadFile(logFile)
+	return proc, string(b)
+}
+
+func TestRunAsUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("only root can run the program as other user")
+	}
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		t.Skip("no user nobody")
+	}
+	rootGroup, err := user.LookupGroupId("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		user     string
+		expected string
+	}{
+		{"nobody", fmt.Sprintf("%s\n%s\n", nobody.Uid, nobody.Gid)},
+		{nobody.Uid, fmt.Sprintf("%s\n%s\n", nobody.Uid, nobody.Gid)},
+		{"nobody:" + rootGroup.Name, fmt.Sprintf("%s\n0\n0\n", nobody.Uid)},
+		{nobody.Uid + ":0", fmt.Sprintf("%s\n0\n0\n", nobody.Uid)},
+	}
+	for _, test := range tests {
+		proc, output := runAsUser(t, dir, test.user)
+		// the supplementary groups of root are not inherited
+		if !strings.HasPrefix(output, test.expected) || strings.Contains(output, " 0") {
+			t.Errorf("Wrong id of user %s: %q, state=%v, spawnerr=%s", test.user, output, proc.GetState(), proc.GetSpawnErr())
+		}
+	}
+
+	proc, _ := runAsUser(t, dir, "nonexistent-user")
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "nonexistent-user") {
+		t.Errorf("The unknown user should be FATAL, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+}
+
+func TestRunAsUserWithoutRoot(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("the test is run as root")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc, _ := runAsUser(t, dir, "0")
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "not run as root") {
+		t.Errorf("The program run as other user should be FATAL, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+	// the current user can be set
+	current, _ := user.Current()
+	if proc, output := runAsUser(t, dir, current.Username); !strings.HasPrefix(output, current.Uid+"\n") {
+		t.Errorf("Fail to run as the current user: %q, spawnerr=%s", output, proc.GetSpawnErr())
+	}
+}
@@ -0,0 +1,123 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// the readiness of a program which has ready_regex
+const (
+	READY_WAITING = "WAITING"
+	READY_READY   = "READY"
+	READY_TIMEOUT = "TIMEOUT"
+)
+
+// the longest partial line kept to match the ready_regex
+const maxReadyLineLength = 4096
+
+// readyWatcher is closed when the ready_regex is found in the output of
+// the program
+type readyWatcher struct {
+	pattern *regexp.Regexp
+	ready   chan struct{}
+	once    sync.Once
+}
+
+func newReadyWatcher(pattern *regexp.Regexp) *readyWatcher {
+	return &readyWatcher{pattern: pattern, ready: make(chan struct{})}
+}
+
+func (rw *readyWatcher) setReady() {
+	rw.once.Do(func() { close(rw.ready) })
+}
+
+func (rw *readyWatcher) isReady() bool {
+	select {
+	case <-rw.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// readyWriter looks for the ready_regex in the lines written to stdout or
+// stderr, the output is written to the log as it is
+type readyWriter struct {
+	w       io.Writer
+	watcher *readyWatcher
+	line    []byte
+}
+
+func (rw *readyWriter) Write(p []byte) (int, error) {
+	if !rw.watcher.isReady() {
+		rw.match(p)
+	}
+	return rw.w.Write(p)
+}
+
+func (rw *readyWriter) match(p []byte) {
+	rw.line = append(rw.line, p...)
+	for {
+		pos := bytes.IndexByte(rw.line, '\n')
+		if pos == -1 {
+			break
+		}
+		if rw.watcher.pattern.Match(rw.line[0:pos]) {
+			rw.watcher.setReady()
+			rw.line = nil
+			return
+		}
+		rw.line = rw.line[pos+1:]
+	}
+	//the banner may be written without the newline
+	if len(rw.line) > 0 && rw.watcher.pattern.Match(rw.line) {
+		rw.watcher.setReady()
+		rw.line = nil
+		return
+	}
+	if len(rw.line) > maxReadyLineLength {
+		rw.line = rw.line[len(rw.line)-maxReadyLineLength:]
+	}
+}
+
+// get the readiness of the program, empty if no ready_regex
+func (p *Process) GetReady() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.ready
+}
+
+// get the ready_regex of the program, nil if it is not set
+func (p *Process) getReadyRegex() (*regexp.Regexp, error) {
+	expr := p.config.GetString("ready_regex", "")
+	if expr == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ready_regex %s: %v", expr, err)
+	}
+	return pattern, nil
+}
+
+// the program must print the ready_regex in ready_timeout seconds
+func (p *Process) getReadyTimeout() time.Duration {
+	timeout := p.config.GetInt("ready_timeout", 60)
+	if timeout <= 0 {
+		timeout = 60
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// watch the output of the program for the ready_regex, the writer is not
+// wrapped if the ready_regex is not set
+func (p *Process) watchReady(w io.Writer) io.Writer {
+	if p.readyWatcher == nil {
+		return w
+	}
+	return &readyWriter{w: w, watcher: p.readyWatcher}
+}
@@ -0,0 +1,80 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunningWhenReadyRegexIsFound(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "echo starting; sleep 0.5; echo server is ready; exec sleep 60"
+startsecs=60
+ready_regex=is ready$
+`)
+	if proc.GetReady() != "" {
+		t.Errorf("Wrong readiness before the program is started, ready=%s", proc.GetReady())
+	}
+	start := time.Now()
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.GetState() != RUNNING {
+		t.Errorf("The program should be RUNNING once it is ready, state=%v", proc.GetState())
+	}
+	if proc.GetReady() != READY_READY {
+		t.Errorf("Wrong readiness %s", proc.GetReady())
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 10*time.Second {
+		t.Errorf("The program should be RUNNING when it prints the ready line, elapsed=%v", elapsed)
+	}
+}
+
+func TestReadyRegexWithoutNewline(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "printf 'listening on 8080' >&2; exec sleep 60"
+ready_regex=listening on [0-9]+
+ready_timeout=10
+`)
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.GetState() != RUNNING || proc.GetReady() != READY_READY {
+		t.Errorf("The banner without the newline should be matched, state=%v, ready=%s", proc.GetState(), proc.GetReady())
+	}
+}
+
+func TestFatalWhenReadyRegexIsNotFound(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sh -c "echo starting; exec sleep 60"
+ready_regex=ready
+ready_timeout=1
+`)
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.GetState() != FATAL {
+		t.Errorf("The program not ready in ready_timeout should be FATAL, state=%v", proc.GetState())
+	}
+	if proc.GetReady() != READY_TIMEOUT {
+		t.Errorf("Wrong readiness %s", proc.GetReady())
+	}
+	if !strings.Contains(proc.GetSpawnErr(), "not ready") {
+		t.Errorf("Wrong spawnerr %s", proc.GetSpawnErr())
+	}
+}
+
+func TestInvalidReadyRegex(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, `command=/bin/sleep 60
+ready_regex=ready(
+`)
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "ready_regex") {
+		t.Errorf("The program with an invalid ready_regex should be FATAL, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+}
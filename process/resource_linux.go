@@ -0,0 +1,66 @@
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//the clock ticks per second used by /proc/<pid>/stat, it is 100 in almost
+//all linux systems
+const userHZ = 100
+
+//get the cpu time in seconds and the resident memory in bytes of the process
+//from /proc/<pid>/stat
+func getResourceUsage(pid int) (float64, int64, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	//the fields after the command name in parentheses, starts from state
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	if len(fields) < 22 {
+		return 0, 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return float64(utime+stime) / userHZ, rss * int64(os.Getpagesize()), nil
+}
+
+//get the resident and the virtual memory in bytes of the process from the
+//statm of the process
+func getMemoryUsage(pid int) (int64, int64, error) {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("invalid statm of process %d", pid)
+	}
+	size, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	resident, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	pageSize := int64(os.Getpagesize())
+	return resident * pageSize, size * pageSize, nil
+}
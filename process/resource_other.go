@@ -0,0 +1,16 @@
+// +build !linux
+
+package process
+
+import (
+	"errors"
+)
+
+//the resource usage is only available in linux
+func getResourceUsage(pid int) (float64, int64, error) {
+	return 0, 0, errors.New("the resource usage is not supported in this platform")
+}
+
+func getMemoryUsage(pid int) (int64, int64, error) {
+	return 0, 0, errors.New("the memory usage is not supported in this platform")
+}
@@ -0,0 +1,119 @@
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+//supervisord execs itself with the flag to set the limit of open files of a
+//program and then exec the program in the same process, so the limit of
+//supervisord itself is never changed. The arguments after the flag are the
+//nofile, the fd of the error pipe, the path and the argv of the program
+const nofileExecFlag = "--supervisord-nofile-exec"
+
+//the exit code of the helper if it fails to set the limit or exec the program
+const nofileExecFailure = 127
+
+func init() {
+	if len(os.Args) > 1 && os.Args[1] == nofileExecFlag {
+		execWithNofile(os.Args[2:])
+	}
+}
+
+//set the soft limit of open files and exec the program, the error is written
+//to the error pipe which is closed by the exec if it succeeds
+func execWithNofile(args []string) {
+	if len(args) < 4 {
+		fmt.Fprintf(os.Stderr, "%s: not enough arguments\n", nofileExecFlag)
+		os.Exit(nofileExecFailure)
+	}
+	fd, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid error pipe %s\n", nofileExecFlag, args[1])
+		os.Exit(nofileExecFailure)
+	}
+	errPipe := os.NewFile(uintptr(fd), "nofile-error")
+	syscall.CloseOnExec(fd)
+	fail := func(err error) {
+		fmt.Fprint(errPipe, err.Error())
+		os.Exit(nofileExecFailure)
+	}
+	nofile, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		fail(fmt.Errorf("invalid nofile %s", args[0]))
+	}
+	var limit syscall.Rlimit
+	if err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		fail(fmt.Errorf("fail to get the limit of open files: %v", err))
+	}
+	limit.Cur = nofile
+	if err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		fail(fmt.Errorf("fail to set the limit of open files to %d: %v", nofile, err))
+	}
+	err = syscall.Exec(args[2], args[3:], os.Environ())
+	fail(fmt.Errorf("fail to exec %s: %v", args[2], err))
+}
+
+//get the soft limit of open files of the program, 0 means the limit of
+//supervisord is inherited. It can't exceed the hard limit of supervisord
+func (p *Process) getNofile() (uint64, error) {
+	s := p.config.GetString("nofile", "")
+	if s == "" {
+		return 0, nil
+	}
+	nofile, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || nofile == 0 {
+		return 0, fmt.Errorf("invalid nofile %s", s)
+	}
+	var limit syscall.Rlimit
+	if err = syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, fmt.Errorf("fail to get the limit of open files: %v", err)
+	}
+	if nofile > limit.Max {
+		return 0, fmt.Errorf("nofile %d exceeds the hard limit %d of open files", nofile, limit.Max)
+	}
+	return nofile, nil
+}
+
+//start the command by supervisord itself which sets the soft limit of open
+//files to nofile before it execs the command, so the pid and the argv of the
+//program are not changed. An error is returned if the limit can't be set or
+//the command can't be executed. The command is started directly if nofile
+//is 0
+func startWithNofile(cmd *exec.Cmd, nofile uint64, umask int) error {
+	if nofile == 0 {
+		return startWithUmask(cmd, umask)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	path, argv, extraFiles := cmd.Path, cmd.Args, cmd.ExtraFiles
+	fd := 3 + len(extraFiles)
+	cmd.ExtraFiles = append(extraFiles, w)
+	args := []string{"/proc/self/exe", nofileExecFlag, strconv.FormatUint(nofile, 10), strconv.Itoa(fd), path}
+	cmd.Args = append(args, argv...)
+	cmd.Path = "/proc/self/exe"
+	err = startWithUmask(cmd, umask)
+	w.Close()
+	//the command describes the program after it is started
+	cmd.Path, cmd.Args, cmd.ExtraFiles = path, argv, extraFiles
+	if err != nil {
+		return err
+	}
+	//the pipe is closed without any error after the program is executed
+	b, _ := ioutil.ReadAll(r)
+	if len(b) > 0 {
+		cmd.Wait()
+		return fmt.Errorf("fail to set nofile: %s", strings.TrimSpace(string(b)))
+	}
+	return nil
+}
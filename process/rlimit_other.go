@@ -0,0 +1,20 @@
+// +build !linux
+
+package process
+
+import (
+	"errors"
+	"os/exec"
+)
+
+//the limit of open files of a program is only supported in linux
+func (p *Process) getNofile() (uint64, error) {
+	if p.config.GetString("nofile", "") == "" {
+		return 0, nil
+	}
+	return 0, errors.New("nofile is not supported in this platform")
+}
+
+func startWithNofile(cmd *exec.Cmd, nofile uint64, umask int) error {
+	return startWithUmask(cmd, umask)
+}
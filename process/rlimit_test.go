@@ -0,0 +1,135 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+//wait until the program writes the output file
+func readOutput(name string) string {
+	for i := 0; i < 50; i++ {
+		if b, err := ioutil.ReadFile(name); err == nil && len(b) > 0 {
+			return strings.TrimSpace(string(b))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return ""
+}
+
+func TestNofile(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the nofile is only supported in linux")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	nofileOut := filepath.Join(dir, "nofile.out")
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "ulimit -Sn > %s; exec sleep 60"
+startsecs=0
+nofile=100
+`, nofileOut))
+	var limit, startLimit syscall.Rlimit
+	syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)
+	proc.Start(true)
+	defer proc.Stop(true)
+	if s := readOutput(nofileOut); s != "100" {
+		t.Errorf("The soft limit of open files is not set by nofile, got %s", s)
+	}
+	//the limit of supervisord is not changed to start the program
+	syscall.Getrlimit(syscall.RLIMIT_NOFILE, &startLimit)
+	if startLimit != limit {
+		t.Errorf("The limit of open files of supervisord is changed to %v from %v", startLimit, limit)
+	}
+
+	//the other programs still get the limit of supervisord
+	expected, err := exec.Command("/bin/sh", "-c", "ulimit -Sn").Output()
+	if err != nil {
+		t.Fatalf("Fail to get the limit of open files: %v", err)
+	}
+	defaultOut := filepath.Join(dir, "default.out")
+	other := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sh -c "ulimit -Sn > %s; exec sleep 60"
+startsecs=0
+`, defaultOut))
+	other.Start(true)
+	defer other.Stop(true)
+	if s := readOutput(defaultOut); s != strings.TrimSpace(string(expected)) {
+		t.Errorf("The limit of open files of the other program is changed, got %s, expected %s", s, expected)
+	}
+}
+
+func TestNofileKeepsArgv(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the nofile is only supported in linux")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	cmdlineOut := filepath.Join(dir, "cmdline.out")
+	//the argv[0] "sh" is not the path of the program found in PATH
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=sh -c "cat /proc/$$/cmdline > %s; exec sleep 60"
+startsecs=0
+nofile=100
+`, cmdlineOut))
+	proc.Start(true)
+	defer proc.Stop(true)
+	argv := strings.Split(strings.TrimRight(readOutput(cmdlineOut), "\x00"), "\x00")
+	if len(argv) != 3 || argv[0] != "sh" || argv[1] != "-c" {
+		t.Errorf("The argv of the program is changed by nofile: %q", argv)
+	}
+	//the program is executed in the started process
+	cmdline := ""
+	for i := 0; i < 50 && !strings.HasPrefix(cmdline, "sleep\x0060"); i++ {
+		time.Sleep(100 * time.Millisecond)
+		cmdline = readOutput(fmt.Sprintf("/proc/%d/cmdline", proc.GetPid()))
+	}
+	if !strings.HasPrefix(cmdline, "sleep\x0060") {
+		t.Errorf("The pid of the program should be the pid of the started process, cmdline=%q", cmdline)
+	}
+}
+
+func TestNofileExecFailure(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the nofile is only supported in linux")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	//the program can't be executed without the permission
+	program := filepath.Join(dir, "program")
+	ioutil.WriteFile(program, []byte("#!/bin/sh\nsleep 60\n"), 0644)
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=%s
+startsecs=0
+nofile=100
+`, program))
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "fail to exec "+program) {
+		t.Errorf("The program failing to exec should be FATAL, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+}
+
+func TestNofileExceedingHardLimit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the nofile is only supported in linux")
+	}
+	out, err := exec.Command("/bin/sh", "-c", "ulimit -Hn").Output()
+	hard := strings.TrimSpace(string(out))
+	if err != nil || hard == "unlimited" {
+		t.Skip("no hard limit of open files")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, fmt.Sprintf(`command=/bin/sleep 60
+nofile=%s0
+`, hard))
+	proc.Start(true)
+	defer proc.Stop(true)
+	if proc.GetState() != FATAL || !strings.Contains(proc.GetSpawnErr(), "hard limit") {
+		t.Errorf("The program exceeding the hard limit should be FATAL, state=%v, spawnerr=%s", proc.GetState(), proc.GetSpawnErr())
+	}
+}
@@ -3,9 +3,20 @@
 package process
 
 import (
+	"fmt"
+	"os"
 	"syscall"
 )
 
-func set_user_id(procAttr *syscall.SysProcAttr, uid uint32, gid uint32) {
-	procAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid, NoSetGroups: true}
+//run the program as the user, only root can run a program as other user or
+//group. The supplementary groups of supervisord are replaced by the groups
+func set_user_id(procAttr *syscall.SysProcAttr, uid uint32, gid uint32, groups []uint32) error {
+	if os.Getuid() != 0 {
+		if uint32(os.Getuid()) == uid && uint32(os.Getgid()) == gid {
+			return nil
+		}
+		return fmt.Errorf("supervisord is not run as root")
+	}
+	procAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid, Groups: groups}
+	return nil
 }
@@ -6,6 +6,6 @@ import (
 	"syscall"
 )
 
-func set_user_id(_ *syscall.SysProcAttr, _ uint32, _ uint32) {
-
+func set_user_id(_ *syscall.SysProcAttr, _ uint32, _ uint32, _ []uint32) error {
+	return nil
 }
@@ -0,0 +1,72 @@
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+// the resource usage of the process is sampled at most once in this interval,
+// the callers in the interval get the cached sample
+const statsSampleInterval = time.Second
+
+// ResourceStats is a sample of the resource usage of a running program
+type ResourceStats struct {
+	Pid int
+	//the cpu usage percent since the previous sample, or since the program
+	//is started for the first sample
+	CpuPercent float64
+	//the total cpu time in seconds
+	CpuTime float64
+	//the resident memory in bytes
+	Rss int64
+	//the virtual memory in bytes
+	Vms int64
+	//when the sample is taken
+	SampleTime time.Time
+}
+
+// Get the resource usage of the running program, it is sampled from the
+// /proc filesystem and only linux is supported
+func (p *Process) GetStats() (ResourceStats, error) {
+	p.lock.RLock()
+	pid := 0
+	if p.state == RUNNING || p.state == STARTING || p.state == STOPPING {
+		pid = p.cmd.Process.Pid
+	}
+	startTime := p.startTime
+	p.lock.RUnlock()
+	if pid == 0 {
+		return ResourceStats{}, fmt.Errorf("the program is not running")
+	}
+
+	p.statsLock.Lock()
+	defer p.statsLock.Unlock()
+	prev := p.stats
+	now := time.Now()
+	if prev.Pid == pid && now.Sub(prev.SampleTime) < statsSampleInterval {
+		return prev, nil
+	}
+	cpuTime, _, err := getResourceUsage(pid)
+	if err != nil {
+		return ResourceStats{}, err
+	}
+	rss, vms, err := getMemoryUsage(pid)
+	if err != nil {
+		return ResourceStats{}, err
+	}
+	stats := ResourceStats{Pid: pid, CpuTime: cpuTime, Rss: rss, Vms: vms, SampleTime: now}
+	if prev.Pid == pid {
+		stats.CpuPercent = cpuPercent(cpuTime-prev.CpuTime, now.Sub(prev.SampleTime))
+	} else {
+		stats.CpuPercent = cpuPercent(cpuTime, now.Sub(startTime))
+	}
+	p.stats = stats
+	return stats, nil
+}
+
+func cpuPercent(cpuTime float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 || cpuTime < 0 {
+		return 0
+	}
+	return cpuTime / elapsed.Seconds() * 100
+}
@@ -0,0 +1,38 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGetStats(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the resource usage is only supported in linux")
+	}
+	dir, _ := ioutil.TempDir("", "process")
+	defer os.RemoveAll(dir)
+	proc := createTestProcess(t, dir, "command=/bin/sh -c \"while true; do :; done\"\nstartsecs=0\n")
+	if _, err := proc.GetStats(); err == nil {
+		t.Error("The stats of stopped program should not be available")
+	}
+
+	proc.Start(false)
+	defer proc.Stop(true)
+	time.Sleep(200 * time.Millisecond)
+	stats, err := proc.GetStats()
+	if err != nil || stats.Pid != proc.GetPid() || stats.Rss <= 0 || stats.Vms < stats.Rss {
+		t.Fatalf("Fail to get the stats, stats=%v, err=%v", stats, err)
+	}
+	// the sample is cached in the sample interval
+	if cached, _ := proc.GetStats(); cached != stats {
+		t.Error("The stats should be cached")
+	}
+	time.Sleep(statsSampleInterval)
+	next, err := proc.GetStats()
+	if err != nil || !next.SampleTime.After(stats.SampleTime) || next.CpuPercent < 10 {
+		t.Errorf("Fail to sample the stats again, stats=%v, err=%v", next, err)
+	}
+}
@@ -0,0 +1,27 @@
+// +build !windows
+
+package process
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+//the umask is shared by the whole supervisord, the programs are started
+//one by one if they have umask
+var umaskLock sync.Mutex
+
+//start the command with the umask, the umask of supervisord is restored
+//after the command is started. A negative umask means the umask of
+//supervisord is inherited
+func startWithUmask(cmd *exec.Cmd, umask int) error {
+	if umask < 0 {
+		return cmd.Start()
+	}
+	umaskLock.Lock()
+	defer umaskLock.Unlock()
+	oldUmask := syscall.Umask(umask)
+	defer syscall.Umask(oldUmask)
+	return cmd.Start()
+}
@@ -0,0 +1,12 @@
+// +build windows
+
+package process
+
+import (
+	"os/exec"
+)
+
+//umask is not supported in windows
+func startWithUmask(cmd *exec.Cmd, umask int) error {
+	return cmd.Start()
+}
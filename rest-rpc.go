@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/csxuejin/gorilla-xmlrpc/xml"
+	"github.com/csxuejin/supervisord/faults"
 	"github.com/csxuejin/supervisord/types"
 	"github.com/gorilla/mux"
 )
@@ -23,9 +26,107 @@ func (sr *SupervisorRestful) CreateHandler() http.Handler {
 	sr.router.HandleFunc("/program/start/{name}", sr.StartProgram).Methods("POST", "PUT")
 	sr.router.HandleFunc("/program/stop/{name}", sr.StopProgram).Methods("POST", "PUT")
 	sr.router.HandleFunc("/program/log/{name}/stdout", sr.ReadStdoutLog).Methods("GET")
+	sr.router.HandleFunc("/api/v1/processes", sr.ListProcesses).Methods("GET")
+	sr.router.HandleFunc("/api/v1/processes/{name}", sr.GetProcess).Methods("GET")
+	sr.router.HandleFunc("/api/v1/processes/{name}/config", sr.GetProcessConfig).Methods("GET")
+	sr.router.HandleFunc("/api/v1/processes/{name}/{action:start|stop|restart}", sr.ChangeProcessState).Methods("POST")
 	return sr.router
 }
 
+// write the value as json with the http status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// write the error as json {"code": <fault code>, "error": <message>}, the
+// http status is 404 for an unknown process
+func writeJSONError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	code := faults.FAILED
+	var fault xml.Fault
+	if errors.As(err, &fault) {
+		code = fault.Code
+		if code == faults.BAD_NAME {
+			status = http.StatusNotFound
+		}
+	}
+	writeJSON(w, status, map[string]interface{}{"code": code, "error": err.Error()})
+}
+
+// list the status of all the processes
+//
+// GET /api/v1/processes returns a json array of types.ProcessInfo
+func (sr *SupervisorRestful) ListProcesses(w http.ResponseWriter, req *http.Request) {
+	result := struct{ AllProcessInfo []types.ProcessInfo }{make([]types.ProcessInfo, 0)}
+	if err := sr.supervisor.GetAllProcessInfo(req, nil, &result); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result.AllProcessInfo)
+}
+
+// get the status of a process
+//
+// GET /api/v1/processes/{name} returns the types.ProcessInfo of the process
+func (sr *SupervisorRestful) GetProcess(w http.ResponseWriter, req *http.Request) {
+	result := struct{ ProcInfo types.ProcessInfo }{}
+	if err := sr.supervisor.GetProcessInfo(req, &struct{ Name string }{mux.Vars(req)["name"]}, &result); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result.ProcInfo)
+}
+
+// get the resolved configuration the process is started with
+//
+// GET /api/v1/processes/{name}/config returns the
+// types.ProcessEffectiveConfig of the process
+func (sr *SupervisorRestful) GetProcessConfig(w http.ResponseWriter, req *http.Request) {
+	result := struct{ Config types.ProcessEffectiveConfig }{}
+	if err := sr.supervisor.GetEffectiveConfig(req, &struct{ Name string }{mux.Vars(req)["name"]}, &result); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result.Config)
+}
+
+// start, stop or restart a process and wait for it
+//
+// POST /api/v1/processes/{name}/{start|stop|restart} returns the
+// types.ProcessInfo of the process after the action
+func (sr *SupervisorRestful) ChangeProcessState(w http.ResponseWriter, req *http.Request) {
+	params := mux.Vars(req)
+	info := struct{ ProcInfo types.ProcessInfo }{}
+	nameArgs := struct{ Name string }{params["name"]}
+	if err := sr.supervisor.GetProcessInfo(req, &nameArgs, &info); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	args := StartProcessArgs{Name: params["name"], Wait: true}
+	result := struct{ Success bool }{false}
+	var err error
+	switch params["action"] {
+	case "start":
+		err = sr.supervisor.StartProcess(req, &args, &result)
+	case "stop":
+		err = sr.supervisor.StopProcess(req, &args, &result)
+	case "restart":
+		if err = sr.supervisor.StopProcess(req, &args, &result); err == nil {
+			err = sr.supervisor.StartProcess(req, &args, &result)
+		}
+	}
+	if err == nil {
+		err = sr.supervisor.GetProcessInfo(req, &nameArgs, &info)
+	}
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info.ProcInfo)
+}
+
 // list the status of all the programs
 //
 // json array to present the status of all programs
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csxuejin/supervisord/types"
+)
+
+// create a supervisor with the programs in the config, the programs are
+// not started
+func createTestSupervisor(t *testing.T, dir string, configContent string) *Supervisor {
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte(configContent), os.ModePerm)
+	s := NewSupervisor(configFile)
+	if _, err := s.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	s.createPrograms(nil)
+	return s
+}
+
+func doRestRequest(handler http.Handler, method string, url string, v interface{}) int {
+	req := httptest.NewRequest(method, url, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	json.NewDecoder(w.Body).Decode(v)
+	return w.Code
+}
+
+func TestRestProcessesAPI(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:test]\ncommand=/bin/sleep 60\nstartsecs=0\nautostart=false\n")
+	handler := NewSupervisorRestful(s).CreateHandler()
+
+	var infos []types.ProcessInfo
+	if code := doRestRequest(handler, "GET", "/api/v1/processes", &infos); code != 200 || len(infos) != 1 || infos[0].Name != "test" {
+		t.Errorf("Fail to list the processes, code=%d, processes=%v", code, infos)
+	}
+	var info types.ProcessInfo
+	if code := doRestRequest(handler, "POST", "/api/v1/processes/test/start", &info); code != 200 || info.Statename != "RUNNING" || info.Pid == 0 {
+		t.Errorf("Fail to start the process, code=%d, info=%v", code, info)
+	}
+	pid := info.Pid
+	if code := doRestRequest(handler, "POST", "/api/v1/processes/test/restart", &info); code != 200 || info.Statename != "RUNNING" || info.Pid == pid {
+		t.Errorf("Fail to restart the process, code=%d, info=%v", code, info)
+	}
+	if code := doRestRequest(handler, "POST", "/api/v1/processes/test/stop", &info); code != 200 || info.Statename != "STOPPED" {
+		t.Errorf("Fail to stop the process, code=%d, info=%v", code, info)
+	}
+	if code := doRestRequest(handler, "GET", "/api/v1/processes/test", &info); code != 200 || info.Name != "test" || info.Statename != "STOPPED" {
+		t.Errorf("Fail to get the process, code=%d, info=%v", code, info)
+	}
+}
+
+func TestRestUnknownProcess(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:test]\ncommand=/bin/sleep 60\nautostart=false\n")
+	handler := NewSupervisorRestful(s).CreateHandler()
+
+	result := make(map[string]interface{})
+	if code := doRestRequest(handler, "GET", "/api/v1/processes/none", &result); code != 404 || result["error"] == nil {
+		t.Errorf("Unknown process should not be found, code=%d, result=%v", code, result)
+	}
+	if code := doRestRequest(handler, "POST", "/api/v1/processes/none/start", &result); code != 404 {
+		t.Errorf("Unknown process should not be started, code=%d", code)
+	}
+}
+
+func TestRestProcessConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:test]\ncommand=/bin/sleep 60\ndirectory=%(here)s\nautostart=false\n")
+	handler := NewSupervisorRestful(s).CreateHandler()
+
+	var config types.ProcessEffectiveConfig
+	if code := doRestRequest(handler, "GET", "/api/v1/processes/test/config", &config); code != 200 || config.Name != "test" || len(config.Argv) != 2 || config.Directory != dir {
+		t.Errorf("Fail to get the process config, code=%d, config=%v", code, config)
+	}
+	result := make(map[string]interface{})
+	if code := doRestRequest(handler, "GET", "/api/v1/processes/none/config", &result); code != 404 {
+		t.Errorf("Unknown process should not be found, code=%d", code)
+	}
+}
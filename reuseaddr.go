@@ -0,0 +1,25 @@
+// +build !windows
+
+package main
+
+import (
+	"strings"
+	"syscall"
+)
+
+// set SO_REUSEADDR on the tcp socket before binding it, so the address can
+// be bound again at once after supervisord is restarted even if the
+// connections of the previous one are still in TIME_WAIT
+func setReuseAddr(network string, address string, c syscall.RawConn) error {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil
+	}
+	var opErr error
+	err := c.Control(func(fd uintptr) {
+		opErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return opErr
+}
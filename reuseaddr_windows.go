@@ -0,0 +1,11 @@
+// +build windows
+
+package main
+
+import "syscall"
+
+// SO_REUSEADDR is not set on Windows because it allows another socket to
+// bind the same address while supervisord is listening on it
+func setReuseAddr(network string, address string, c syscall.RawConn) error {
+	return nil
+}
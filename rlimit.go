@@ -0,0 +1,63 @@
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/csxuejin/supervisord/config"
+)
+
+// the RLIMIT_NPROC of linux, it is not defined in package syscall. It is 8
+// on mips, so the limits are not checked there
+const RLIMIT_NPROC = 6
+
+// the rlimit functions, they are replaced in the tests.
+//
+// syscall.Setrlimit of RLIMIT_NOFILE drops the original soft limit which go
+// restores in the child processes, it is deliberate: the programs inherit
+// the soft limit raised to minfds like the python supervisord
+var getrlimit = syscall.Getrlimit
+var setrlimit = syscall.Setrlimit
+
+// the minimum of a resource required by the setting of the supervisord
+// section
+type requiredResource struct {
+	setting  string
+	resource int
+	name     string
+}
+
+var requiredResources = []requiredResource{
+	{setting: "minfds", resource: syscall.RLIMIT_NOFILE, name: "file descriptors"},
+	{setting: "minprocs", resource: RLIMIT_NPROC, name: "processes"},
+}
+
+// check the "minfds" and "minprocs" of the supervisord section. The soft
+// limit is raised to the minimum if it is lower, an error is returned if
+// the hard limit is lower than the minimum
+func checkRequiredResources(supervisordConf *config.ConfigEntry) error {
+	for _, required := range requiredResources {
+		min := supervisordConf.GetInt(required.setting, 0)
+		if min <= 0 {
+			continue
+		}
+		var limit syscall.Rlimit
+		if err := getrlimit(required.resource, &limit); err != nil {
+			return fmt.Errorf("fail to get the limit of %s: %v", required.name, err)
+		}
+		if limit.Cur >= uint64(min) {
+			continue
+		}
+		if limit.Max < uint64(min) {
+			return fmt.Errorf("the %s %d is required by \"%s\" but the environment only allows %d, raise the limit of %s or lower \"%s\"",
+				required.name, min, required.setting, limit.Max, required.name, required.setting)
+		}
+		limit.Cur = uint64(min)
+		if err := setrlimit(required.resource, &limit); err != nil {
+			return fmt.Errorf("fail to raise the limit of %s to %d: %v", required.name, min, err)
+		}
+	}
+	return nil
+}
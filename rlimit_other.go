@@ -0,0 +1,16 @@
+// +build !linux mips mipsle mips64 mips64le
+
+package main
+
+import (
+	"github.com/csxuejin/supervisord/config"
+	log "github.com/sirupsen/logrus"
+)
+
+// the "minfds" and "minprocs" are only checked in linux except mips
+func checkRequiredResources(supervisordConf *config.ConfigEntry) error {
+	if supervisordConf.GetInt("minfds", 0) > 0 || supervisordConf.GetInt("minprocs", 0) > 0 {
+		log.Warn("minfds and minprocs are not checked in this platform")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// replace the rlimits by the limits in the map until the returned function
+// is called
+func mockRlimits(limits map[int]*syscall.Rlimit) func() {
+	oldGetrlimit, oldSetrlimit := getrlimit, setrlimit
+	getrlimit = func(resource int, rlim *syscall.Rlimit) error {
+		*rlim = *limits[resource]
+		return nil
+	}
+	setrlimit = func(resource int, rlim *syscall.Rlimit) error {
+		*limits[resource] = *rlim
+		return nil
+	}
+	return func() {
+		getrlimit, setrlimit = oldGetrlimit, oldSetrlimit
+	}
+}
+
+func loadSupervisordConf(t *testing.T, content string) *Supervisor {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	return createTestSupervisor(t, dir, "[supervisord]\n"+content)
+}
+
+func TestRaiseRequiredResources(t *testing.T) {
+	limits := map[int]*syscall.Rlimit{
+		syscall.RLIMIT_NOFILE: {Cur: 256, Max: 4096},
+		RLIMIT_NPROC:          {Cur: 100, Max: 1000},
+	}
+	defer mockRlimits(limits)()
+
+	s := loadSupervisordConf(t, "minfds=1024\nminprocs=200\n")
+	supervisordConf, _ := s.config.GetSupervisord()
+	if err := checkRequiredResources(supervisordConf); err != nil {
+		t.Fatalf("Fail to check the required resources: %v", err)
+	}
+	if limits[syscall.RLIMIT_NOFILE].Cur != 1024 || limits[syscall.RLIMIT_NOFILE].Max != 4096 {
+		t.Errorf("The soft limit of file descriptors is not raised to minfds: %v", limits[syscall.RLIMIT_NOFILE])
+	}
+	if limits[RLIMIT_NPROC].Cur != 200 {
+		t.Errorf("The soft limit of processes is not raised to minprocs: %v", limits[RLIMIT_NPROC])
+	}
+}
+
+func TestRequiredResourcesExceedHardLimit(t *testing.T) {
+	limits := map[int]*syscall.Rlimit{
+		syscall.RLIMIT_NOFILE: {Cur: 8192, Max: 8192},
+		RLIMIT_NPROC:          {Cur: 100, Max: 150},
+	}
+	defer mockRlimits(limits)()
+
+	s := loadSupervisordConf(t, "minfds=1024\nminprocs=200\n")
+	supervisordConf, _ := s.config.GetSupervisord()
+	err := checkRequiredResources(supervisordConf)
+	if err == nil || !strings.Contains(err.Error(), "minprocs") || !strings.Contains(err.Error(), "150") {
+		t.Errorf("The hard limit lower than minprocs is not reported, err=%v", err)
+	}
+	if limits[syscall.RLIMIT_NOFILE].Cur != 8192 || limits[RLIMIT_NPROC].Cur != 100 {
+		t.Errorf("The limits should not be changed: %v, %v", limits[syscall.RLIMIT_NOFILE], limits[RLIMIT_NPROC])
+	}
+}
+
+func TestRequiredResourcesNotSet(t *testing.T) {
+	defer mockRlimits(map[int]*syscall.Rlimit{})()
+
+	s := loadSupervisordConf(t, "logfile=supervisord.log\n")
+	supervisordConf, _ := s.config.GetSupervisord()
+	if err := checkRequiredResources(supervisordConf); err != nil {
+		t.Errorf("The limits should not be checked without minfds and minprocs, err=%v", err)
+	}
+}
+
+func TestReloadKeepsConfigIfResourcesNotAvailable(t *testing.T) {
+	limits := map[int]*syscall.Rlimit{
+		syscall.RLIMIT_NOFILE: {Cur: 256, Max: 512},
+		RLIMIT_NPROC:          {Cur: 100, Max: 1000},
+	}
+	defer mockRlimits(limits)()
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[program:app]\ncommand=/bin/sleep 60\nautostart=false\n"), os.ModePerm)
+	s := NewSupervisor(configFile)
+	if _, err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	added := "[program:app]\ncommand=/bin/sleep 60\nautostart=false\n\n[program:added]\ncommand=/bin/sleep 60\nautostart=false\n"
+	ioutil.WriteFile(configFile, []byte("[supervisord]\nminfds=1024\n\n"+added), os.ModePerm)
+	if _, err := s.Reload(); err == nil || !strings.Contains(err.Error(), "minfds") {
+		t.Fatalf("The reload should fail for minfds, err=%v", err)
+	}
+	if s.config.GetProgram("added") != nil || s.procMgr.Find("added") != nil {
+		t.Error("The configuration failing the check should not be used")
+	}
+
+	// the program is added by the next reload
+	ioutil.WriteFile(configFile, []byte(added), os.ModePerm)
+	result, err := s.Reload()
+	if err != nil || strings.Join(result.AddedPrograms, ",") != "added" || s.procMgr.Find("added") == nil {
+		t.Errorf("The program should be added after the failed reload, result=%+v, err=%v", result, err)
+	}
+}
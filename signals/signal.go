@@ -3,32 +3,61 @@
 package signals
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"syscall"
 )
 
-//convert a signal name to signal
-func ToSignal(signalName string) (os.Signal, error) {
-	if signalName == "HUP" {
-		return syscall.SIGHUP, nil
-	} else if signalName == "INT" {
-		return syscall.SIGINT, nil
-	} else if signalName == "QUIT" {
-		return syscall.SIGQUIT, nil
-	} else if signalName == "KILL" {
-		return syscall.SIGKILL, nil
-	} else if signalName == "USR1" {
-		return syscall.SIGUSR1, nil
-	} else if signalName == "USR2" {
-		return syscall.SIGUSR2, nil
-	} else {
-		return syscall.SIGTERM, nil
+//the signals which can be sent to the programs by name
+var signalsByName = map[string]syscall.Signal{
+	"HUP":    syscall.SIGHUP,
+	"INT":    syscall.SIGINT,
+	"QUIT":   syscall.SIGQUIT,
+	"ILL":    syscall.SIGILL,
+	"TRAP":   syscall.SIGTRAP,
+	"ABRT":   syscall.SIGABRT,
+	"BUS":    syscall.SIGBUS,
+	"FPE":    syscall.SIGFPE,
+	"KILL":   syscall.SIGKILL,
+	"USR1":   syscall.SIGUSR1,
+	"SEGV":   syscall.SIGSEGV,
+	"USR2":   syscall.SIGUSR2,
+	"PIPE":   syscall.SIGPIPE,
+	"ALRM":   syscall.SIGALRM,
+	"TERM":   syscall.SIGTERM,
+	"CHLD":   syscall.SIGCHLD,
+	"CONT":   syscall.SIGCONT,
+	"STOP":   syscall.SIGSTOP,
+	"TSTP":   syscall.SIGTSTP,
+	"TTIN":   syscall.SIGTTIN,
+	"TTOU":   syscall.SIGTTOU,
+	"URG":    syscall.SIGURG,
+	"XCPU":   syscall.SIGXCPU,
+	"XFSZ":   syscall.SIGXFSZ,
+	"VTALRM": syscall.SIGVTALRM,
+	"PROF":   syscall.SIGPROF,
+	"WINCH":  syscall.SIGWINCH,
+	"IO":     syscall.SIGIO,
+	"SYS":    syscall.SIGSYS,
+}
 
+//convert a signal name like "TERM", "term" or "SIGTERM" to signal, an error
+//is returned for an unknown name
+func ToSignal(signalName string) (os.Signal, error) {
+	if sig, ok := signalsByName[strings.TrimPrefix(strings.ToUpper(signalName), "SIG")]; ok {
+		return sig, nil
 	}
-
+	return nil, fmt.Errorf("unknown signal %s", signalName)
 }
 
-func Kill(process *os.Process, sig os.Signal) error {
+//send signal to the process, the signal is sent to the process group of
+//the process if sigChildren is true
+func Kill(process *os.Process, sig os.Signal, sigChildren bool) error {
 	localSig := sig.(syscall.Signal)
-	return syscall.Kill(-process.Pid, localSig)
+	pid := process.Pid
+	if sigChildren {
+		pid = -pid
+	}
+	return syscall.Kill(pid, localSig)
 }
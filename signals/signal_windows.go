@@ -8,11 +8,14 @@ import (
 	log "github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
+	"strings"
 	"syscall"
 )
 
-//convert a signal name to signal
+//convert a signal name like "TERM", "term" or "SIGTERM" to signal, an error
+//is returned for an unknown name
 func ToSignal(signalName string) (os.Signal, error) {
+	signalName = strings.TrimPrefix(strings.ToUpper(signalName), "SIG")
 	if signalName == "HUP" {
 		return syscall.SIGHUP, nil
 	} else if signalName == "INT" {
@@ -21,6 +24,8 @@ func ToSignal(signalName string) (os.Signal, error) {
 		return syscall.SIGQUIT, nil
 	} else if signalName == "KILL" {
 		return syscall.SIGKILL, nil
+	} else if signalName == "TERM" {
+		return syscall.SIGTERM, nil
 	} else if signalName == "USR1" {
 		log.Warn("signal USR1 is not supported in windows")
 		return nil, errors.New("signal USR1 is not supported in windows")
@@ -28,15 +33,18 @@ func ToSignal(signalName string) (os.Signal, error) {
 		log.Warn("signal USR2 is not supported in windows")
 		return nil, errors.New("signal USR2 is not supported in windows")
 	} else {
-		return syscall.SIGTERM, nil
-
+		return nil, fmt.Errorf("unknown signal %s", signalName)
 	}
-
 }
 
-func Kill(process *os.Process, sig os.Signal) error {
+func Kill(process *os.Process, sig os.Signal, sigChildren bool) error {
 	//Signal command can't kill children processes, call  taskkill command to kill them
-	cmd := exec.Command("taskkill", "/F", "/T", "/PID", fmt.Sprintf("%d", process.Pid))
+	args := []string{"/F"}
+	if sigChildren {
+		args = append(args, "/T")
+	}
+	args = append(args, "/PID", fmt.Sprintf("%d", process.Pid))
+	cmd := exec.Command("taskkill", args...)
 	err := cmd.Start()
 	if err == nil {
 		return cmd.Wait()
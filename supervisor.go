@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/csxuejin/supervisord/config"
@@ -21,15 +22,27 @@ import (
 )
 
 const (
+	// the version of the xml-rpc API, not the version of supervisord
 	SUPERVISOR_VERSION = "3.0"
 )
 
+// the time when the supervisord process is started
+var daemonStartTime = time.Now()
+
 type Supervisor struct {
 	config     *config.Config
 	procMgr    *process.ProcessManager
 	xmlRPC     *XmlRPC
 	logger     logger.Logger
 	restarting bool
+	// 1 if the supervisord is shutting down, it is set and read atomically
+	shuttingDown int32
+	// the processes are stopped once by SIGTERM and the shutdown request
+	shutdownOnce sync.Once
+	// the configuration is reloaded by SIGHUP and reloadConfig one by one,
+	// the groups and programs are added or removed with the loaded
+	// configuration
+	configLock sync.RWMutex
 }
 
 type StartProcessArgs struct {
@@ -70,9 +83,23 @@ type ProcessLogReadInfo struct {
 	Length int
 }
 
+// ProcessLogBackupReadInfo is the arguments to read the rotated backup
+// "<logfile>.<Index>" of a process log
+type ProcessLogBackupReadInfo struct {
+	Name   string
+	Index  int
+	Offset int
+	Length int
+}
+
+// ProcessTailLog is the result of tailProcessStdoutLog. The Offset is encoded
+// as <int> with all its digits by the xml-rpc codec, the codec only supports
+// int which is 64 bits on the 64 bits platforms, so the offset beyond 2GiB
+// round-trips there. On the 32 bits platforms a FAILED fault is returned
+// instead of a wrapped offset
 type ProcessTailLog struct {
 	LogData  string
-	Offset   int64
+	Offset   int
 	Overflow bool
 }
 
@@ -80,6 +107,7 @@ func NewSupervisor(configFile string) *Supervisor {
 	return &Supervisor{config: config.NewConfig(configFile),
 		procMgr:    process.NewProcessManager(),
 		xmlRPC:     NewXmlRPC(),
+		logger:     logger.NewNullLogger(logger.NewNullLogEventEmitter()),
 		restarting: false}
 }
 
@@ -93,7 +121,7 @@ func (s *Supervisor) GetVersion(r *http.Request, args *struct{}, reply *struct{
 }
 
 func (s *Supervisor) GetSupervisorVersion(r *http.Request, args *struct{}, reply *struct{ Version string }) error {
-	reply.Version = SUPERVISOR_VERSION
+	reply.Version = VERSION
 	return nil
 }
 
@@ -118,8 +146,16 @@ func (s *Supervisor) GetState(r *http.Request, args *struct{}, reply *struct{ St
 	// 0            RESTARTING
 	// -1           SHUTDOWN
 	log.Debug("Get state")
-	reply.StateInfo.Statecode = 1
-	reply.StateInfo.Statename = "RUNNING"
+	if s.isShuttingDown() {
+		reply.StateInfo.Statecode = -1
+		reply.StateInfo.Statename = "SHUTDOWN"
+	} else if s.IsRestarting() {
+		reply.StateInfo.Statecode = 0
+		reply.StateInfo.Statename = "RESTARTING"
+	} else {
+		reply.StateInfo.Statecode = 1
+		reply.StateInfo.Statename = "RUNNING"
+	}
 	return nil
 }
 
@@ -134,6 +170,19 @@ func (s *Supervisor) GetPID(r *http.Request, args *struct{}, reply *struct{ Pid
 	return nil
 }
 
+// GetDaemonInfo gets the pid, the start time and the configuration file of
+// supervisord, the start time is not changed by reloading the configuration
+func (s *Supervisor) GetDaemonInfo(r *http.Request, args *struct{}, reply *struct{ DaemonInfo types.DaemonInfo }) error {
+	start := int(daemonStartTime.Unix())
+	now := int(time.Now().Unix())
+	reply.DaemonInfo = types.DaemonInfo{Pid: os.Getpid(),
+		Start:      start,
+		Now:        now,
+		Uptime:     now - start,
+		Configfile: s.config.GetConfigFile()}
+	return nil
+}
+
 func (s *Supervisor) ReadLog(r *http.Request, args *LogReadInfo, reply *struct{ Log string }) error {
 	data, err := s.logger.ReadLog(int64(args.Offset), int64(args.Length))
 	reply.Log = data
@@ -149,14 +198,32 @@ func (s *Supervisor) ClearLog(r *http.Request, args *struct{}, reply *struct{ Re
 func (s *Supervisor) Shutdown(r *http.Request, args *struct{}, reply *struct{ Ret bool }) error {
 	reply.Ret = true
 	log.Info("received rpc request to stop all processes & exit")
-	s.procMgr.StopAllProcesses()
 	go func() {
+		//reply the rpc request before shutting down
 		time.Sleep(1 * time.Second)
-		os.Exit(0)
+		s.ShutdownAndExit(0)
 	}()
 	return nil
 }
 
+// stop all the processes in the reverse order of starting them and exit. It
+// only runs once, a later call blocks until supervisord exits
+func (s *Supervisor) ShutdownAndExit(exitCode int) {
+	s.shutdownOnce.Do(func() {
+		atomic.StoreInt32(&s.shuttingDown, 1)
+		s.procMgr.StopAllProcesses()
+		log.Info("all the processes are stopped, exit")
+		exit(exitCode)
+	})
+}
+
+// exit supervisord, it is replaced in the tests
+var exit = os.Exit
+
+func (s *Supervisor) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
 func (s *Supervisor) Restart(r *http.Request, args *struct{}, reply *struct{ Ret bool }) error {
 	log.Info("Receive instruction to restart")
 	s.restarting = true
@@ -170,19 +237,25 @@ func (s *Supervisor) IsRestarting() bool {
 
 func getProcessInfo(proc *process.Process) *types.ProcessInfo {
 	return &types.ProcessInfo{Name: proc.GetName(),
-		Group:          proc.GetGroup(),
-		Description:    proc.GetDescription(),
-		Start:          int(proc.GetStartTime().Unix()),
-		Stop:           int(proc.GetStopTime().Unix()),
-		Now:            int(time.Now().Unix()),
-		State:          int(proc.GetState()),
-		Statename:      proc.GetState().String(),
-		Spawnerr:       "",
-		Exitstatus:     proc.GetExitstatus(),
-		Logfile:        proc.GetStdoutLogfile(),
-		Stdout_logfile: proc.GetStdoutLogfile(),
-		Stderr_logfile: proc.GetStderrLogfile(),
-		Pid:            proc.GetPid()}
+		Group:           proc.GetGroup(),
+		Description:     proc.GetDescription(),
+		Start:           int(proc.GetStartTime().Unix()),
+		Stop:            int(proc.GetStopTime().Unix()),
+		Now:             int(time.Now().Unix()),
+		State:           int(proc.GetState()),
+		Statename:       proc.GetState().String(),
+		Spawnerr:        proc.GetSpawnErr(),
+		Exitstatus:      proc.GetExitstatus(),
+		Logfile:         proc.GetStdoutLogfile(),
+		Stdout_logfile:  proc.GetStdoutLogfile(),
+		Stderr_logfile:  proc.GetStderrLogfile(),
+		Pid:             proc.GetPid(),
+		Health:          proc.GetHealth(),
+		Ready:           proc.GetReady(),
+		Restarts:        proc.GetRestarts(),
+		Last_exitstatus: proc.GetLastExitStatus(),
+		Backoff:         proc.GetBackoffDelay().Seconds(),
+		Restart_reason:  proc.GetRestartReason()}
 
 }
 
@@ -196,22 +269,148 @@ func (s *Supervisor) GetAllProcessInfo(r *http.Request, args *struct{}, reply *s
 	return nil
 }
 
+// get the information of the processes in the group, a BAD_NAME fault is
+// returned if no process is in the group
+func (s *Supervisor) GetGroupProcessInfo(r *http.Request, args *struct{ Name string }, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+	reply.AllProcessInfo = make([]types.ProcessInfo, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		if proc.GetGroup() == args.Name {
+			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
+		}
+	})
+	if len(reply.AllProcessInfo) <= 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	return nil
+}
+
+// GetProcessStates gets the name, state and pid of all the processes, the
+// reply is much smaller than getAllProcessInfo
+func (s *Supervisor) GetProcessStates(r *http.Request, args *struct{}, reply *struct{ States []types.ProcessStateInfo }) error {
+	reply.States = make([]types.ProcessStateInfo, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		state := proc.GetState()
+		reply.States = append(reply.States, types.ProcessStateInfo{Name: proc.GetName(),
+			Group:     proc.GetGroup(),
+			State:     int(state),
+			Statename: state.String(),
+			Pid:       proc.GetPid()})
+	})
+	return nil
+}
+
+func (s *Supervisor) GetAllConfigInfo(r *http.Request, args *struct{}, reply *struct{ ConfigInfo []types.ProcessConfigInfo }) error {
+	reply.ConfigInfo = make([]types.ProcessConfigInfo, 0)
+	for _, entry := range s.config.GetPrograms() {
+		name := entry.GetProgramName()
+		reply.ConfigInfo = append(reply.ConfigInfo, types.ProcessConfigInfo{Name: name,
+			Group:           entry.Group,
+			Inuse:           s.procMgr.Find(name) != nil,
+			Autostart:       entry.GetString("autostart", "true") == "true",
+			Autorestart:     entry.GetString("autorestart", "unexpected"),
+			Command:         entry.GetStringExpression("command", ""),
+			Directory:       entry.GetStringExpression("directory", ""),
+			Exitcodes:       entry.GetString("exitcodes", "0,2"),
+			Process_prio:    entry.GetInt("priority", 999),
+			Startsecs:       entry.GetInt("startsecs", 1),
+			Startretries:    entry.GetInt("startretries", 3),
+			Stopsignal:      entry.GetString("stopsignal", "TERM"),
+			Stopwaitsecs:    entry.GetInt("stopwaitsecs", 10),
+			Redirect_stderr: entry.GetBool("redirect_stderr", false),
+			Stdout_logfile:  entry.GetStringExpression("stdout_logfile", "/dev/null"),
+			Stderr_logfile:  entry.GetStringExpression("stderr_logfile", "/dev/null"),
+			Environment:     entry.GetEnvironment()})
+	}
+	return nil
+}
+
 func (s *Supervisor) GetProcessInfo(r *http.Request, args *struct{ Name string }, reply *struct{ ProcInfo types.ProcessInfo }) error {
 	log.Debug("Get process info of: ", args.Name)
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("no process named %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 
 	reply.ProcInfo = *getProcessInfo(proc)
 	return nil
 }
 
+// get the cpu and memory usage of a running process, the usage is sampled at
+// most once a second
+func (s *Supervisor) GetProcessStats(r *http.Request, args *struct{ Name string }, reply *struct{ Stats types.ProcessStats }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	stats, err := proc.GetStats()
+	if err != nil {
+		return faults.NewFault(faults.NOT_RUNNING, fmt.Sprintf("NOT_RUNNING: %s, %v", args.Name, err))
+	}
+	reply.Stats = types.ProcessStats{Name: proc.GetName(),
+		Group:       proc.GetGroup(),
+		Pid:         stats.Pid,
+		Cpu_percent: stats.CpuPercent,
+		Cpu_time:    stats.CpuTime,
+		Rss:         int(stats.Rss),
+		Vms:         int(stats.Vms),
+		Now:         int(stats.SampleTime.Unix())}
+	return nil
+}
+
+// GetProcessLogInfo gets the log files of the process with their rotation
+// and whether the capture and events are enabled
+func (s *Supervisor) GetProcessLogInfo(r *http.Request, args *struct{ Name string }, reply *struct{ LogInfo types.ProcessLogInfo }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	stdout := proc.GetStdoutLogInfo()
+	stderr := proc.GetStderrLogInfo()
+	reply.LogInfo = types.ProcessLogInfo{Name: proc.GetName(),
+		Group:                   proc.GetGroup(),
+		Redirect_stderr:         proc.IsRedirectStderr(),
+		Stdout_logfile:          stdout.Logfile,
+		Stdout_logfile_maxbytes: int(stdout.MaxBytes),
+		Stdout_logfile_backups:  stdout.Backups,
+		Stdout_capture_enabled:  stdout.CaptureEnabled,
+		Stdout_events_enabled:   stdout.EventsEnabled,
+		Stderr_logfile:          stderr.Logfile,
+		Stderr_logfile_maxbytes: int(stderr.MaxBytes),
+		Stderr_logfile_backups:  stderr.Backups,
+		Stderr_capture_enabled:  stderr.CaptureEnabled,
+		Stderr_events_enabled:   stderr.EventsEnabled}
+	return nil
+}
+
+// GetEffectiveConfig gets the configuration the process is started with after
+// the expressions, the environment and the user are resolved
+func (s *Supervisor) GetEffectiveConfig(r *http.Request, args *struct{ Name string }, reply *struct{ Config types.ProcessEffectiveConfig }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	effective, err := proc.GetEffectiveConfig()
+	if err != nil {
+		return faults.NewFault(faults.FAILED, fmt.Sprintf("FAILED: %s, %v", args.Name, err))
+	}
+	reply.Config = types.ProcessEffectiveConfig{Name: proc.GetName(),
+		Group:       proc.GetGroup(),
+		Command:     effective.Command,
+		Argv:        effective.Args,
+		Directory:   effective.Directory,
+		Environment: effective.Environment,
+		User:        effective.User,
+		Uid:         effective.Uid,
+		Gid:         effective.Gid,
+		Umask:       effective.Umask}
+	return nil
+}
+
 func (s *Supervisor) StartProcess(r *http.Request, args *StartProcessArgs, reply *struct{ Success bool }) error {
 	proc := s.procMgr.Find(args.Name)
 
 	if proc == nil {
-		return fmt.Errorf("fail to find process %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	proc.Start(args.Wait)
 	reply.Success = true
@@ -242,7 +441,30 @@ func (s *Supervisor) StartProcessGroup(r *http.Request, args *StartProcessArgs,
 			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
 		}
 	})
+	if len(reply.AllProcessInfo) <= 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	return nil
+}
 
+// restart the processes in the group, the processes are restarted one by
+// one if "serialrestart" of the group is true
+func (s *Supervisor) RestartProcessGroup(r *http.Request, args *StartProcessArgs, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+	serial := false
+	s.configLock.RLock()
+	for _, entry := range s.config.GetGroups() {
+		if entry.GetGroupName() == args.Name {
+			serial = entry.GetBool("serialrestart", false)
+		}
+	}
+	s.configLock.RUnlock()
+	log.WithFields(log.Fields{"group": args.Name, "serial": serial}).Info("restart process group")
+	for _, proc := range s.procMgr.RestartGroup(args.Name, serial, args.Wait) {
+		reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
+	}
+	if len(reply.AllProcessInfo) <= 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
 	return nil
 }
 
@@ -250,13 +472,34 @@ func (s *Supervisor) StopProcess(r *http.Request, args *StartProcessArgs, reply
 	log.WithFields(log.Fields{"program": args.Name}).Info("stop process")
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("fail to find process %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	proc.Stop(args.Wait)
 	reply.Success = true
 	return nil
 }
 
+// stop the process with the signal instead of its stopsignal, the process
+// is killed if it is still running after stopwaitsecs
+func (s *Supervisor) StopProcessWithSignal(r *http.Request, args *types.ProcessSignal, reply *struct{ Success bool }) error {
+	log.WithFields(log.Fields{"program": args.Name, "signal": args.Signal}).Info("stop process with signal")
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	if !config.IsKnownSignal(args.Signal) {
+		return faults.NewFault(faults.BAD_SIGNAL, fmt.Sprintf("BAD_SIGNAL: %s", args.Signal))
+	}
+	switch proc.GetState() {
+	case process.STARTING, process.RUNNING, process.STOPPING:
+	default:
+		return faults.NewFault(faults.NOT_RUNNING, fmt.Sprintf("NOT_RUNNING: %s", args.Name))
+	}
+	proc.StopWithSignal(args.Signal, false)
+	reply.Success = true
+	return nil
+}
+
 func (s *Supervisor) StopProcessGroup(r *http.Request, args *StartProcessArgs, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
 	log.WithFields(log.Fields{"group": args.Name}).Info("stop process group")
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
@@ -265,6 +508,9 @@ func (s *Supervisor) StopProcessGroup(r *http.Request, args *StartProcessArgs, r
 			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
 		}
 	})
+	if len(reply.AllProcessInfo) <= 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
 	return nil
 }
 
@@ -288,40 +534,48 @@ func (s *Supervisor) SignalProcess(r *http.Request, args *types.ProcessSignal, r
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
 		reply.Success = false
-		return fmt.Errorf("No process named %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	sig, err := signals.ToSignal(args.Signal)
-	if err == nil {
-		proc.Signal(sig)
+	if err != nil {
+		return faults.NewFault(faults.BAD_SIGNAL, fmt.Sprintf("BAD_SIGNAL: %s", args.Signal))
 	}
+	proc.Signal(sig, false)
 	reply.Success = true
 	return nil
 }
 
-func (s *Supervisor) SignalProcessGroup(r *http.Request, args *types.ProcessSignal, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+// SignalProcessGroup sends the signal to every process in the group without
+// changing their states, the result of each process is replied in the order
+// of getGroupProcessInfo, false if the process is not running
+func (s *Supervisor) SignalProcessGroup(r *http.Request, args *types.ProcessSignal, reply *struct{ Results []bool }) error {
+	sig, err := signals.ToSignal(args.Signal)
+	if err != nil {
+		return faults.NewFault(faults.BAD_SIGNAL, fmt.Sprintf("BAD_SIGNAL: %s", args.Signal))
+	}
+	reply.Results = make([]bool, 0)
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
 		if proc.GetGroup() == args.Name {
-			sig, err := signals.ToSignal(args.Signal)
-			if err == nil {
-				proc.Signal(sig)
+			err := proc.Signal(sig, false)
+			if err != nil {
+				log.WithFields(log.Fields{"program": proc.GetName(), "signal": args.Signal}).Warn("fail to send signal to program: ", err)
 			}
+			reply.Results = append(reply.Results, err == nil)
 		}
 	})
-
-	s.procMgr.ForEachProcess(func(proc *process.Process) {
-		if proc.GetGroup() == args.Name {
-			reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
-		}
-	})
+	if len(reply.Results) <= 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
 	return nil
 }
 
-func (s *Supervisor) SignalAllProcesses(r *http.Request, args *types.ProcessSignal, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+func (s *Supervisor) SignalAllProcesses(r *http.Request, args *struct{ Signal string }, reply *struct{ AllProcessInfo []types.ProcessInfo }) error {
+	sig, err := signals.ToSignal(args.Signal)
+	if err != nil {
+		return faults.NewFault(faults.BAD_SIGNAL, fmt.Sprintf("BAD_SIGNAL: %s", args.Signal))
+	}
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
-		sig, err := signals.ToSignal(args.Signal)
-		if err == nil {
-			proc.Signal(sig)
-		}
+		proc.Signal(sig, false)
 	})
 	s.procMgr.ForEachProcess(func(proc *process.Process) {
 		reply.AllProcessInfo = append(reply.AllProcessInfo, *getProcessInfo(proc))
@@ -333,19 +587,20 @@ func (s *Supervisor) SendProcessStdin(r *http.Request, args *ProcessStdin, reply
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
 		log.WithFields(log.Fields{"program": args.Name}).Error("program does not exist")
-		return fmt.Errorf("NOT_RUNNING")
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	if proc.GetState() != process.RUNNING {
 		log.WithFields(log.Fields{"program": args.Name}).Error("program does not run")
-		return fmt.Errorf("NOT_RUNNING")
+		return faults.NewFault(faults.NOT_RUNNING, fmt.Sprintf("NOT_RUNNING: %s", args.Name))
 	}
 	err := proc.SendProcessStdin(args.Chars)
 	if err == nil {
 		reply.Success = true
 	} else {
 		reply.Success = false
+		return faults.NewFault(faults.NO_FILE, fmt.Sprintf("NO_FILE: %v", err))
 	}
-	return err
+	return nil
 }
 
 func (s *Supervisor) SendRemoteCommEvent(r *http.Request, args *RemoteCommEvent, reply *struct{ Success bool }) error {
@@ -354,39 +609,107 @@ func (s *Supervisor) SendRemoteCommEvent(r *http.Request, args *RemoteCommEvent,
 	return nil
 }
 
-func (s *Supervisor) Reload() (error, []string, []string, []string) {
+// Reload loads the configuration again and applies the changes. The added
+// programs are started, the removed programs are stopped and only the
+// programs whose configuration is changed are restarted, the other programs
+// keep running with the same pid. The configuration is swapped under the
+// configLock and the processes are stopped and started after releasing it,
+// so the other requests are not blocked by the stopwaitsecs and startsecs
+func (s *Supervisor) Reload() (types.ReloadConfigResult, error) {
+	result, stopProcs, restartPrograms, err := s.reloadConfig()
+	if err != nil {
+		return result, err
+	}
+	for _, proc := range stopProcs {
+		proc.Stop(true)
+	}
+	s.procMgr.StartAutoStartProgramsIn(restartPrograms)
+	return result, nil
+}
+
+// load the configuration again and replace the removed and changed
+// processes, the replaced processes to be stopped and the programs to be
+// started are returned
+func (s *Supervisor) reloadConfig() (types.ReloadConfigResult, []*process.Process, []string, error) {
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	result := types.ReloadConfigResult{
+		AddedGroup:      make([]string, 0),
+		ChangedGroup:    make([]string, 0),
+		RemovedGroup:    make([]string, 0),
+		AddedPrograms:   make([]string, 0),
+		ChangedPrograms: make([]string, 0),
+		RemovedPrograms: make([]string, 0)}
 	//get the previous loaded programs
 	prevPrograms := s.config.GetProgramNames()
 	prevProgGroup := s.config.ProgramGroup.Clone()
+	prevEntries := make(map[string]*config.ConfigEntry)
+	for _, entry := range s.config.GetPrograms() {
+		prevEntries[entry.GetProgramName()] = entry
+	}
 
-	loaded_programs, err := s.config.Load()
+	// the resources are checked before the new configuration is used, so
+	// the processes still match the previous one if it is not used
+	loaded_programs, err := s.config.LoadAndCheck(func(newConfig *config.Config) error {
+		if supervisordConf, ok := newConfig.GetSupervisord(); ok {
+			return checkRequiredResources(supervisordConf)
+		}
+		return nil
+	})
+	if err != nil {
+		// keep running with the previous configuration
+		log.WithFields(log.Fields{log.ErrorKey: err}).Error("fail to load the configuration")
+		return result, nil, nil, err
+	}
 
-	if err == nil {
-		s.setSupervisordInfo()
-		s.startEventListeners()
-		s.createPrograms(prevPrograms)
-		s.startHttpServer()
-		s.startAutoStartPrograms()
-	}
-	removedPrograms := util.Sub(prevPrograms, loaded_programs)
-	for _, removedProg := range removedPrograms {
+	s.setSupervisordInfo()
+	s.startEventListeners()
+
+	// the group is changed if its programs are changed or the configuration
+	// of any program in it is changed
+	result.AddedGroup, result.ChangedGroup, result.RemovedGroup = s.config.ProgramGroup.Sub(prevProgGroup)
+	for _, entry := range s.config.GetPrograms() {
+		prevEntry, ok := prevEntries[entry.GetProgramName()]
+		if ok && !entry.IsSame(prevEntry) {
+			result.ChangedPrograms = append(result.ChangedPrograms, entry.GetProgramName())
+			if !util.InArray(entry.Group, util.StringArrayToInterfacArray(result.ChangedGroup)) {
+				result.ChangedGroup = append(result.ChangedGroup, entry.Group)
+			}
+		}
+	}
+
+	stopProcs := make([]*process.Process, 0)
+	result.RemovedPrograms = util.Sub(prevPrograms, loaded_programs)
+	for _, removedProg := range result.RemovedPrograms {
 		log.WithFields(log.Fields{"program": removedProg}).Info("the program is removed and will be stopped")
-		s.config.RemoveProgram(removedProg)
-		proc := s.procMgr.Remove(removedProg)
-		if proc != nil {
-			proc.Stop(false)
+		if proc := s.procMgr.Remove(removedProg); proc != nil {
+			stopProcs = append(stopProcs, proc)
 		}
+	}
 
+	// the changed programs are stopped and created again with the new
+	// configuration
+	result.AddedPrograms = util.Sub(loaded_programs, prevPrograms)
+	restartPrograms := append([]string{}, result.AddedPrograms...)
+	for _, name := range result.ChangedPrograms {
+		if proc := s.procMgr.Remove(name); proc != nil {
+			log.WithFields(log.Fields{"program": name}).Info("the program is changed and will be restarted")
+			stopProcs = append(stopProcs, proc)
+			restartPrograms = append(restartPrograms, name)
+		}
 	}
-	addedGroup, changedGroup, removedGroup := s.config.ProgramGroup.Sub(prevProgGroup)
-	return err, addedGroup, changedGroup, removedGroup
 
+	s.createPrograms(prevPrograms)
+	s.startHttpServer()
+	return result, stopProcs, restartPrograms, nil
 }
 
 func (s *Supervisor) WaitForExit() {
 	for {
 		if s.IsRestarting() {
 			s.procMgr.StopAllProcesses()
+			//the restarted supervisord listens on the same addresses
+			s.xmlRPC.Stop()
 			break
 		}
 		time.Sleep(10 * time.Second)
@@ -405,10 +728,6 @@ func (s *Supervisor) createPrograms(prevPrograms []string) {
 	}
 }
 
-func (s *Supervisor) startAutoStartPrograms() {
-	s.procMgr.StartAutoStartPrograms()
-}
-
 func (s *Supervisor) startEventListeners() {
 	eventListeners := s.config.GetEventListeners()
 	for _, entry := range eventListeners {
@@ -426,7 +745,9 @@ func (s *Supervisor) startHttpServer() {
 	if ok {
 		addr := httpServerConfig.GetString("port", "")
 		if addr != "" {
-			go s.xmlRPC.StartInetHttpServer(httpServerConfig.GetString("username", ""), httpServerConfig.GetString("password", ""), addr, s)
+			if err := s.xmlRPC.StartInetHttpServer(httpServerConfig.GetString("username", ""), httpServerConfig.GetString("password", ""), addr, s); err != nil {
+				log.WithFields(log.Fields{"port": addr}).Error("fail to start inet_http_server: ", err)
+			}
 		}
 	}
 
@@ -435,12 +756,21 @@ func (s *Supervisor) startHttpServer() {
 		env := config.NewStringExpression("here", s.config.GetConfigFileDir())
 		sockFile, err := env.Eval(httpServerConfig.GetString("file", "/tmp/supervisord.sock"))
 		if err == nil {
-			go s.xmlRPC.StartUnixHttpServer(httpServerConfig.GetString("username", ""), httpServerConfig.GetString("password", ""), sockFile, s)
+			if err := s.xmlRPC.StartUnixHttpServer(httpServerConfig.GetString("username", ""), httpServerConfig.GetString("password", ""), sockFile, s); err != nil {
+				log.WithFields(log.Fields{"file": sockFile}).Error("fail to start unix_http_server: ", err)
+			}
 		}
 	}
 
 }
 
+// check if the prometheus metrics are exported on "/metrics" of the http
+// server, it is enabled by "metrics=true" in the supervisord section
+func (s *Supervisor) IsMetricsEnabled() bool {
+	supervisordConf, ok := s.config.GetSupervisord()
+	return ok && supervisordConf.GetBool("metrics", false)
+}
+
 func (s *Supervisor) setSupervisordInfo() {
 	supervisordConf, ok := s.config.GetSupervisord()
 	if ok {
@@ -460,7 +790,7 @@ func (s *Supervisor) setSupervisordInfo() {
 			s.logger = logger.NewLogger("supervisord", logFile, &sync.Mutex{}, logfile_maxbytes, logfile_backups, logEventEmitter)
 			log.SetOutput(s.logger)
 			log.SetLevel(toLogLevel(loglevel))
-			log.SetFormatter(&log.TextFormatter{DisableColors: true})
+			log.SetFormatter(newLogFormatter(false))
 		}
 		//set the pid
 		pidfile, err := env.Eval(supervisordConf.GetString("pidfile", "supervisord.pid"))
@@ -491,38 +821,84 @@ func toLogLevel(level string) log.Level {
 
 func (s *Supervisor) ReloadConfig(r *http.Request, args *struct{}, reply *types.ReloadConfigResult) error {
 	log.Info("start to reload config")
-	err, addedGroup, changedGroup, removedGroup := s.Reload()
-	if len(addedGroup) > 0 {
-		log.WithFields(log.Fields{"groups": strings.Join(addedGroup, ",")}).Info("added groups")
+	result, err := s.Reload()
+	if len(result.AddedGroup) > 0 {
+		log.WithFields(log.Fields{"groups": strings.Join(result.AddedGroup, ",")}).Info("added groups")
 	}
 
-	if len(changedGroup) > 0 {
-		log.WithFields(log.Fields{"groups": strings.Join(changedGroup, ",")}).Info("changed groups")
+	if len(result.ChangedGroup) > 0 {
+		log.WithFields(log.Fields{"groups": strings.Join(result.ChangedGroup, ","),
+			"programs": strings.Join(result.ChangedPrograms, ",")}).Info("changed groups")
 	}
 
-	if len(removedGroup) > 0 {
-		log.WithFields(log.Fields{"groups": strings.Join(removedGroup, ",")}).Info("removed groups")
+	if len(result.RemovedGroup) > 0 {
+		log.WithFields(log.Fields{"groups": strings.Join(result.RemovedGroup, ",")}).Info("removed groups")
 	}
-	reply.AddedGroup = addedGroup
-	reply.ChangedGroup = changedGroup
-	reply.RemovedGroup = removedGroup
+	*reply = result
 	return err
 }
 
+// create the processes of a group in the loaded configuration and start the
+// autostart ones. The processes already created, e.g. by reloadConfig, are
+// kept as they are. A BAD_NAME fault is returned if the group is not in the
+// configuration
 func (s *Supervisor) AddProcessGroup(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error {
-	reply.Success = false
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	programs := s.config.ProgramGroup.GetAllProcess(args.Name)
+	if len(programs) == 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	added := make([]string, 0)
+	for _, name := range programs {
+		entry := s.config.GetProgram(name)
+		if entry == nil || s.procMgr.Find(name) != nil {
+			continue
+		}
+		s.procMgr.CreateProcess(s.GetSupervisorId(), entry)
+		added = append(added, name)
+	}
+	log.WithFields(log.Fields{"group": args.Name, "programs": strings.Join(added, ",")}).Info("the group is added")
+	s.procMgr.StartAutoStartProgramsIn(added)
+	reply.Success = true
 	return nil
 }
 
+// remove the processes of a group, they are created again by
+// AddProcessGroup. A BAD_NAME fault is returned if no process is in the
+// group and a STILL_RUNNING fault is returned if any process in the group is
+// not stopped
 func (s *Supervisor) RemoveProcessGroup(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error {
-	reply.Success = false
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	procs := make([]*process.Process, 0)
+	s.procMgr.ForEachProcess(func(proc *process.Process) {
+		if proc.GetGroup() == args.Name {
+			procs = append(procs, proc)
+		}
+	})
+	if len(procs) == 0 {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	for _, proc := range procs {
+		switch proc.GetState() {
+		case process.STOPPED, process.EXITED, process.FATAL:
+		default:
+			return faults.NewFault(faults.STILL_RUNNING, fmt.Sprintf("STILL_RUNNING: %s", proc.GetName()))
+		}
+	}
+	for _, proc := range procs {
+		s.procMgr.Remove(proc.GetName())
+	}
+	log.WithFields(log.Fields{"group": args.Name}).Info("the group is removed")
+	reply.Success = true
 	return nil
 }
 
 func (s *Supervisor) ReadProcessStdoutLog(r *http.Request, args *ProcessLogReadInfo, reply *struct{ LogData string }) error {
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	var err error
 	reply.LogData, err = proc.StdoutLog.ReadLog(int64(args.Offset), int64(args.Length))
@@ -532,27 +908,103 @@ func (s *Supervisor) ReadProcessStdoutLog(r *http.Request, args *ProcessLogReadI
 func (s *Supervisor) ReadProcessStderrLog(r *http.Request, args *ProcessLogReadInfo, reply *struct{ LogData string }) error {
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	var err error
 	reply.LogData, err = proc.StderrLog.ReadLog(int64(args.Offset), int64(args.Length))
 	return err
 }
 
+// read the stdout log across the rotated backups, the offset 0 is the
+// beginning of the oldest backup
+func (s *Supervisor) ReadProcessStdoutLogRange(r *http.Request, args *ProcessLogReadInfo, reply *struct{ LogData string }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	var err error
+	reply.LogData, err = proc.StdoutLog.ReadLogRange(int64(args.Offset), int64(args.Length))
+	return err
+}
+
+// read the stderr log across the rotated backups like ReadProcessStdoutLogRange
+func (s *Supervisor) ReadProcessStderrLogRange(r *http.Request, args *ProcessLogReadInfo, reply *struct{ LogData string }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	var err error
+	reply.LogData, err = proc.StderrLog.ReadLogRange(int64(args.Offset), int64(args.Length))
+	return err
+}
+
+// read length bytes from offset of the stdout log backup "<logfile>.<index>"
+// of the process, the index must be from 1 to the stdout_logfile_backups. A
+// NO_FILE fault is returned if the backup doesn't exist
+func (s *Supervisor) ReadProcessStdoutLogBackup(r *http.Request, args *ProcessLogBackupReadInfo, reply *struct{ LogData string }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	var err error
+	reply.LogData, err = proc.StdoutLog.ReadBackupLog(args.Index, int64(args.Offset), int64(args.Length))
+	return err
+}
+
+// read the stderr log backup like ReadProcessStdoutLogBackup, the index must
+// be from 1 to the stderr_logfile_backups
+func (s *Supervisor) ReadProcessStderrLogBackup(r *http.Request, args *ProcessLogBackupReadInfo, reply *struct{ LogData string }) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	var err error
+	reply.LogData, err = proc.StderrLog.ReadBackupLog(args.Index, int64(args.Offset), int64(args.Length))
+	return err
+}
+
 func (s *Supervisor) TailProcessStdoutLog(r *http.Request, args *ProcessLogReadInfo, reply *ProcessTailLog) error {
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	var err error
-	reply.LogData, reply.Offset, reply.Overflow, err = proc.StdoutLog.ReadTailLog(int64(args.Offset), int64(args.Length))
+	var offset int64
+	reply.LogData, offset, reply.Overflow, err = proc.StdoutLog.ReadTailLog(int64(args.Offset), int64(args.Length))
+	if err != nil {
+		return err
+	}
+	reply.Offset, err = tailOffset(offset)
 	return err
 }
 
+func (s *Supervisor) TailProcessStderrLog(r *http.Request, args *ProcessLogReadInfo, reply *ProcessTailLog) error {
+	proc := s.procMgr.Find(args.Name)
+	if proc == nil {
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
+	}
+	var err error
+	var offset int64
+	reply.LogData, offset, reply.Overflow, err = proc.StderrLog.ReadTailLog(int64(args.Offset), int64(args.Length))
+	if err != nil {
+		return err
+	}
+	reply.Offset, err = tailOffset(offset)
+	return err
+}
+
+// convert the offset of the log to the int encoded by the xml-rpc codec
+func tailOffset(offset int64) (int, error) {
+	if int64(int(offset)) != offset {
+		return 0, faults.NewFault(faults.FAILED, fmt.Sprintf("FAILED: the offset %d of the log exceeds the int of this platform", offset))
+	}
+	return int(offset), nil
+}
+
 func (s *Supervisor) ClearProcessLogs(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error {
 	proc := s.procMgr.Find(args.Name)
 	if proc == nil {
-		return fmt.Errorf("No such process %s", args.Name)
+		return faults.NewFault(faults.BAD_NAME, fmt.Sprintf("BAD_NAME: %s", args.Name))
 	}
 	err1 := proc.StdoutLog.ClearAllLogFile()
 	err2 := proc.StderrLog.ClearAllLogFile()
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/csxuejin/supervisord/process"
+	"github.com/csxuejin/supervisord/types"
+)
+
+func waitProcessRunning(proc *process.Process) bool {
+	for i := 0; i < 50; i++ {
+		if proc.GetState() == process.RUNNING {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte(`[program:unchanged]
+command=/bin/sleep 60
+startsecs=0
+
+[program:changed]
+command=/bin/sleep 60
+startsecs=0
+
+[program:removed]
+command=/bin/sleep 60
+startsecs=0
+`), os.ModePerm)
+	s := NewSupervisor(configFile)
+	defer s.procMgr.StopAllProcesses()
+	if _, err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	pids := make(map[string]int)
+	for _, name := range []string{"unchanged", "changed", "removed"} {
+		proc := s.procMgr.Find(name)
+		if proc == nil || !waitProcessRunning(proc) {
+			t.Fatalf("The program %s is not started", name)
+		}
+		pids[name] = proc.GetPid()
+	}
+	removedProc := s.procMgr.Find("removed")
+
+	ioutil.WriteFile(configFile, []byte(`[program:unchanged]
+command=/bin/sleep 60
+startsecs=0
+
+[program:changed]
+command=/bin/sleep 61
+startsecs=0
+
+[program:added]
+command=/bin/sleep 60
+startsecs=0
+`), os.ModePerm)
+	result, err := s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(result.ChangedGroup)
+	if strings.Join(result.AddedGroup, ",") != "added" || strings.Join(result.ChangedGroup, ",") != "changed" ||
+		strings.Join(result.RemovedGroup, ",") != "removed" {
+		t.Errorf("Wrong groups, added=%v, changed=%v, removed=%v", result.AddedGroup, result.ChangedGroup, result.RemovedGroup)
+	}
+	if strings.Join(result.AddedPrograms, ",") != "added" || strings.Join(result.ChangedPrograms, ",") != "changed" ||
+		strings.Join(result.RemovedPrograms, ",") != "removed" {
+		t.Errorf("Wrong programs, added=%v, changed=%v, removed=%v", result.AddedPrograms, result.ChangedPrograms, result.RemovedPrograms)
+	}
+
+	if proc := s.procMgr.Find("unchanged"); proc == nil || proc.GetState() != process.RUNNING || proc.GetPid() != pids["unchanged"] {
+		t.Error("The unchanged program should not be restarted")
+	}
+	if proc := s.procMgr.Find("changed"); proc == nil || !waitProcessRunning(proc) || proc.GetPid() == pids["changed"] {
+		t.Error("The changed program should be restarted")
+	}
+	if proc := s.procMgr.Find("added"); proc == nil || !waitProcessRunning(proc) {
+		t.Error("The added program should be started")
+	}
+	if s.procMgr.Find("removed") != nil || removedProc.GetState() != process.STOPPED {
+		t.Error("The removed program should be stopped and removed")
+	}
+}
+
+func TestReloadChangedProgramInGroup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[program:app]
+command=/bin/sleep 60
+startsecs=0
+
+[program:worker]
+command=/bin/sleep 60
+startsecs=0
+
+[group:web]
+programs=app,worker
+`)
+	defer s.procMgr.StopAllProcesses()
+	s.procMgr.StartAutoStartPrograms()
+	pids := make(map[string]int)
+	for _, name := range []string{"app", "worker"} {
+		proc := s.procMgr.Find(name)
+		if proc == nil || !waitProcessRunning(proc) {
+			t.Fatalf("The program %s is not started", name)
+		}
+		pids[name] = proc.GetPid()
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte(`[program:app]
+command=/bin/sleep 60
+startsecs=0
+
+[program:worker]
+command=/bin/sleep 60
+startsecs=0
+environment=A=1
+
+[group:web]
+programs=app,worker
+`), os.ModePerm)
+	result, err := s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.ChangedGroup, ",") != "web" || strings.Join(result.ChangedPrograms, ",") != "worker" {
+		t.Errorf("Wrong changes, groups=%v, programs=%v", result.ChangedGroup, result.ChangedPrograms)
+	}
+	// only the changed program in the group is restarted
+	if proc := s.procMgr.Find("app"); proc == nil || proc.GetState() != process.RUNNING || proc.GetPid() != pids["app"] {
+		t.Error("The unchanged program in the changed group should not be restarted")
+	}
+	if proc := s.procMgr.Find("worker"); proc == nil || !waitProcessRunning(proc) || proc.GetPid() == pids["worker"] {
+		t.Error("The changed program should be restarted")
+	}
+}
+
+func TestReloadStopsProcessesWithoutConfigLock(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	// the program ignores the SIGTERM and is killed after the stopwaitsecs
+	s := createTestSupervisor(t, dir, `[program:slow]
+command=/bin/sh -c "trap '' TERM; while true; do sleep 0.1; done"
+startsecs=1
+stopwaitsecs=2
+`)
+	defer s.procMgr.StopAllProcesses()
+	s.procMgr.StartAutoStartPrograms()
+	proc := s.procMgr.Find("slow")
+	if proc == nil || !waitProcessRunning(proc) {
+		t.Fatal("The program slow is not started")
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[program:test]\ncommand=/bin/sleep 60\nautostart=false\n"), os.ModePerm)
+	reloaded := make(chan error)
+	go func() {
+		_, err := s.Reload()
+		reloaded <- err
+	}()
+	time.Sleep(500 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		s.configLock.Lock()
+		s.configLock.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("The configLock should not be held while stopping the processes")
+	}
+	if err := <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+	if proc.GetState() != process.STOPPED || s.procMgr.Find("slow") != nil {
+		t.Errorf("The removed program should be stopped, state=%v", proc.GetState())
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:test]\ncommand=/bin/sleep 60\nautostart=false\n")
+
+	ioutil.WriteFile(filepath.Join(dir, "supervisord.conf"), []byte("[program:test]\ncommand=/bin/sleep 60\nnumprocs=2\n"), os.ModePerm)
+	if _, err := s.Reload(); err == nil {
+		t.Fatal("The invalid configuration should not be loaded")
+	}
+	// the previous configuration is kept
+	if entry := s.config.GetProgram("test"); entry == nil || entry.GetBool("autostart", true) {
+		t.Error("The previous configuration is not kept")
+	}
+}
+
+func TestSignalProcessGroup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	signalFile := filepath.Join(dir, "signals")
+	command := fmt.Sprintf(`/bin/sh -c "trap 'echo %%s >> %s' USR1; while true; do sleep 0.1; done"`, signalFile)
+	// the trap is set before the program is RUNNING
+	s := createTestSupervisor(t, dir, fmt.Sprintf(`[program:app]
+command=%s
+startsecs=1
+
+[program:worker]
+command=/bin/sleep 60
+autostart=false
+
+[program:other]
+command=%s
+startsecs=1
+
+[group:web]
+programs=app,worker
+`, fmt.Sprintf(command, "app"), fmt.Sprintf(command, "other")))
+	defer s.procMgr.StopAllProcesses()
+	s.procMgr.StartAutoStartPrograms()
+	for _, name := range []string{"app", "other"} {
+		if proc := s.procMgr.Find(name); proc == nil || !waitProcessRunning(proc) {
+			t.Fatalf("The program %s is not started", name)
+		}
+	}
+
+	reply := struct{ Results []bool }{}
+	if err := s.SignalProcessGroup(nil, &types.ProcessSignal{Name: "web", Signal: "USR1"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	// the worker is not running
+	if fmt.Sprint(reply.Results) != "[true false]" {
+		t.Errorf("Wrong results %v", reply.Results)
+	}
+	var b []byte
+	for i := 0; i < 20 && len(b) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		b, _ = ioutil.ReadFile(signalFile)
+	}
+	if string(b) != "app\n" {
+		t.Errorf("Only the processes in the group should receive the signal, received=%q", string(b))
+	}
+	if s.procMgr.Find("app").GetState() != process.RUNNING {
+		t.Error("The signalled process should be still RUNNING")
+	}
+
+	if err := s.SignalProcessGroup(nil, &types.ProcessSignal{Name: "nonexistent", Signal: "USR1"}, &reply); err == nil {
+		t.Error("The unknown group should be rejected")
+	}
+}
+
+func TestRestartProcessGroupWait(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[program:app]
+command=/bin/sleep 60
+startsecs=1
+
+[group:web]
+programs=app
+serialrestart=true
+`)
+	defer s.procMgr.StopAllProcesses()
+	proc := s.procMgr.Find("app")
+	proc.Start(true)
+
+	reply := struct{ AllProcessInfo []types.ProcessInfo }{}
+	if err := s.RestartProcessGroup(nil, &StartProcessArgs{Name: "web", Wait: true}, &reply); err != nil || len(reply.AllProcessInfo) != 1 {
+		t.Fatalf("Fail to restart the group, reply=%v, err=%v", reply, err)
+	}
+	if reply.AllProcessInfo[0].State != int(process.RUNNING) {
+		t.Errorf("The process should be RUNNING after the restart with wait, state=%s", reply.AllProcessInfo[0].Statename)
+	}
+
+	pid := reply.AllProcessInfo[0].Pid
+	reply.AllProcessInfo = nil
+	start := time.Now()
+	if err := s.RestartProcessGroup(nil, &StartProcessArgs{Name: "web", Wait: false}, &reply); err != nil || len(reply.AllProcessInfo) != 1 {
+		t.Fatalf("Fail to restart the group, reply=%v, err=%v", reply, err)
+	}
+	if time.Since(start) >= time.Second {
+		t.Error("The restart without wait should not wait for the startsecs")
+	}
+	restarted := false
+	for i := 0; i < 50 && !restarted; i++ {
+		time.Sleep(100 * time.Millisecond)
+		info := getProcessInfo(proc)
+		restarted = info.Pid != pid && info.State == int(process.RUNNING)
+	}
+	if !restarted {
+		t.Error("The process should be restarted in the background without wait")
+	}
+
+	reply.AllProcessInfo = nil
+	if err := s.RestartProcessGroup(nil, &StartProcessArgs{Name: "nonexistent", Wait: true}, &reply); err == nil || !strings.Contains(err.Error(), "BAD_NAME") {
+		t.Errorf("The unknown group should be rejected, err=%v", err)
+	}
+}
+
+func TestGetProcessLogInfo(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[program:app]
+command=/bin/sleep 60
+stdout_logfile=%(here)s/app.log
+stdout_logfile_maxbytes=1KB
+stdout_logfile_backups=3
+stdout_events_enabled=true
+stderr_logfile=%(here)s/app.err
+stderr_capture_maxbytes=1KB
+stderr_events_enabled=true
+
+[program:merged]
+command=/bin/sleep 60
+stdout_logfile=%(here)s/merged.log
+redirect_stderr=true
+`)
+	reply := struct{ LogInfo types.ProcessLogInfo }{}
+	if err := s.GetProcessLogInfo(nil, &struct{ Name string }{"app"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	expected := types.ProcessLogInfo{Name: "app",
+		Group:                   "app",
+		Stdout_logfile:          filepath.Join(dir, "app.log"),
+		Stdout_logfile_maxbytes: 1024,
+		Stdout_logfile_backups:  3,
+		Stdout_events_enabled:   true,
+		Stderr_logfile:          filepath.Join(dir, "app.err"),
+		Stderr_logfile_maxbytes: 50 * 1024 * 1024,
+		Stderr_logfile_backups:  10,
+		Stderr_capture_enabled:  true}
+	// the events of stderr are disabled by capturing
+	if reply.LogInfo != expected {
+		t.Errorf("Wrong log info %+v", reply.LogInfo)
+	}
+
+	if err := s.GetProcessLogInfo(nil, &struct{ Name string }{"merged"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if !reply.LogInfo.Redirect_stderr || reply.LogInfo.Stdout_logfile != filepath.Join(dir, "merged.log") || reply.LogInfo.Stderr_logfile != "" {
+		t.Errorf("Wrong log info of the redirected stderr %+v", reply.LogInfo)
+	}
+	if err := s.GetProcessLogInfo(nil, &struct{ Name string }{"nonexistent"}, &reply); err == nil {
+		t.Error("The unknown process should be rejected")
+	}
+}
+
+func TestGetEffectiveConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[supervisord]
+environment=A="global",B="global"
+
+[program:app]
+command=/bin/sh -c "sleep %(process_num)d"
+process_name=%(program_name)s_%(process_num)d
+numprocs=2
+directory=%(here)s
+environment=B="program",NUM="%(process_num)d"
+umask=022
+
+[program:fail]
+command=/bin/sleep 60
+env_file=%(here)s/nonexistent.env
+`)
+	reply := struct{ Config types.ProcessEffectiveConfig }{}
+	if err := s.GetEffectiveConfig(nil, &struct{ Name string }{"app_1"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	config := reply.Config
+	if config.Name != "app_1" || config.Command != `/bin/sh -c "sleep 1"` || !reflect.DeepEqual(config.Argv, []string{"/bin/sh", "-c", "sleep 1"}) {
+		t.Errorf("Wrong command %+v", config)
+	}
+	if config.Directory != dir || config.Umask != 022 || config.User != "" || config.Uid != os.Getuid() {
+		t.Errorf("Wrong directory, umask or user %+v", config)
+	}
+	if !reflect.DeepEqual(config.Environment, []string{"A=global", "B=program", "NUM=1"}) {
+		t.Errorf("Wrong environment %v", config.Environment)
+	}
+
+	if err := s.GetEffectiveConfig(nil, &struct{ Name string }{"fail"}, &reply); err == nil || !strings.Contains(err.Error(), "env_file") {
+		t.Errorf("The unreadable env_file should be reported, err=%v", err)
+	}
+	if err := s.GetEffectiveConfig(nil, &struct{ Name string }{"nonexistent"}, &reply); err == nil {
+		t.Error("The unknown process should be rejected")
+	}
+}
+
+func TestUnknownProcessIsBadName(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[program:app]
+command=/bin/sleep 60
+autostart=false
+`)
+	args := &StartProcessArgs{Name: "nonexistent", Wait: false}
+	logArgs := &ProcessLogReadInfo{Name: "nonexistent"}
+	reply := &struct{ Success bool }{}
+	tests := map[string]error{
+		"StartProcess":         s.StartProcess(nil, args, reply),
+		"StopProcess":          s.StopProcess(nil, args, reply),
+		"TailProcessStdoutLog": s.TailProcessStdoutLog(nil, logArgs, &ProcessTailLog{}),
+		"ClearProcessLogs":     s.ClearProcessLogs(nil, &struct{ Name string }{"nonexistent"}, reply),
+	}
+	for method, err := range tests {
+		if err == nil || !strings.Contains(err.Error(), "BAD_NAME") {
+			t.Errorf("%s should return BAD_NAME for the unknown process, err=%v", method, err)
+		}
+	}
+}
+
+func TestAddRemoveProcessGroup(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[program:app]
+command=/bin/sleep 60
+startsecs=0
+autostart=false
+
+[group:web]
+programs=app
+`)
+	reply := &struct{ Success bool }{}
+	for _, f := range []func(r *http.Request, args *struct{ Name string }, reply *struct{ Success bool }) error{s.AddProcessGroup, s.RemoveProcessGroup} {
+		if err := f(nil, &struct{ Name string }{"nonexistent"}, reply); err == nil || !strings.Contains(err.Error(), "BAD_NAME") {
+			t.Errorf("The unknown group should be BAD_NAME, err=%v", err)
+		}
+	}
+
+	proc := s.procMgr.Find("app")
+	proc.Start(true)
+	defer proc.Stop(true)
+	if err := s.RemoveProcessGroup(nil, &struct{ Name string }{"web"}, reply); err == nil || !strings.Contains(err.Error(), "STILL_RUNNING") {
+		t.Errorf("The running group should not be removed, err=%v", err)
+	}
+	proc.Stop(true)
+	if err := s.RemoveProcessGroup(nil, &struct{ Name string }{"web"}, reply); err != nil || !reply.Success || s.procMgr.Find("app") != nil {
+		t.Errorf("Fail to remove the stopped group, err=%v", err)
+	}
+	if err := s.AddProcessGroup(nil, &struct{ Name string }{"web"}, reply); err != nil || !reply.Success || s.procMgr.Find("app") == nil {
+		t.Errorf("Fail to add the group again, err=%v", err)
+	}
+	if err := s.AddProcessGroup(nil, &struct{ Name string }{"web"}, reply); err != nil || !reply.Success {
+		t.Errorf("The added group should be kept, err=%v", err)
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte("[program:app]\ncommand=/bin/sleep 60\nautostart=false\n"), os.ModePerm)
+	s := NewSupervisor(configFile)
+	if _, err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the added program is reported by only one of the reloads
+	ioutil.WriteFile(configFile, []byte("[program:app]\ncommand=/bin/sleep 60\nautostart=false\n\n[program:added]\ncommand=/bin/sleep 60\nautostart=false\n"), os.ModePerm)
+	results := make(chan types.ReloadConfigResult, 4)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			reply := types.ReloadConfigResult{}
+			s.ReloadConfig(nil, &struct{}{}, &reply)
+			results <- reply
+		}()
+	}
+	added := 0
+	for i := 0; i < cap(results); i++ {
+		added += len((<-results).AddedPrograms)
+	}
+	if added != 1 || s.procMgr.Find("added") == nil {
+		t.Errorf("The program should be added once, added=%d", added)
+	}
+}
+
+func TestShutdownAndExitOnce(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:app]\ncommand=/bin/sleep 60\nautostart=false\n")
+	var exits int32
+	defer func(oldExit func(int)) { exit = oldExit }(exit)
+	exit = func(code int) { atomic.AddInt32(&exits, 1) }
+
+	// SIGTERM arrives while the shutdown request is being handled
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			s.ShutdownAndExit(0)
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	if n := atomic.LoadInt32(&exits); n != 1 {
+		t.Errorf("The supervisord should exit once, exited %d times", n)
+	}
+	reply := struct{ StateInfo StateInfo }{}
+	s.GetState(nil, &struct{}{}, &reply)
+	if reply.StateInfo.Statename != "SHUTDOWN" {
+		t.Errorf("Wrong state %s after shutdown", reply.StateInfo.Statename)
+	}
+}
+
+func TestSignalProcessBadSignal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[program:app]\ncommand=/bin/sleep 60\nautostart=false\n")
+	reply := &struct{ Success bool }{}
+	if err := s.SignalProcess(nil, &types.ProcessSignal{Name: "app", Signal: "BAD"}, reply); err == nil || !strings.Contains(err.Error(), "BAD_SIGNAL") {
+		t.Errorf("The unknown signal should be BAD_SIGNAL, err=%v", err)
+	}
+	allReply := &struct{ AllProcessInfo []types.ProcessInfo }{}
+	if err := s.SignalAllProcesses(nil, &struct{ Signal string }{"BAD"}, allReply); err == nil || !strings.Contains(err.Error(), "BAD_SIGNAL") {
+		t.Errorf("The unknown signal should be BAD_SIGNAL for all the processes, err=%v", err)
+	}
+}
@@ -1,26 +1,144 @@
 package types
 
 type ProcessInfo struct {
-    Name           string `xml:"name" json:"name"`
-    Group          string `xml:"group" json:"group"`
-    Description    string `xml:"description" json:"description"`
-    Start          int    `xml:"start" json:"start"`
-    Stop           int    `xml:"stop" json:"stop"`
-    Now            int    `xml:"now" json:"now"`
-    State          int    `xml:"state" json:"state"`
-    Statename      string `xml:"statename" json:"statename"`
-    Spawnerr       string `xml:"spawnerr" json:"spawnerr"`
-    Exitstatus     int    `xml:"exitstatus" json:"exitstatus"`
-    Logfile        string `xml:"logfile" json:"logfile"`
-    Stdout_logfile string `xml:"stdout_logfile" json:"stdout_logfile"`
-    Stderr_logfile string `xml:"stderr_logfile" json:"stderr_logfile"`
-    Pid            int    `xml:"pid" json:"pid"`
+    Name            string  `xml:"name" json:"name"`
+    Group           string  `xml:"group" json:"group"`
+    Description     string  `xml:"description" json:"description"`
+    Start           int     `xml:"start" json:"start"`
+    Stop            int     `xml:"stop" json:"stop"`
+    Now             int     `xml:"now" json:"now"`
+    State           int     `xml:"state" json:"state"`
+    Statename       string  `xml:"statename" json:"statename"`
+    Spawnerr        string  `xml:"spawnerr" json:"spawnerr"`
+    Exitstatus      int     `xml:"exitstatus" json:"exitstatus"`
+    Logfile         string  `xml:"logfile" json:"logfile"`
+    Stdout_logfile  string  `xml:"stdout_logfile" json:"stdout_logfile"`
+    Stderr_logfile  string  `xml:"stderr_logfile" json:"stderr_logfile"`
+    Pid             int     `xml:"pid" json:"pid"`
+    Health          string  `xml:"health" json:"health"`
+    Restarts        int     `xml:"restarts" json:"restarts"`
+    Last_exitstatus int     `xml:"last_exitstatus" json:"last_exitstatus"`
+    Backoff         float64 `xml:"backoff" json:"backoff"`
+    Restart_reason  string  `xml:"restart_reason" json:"restart_reason"`
+    Ready           string  `xml:"ready" json:"ready"`
 }
 
+// ProcessConfigInfo is the configuration of a program, the xml names follow
+// the supervisor getAllConfigInfo and the field names are the xml names with
+// the first letter in upper case, so they can be decoded by the client
+type ProcessConfigInfo struct {
+	Name            string   `xml:"name" json:"name"`
+	Group           string   `xml:"group" json:"group"`
+	Inuse           bool     `xml:"inuse" json:"inuse"`
+	Autostart       bool     `xml:"autostart" json:"autostart"`
+	Autorestart     string   `xml:"autorestart" json:"autorestart"`
+	Command         string   `xml:"command" json:"command"`
+	Directory       string   `xml:"directory" json:"directory"`
+	Exitcodes       string   `xml:"exitcodes" json:"exitcodes"`
+	Process_prio    int      `xml:"process_prio" json:"process_prio"`
+	Startsecs       int      `xml:"startsecs" json:"startsecs"`
+	Startretries    int      `xml:"startretries" json:"startretries"`
+	Stopsignal      string   `xml:"stopsignal" json:"stopsignal"`
+	Stopwaitsecs    int      `xml:"stopwaitsecs" json:"stopwaitsecs"`
+	Redirect_stderr bool     `xml:"redirect_stderr" json:"redirect_stderr"`
+	Stdout_logfile  string   `xml:"stdout_logfile" json:"stdout_logfile"`
+	Stderr_logfile  string   `xml:"stderr_logfile" json:"stderr_logfile"`
+	Environment     []string `xml:"environment" json:"environment"`
+}
+
+// ProcessStats is the resource usage of a running process, the memory is
+// in bytes and the cpu time is in seconds
+type ProcessStats struct {
+	Name        string  `xml:"name" json:"name"`
+	Group       string  `xml:"group" json:"group"`
+	Pid         int     `xml:"pid" json:"pid"`
+	Cpu_percent float64 `xml:"cpu_percent" json:"cpu_percent"`
+	Cpu_time    float64 `xml:"cpu_time" json:"cpu_time"`
+	Rss         int     `xml:"rss" json:"rss"`
+	Vms         int     `xml:"vms" json:"vms"`
+	Now         int     `xml:"now" json:"now"`
+}
+
+// ProcessStateInfo is the state of a process, it is a small part of the
+// ProcessInfo for polling the states of many processes
+type ProcessStateInfo struct {
+	Name      string `xml:"name" json:"name"`
+	Group     string `xml:"group" json:"group"`
+	State     int    `xml:"state" json:"state"`
+	Statename string `xml:"statename" json:"statename"`
+	Pid       int    `xml:"pid" json:"pid"`
+}
+
+// ProcessLogInfo is the configuration of the stdout and stderr log of a
+// process. The stderr_logfile is empty if the stderr is redirected to the
+// stdout, the rotated backups of a log are "<logfile>.1" to
+// "<logfile>.<backups>" with the suffix ".gz" if they are compressed
+type ProcessLogInfo struct {
+	Name                    string `xml:"name" json:"name"`
+	Group                   string `xml:"group" json:"group"`
+	Redirect_stderr         bool   `xml:"redirect_stderr" json:"redirect_stderr"`
+	Stdout_logfile          string `xml:"stdout_logfile" json:"stdout_logfile"`
+	Stdout_logfile_maxbytes int    `xml:"stdout_logfile_maxbytes" json:"stdout_logfile_maxbytes"`
+	Stdout_logfile_backups  int    `xml:"stdout_logfile_backups" json:"stdout_logfile_backups"`
+	Stdout_capture_enabled  bool   `xml:"stdout_capture_enabled" json:"stdout_capture_enabled"`
+	Stdout_events_enabled   bool   `xml:"stdout_events_enabled" json:"stdout_events_enabled"`
+	Stderr_logfile          string `xml:"stderr_logfile" json:"stderr_logfile"`
+	Stderr_logfile_maxbytes int    `xml:"stderr_logfile_maxbytes" json:"stderr_logfile_maxbytes"`
+	Stderr_logfile_backups  int    `xml:"stderr_logfile_backups" json:"stderr_logfile_backups"`
+	Stderr_capture_enabled  bool   `xml:"stderr_capture_enabled" json:"stderr_capture_enabled"`
+	Stderr_events_enabled   bool   `xml:"stderr_events_enabled" json:"stderr_events_enabled"`
+}
+
+// ProcessEffectiveConfig is the resolved configuration a process is started
+// with, the environment is the one set by supervisord without the inherited
+// environment of supervisord and the umask is -1 if it is inherited
+type ProcessEffectiveConfig struct {
+	Name        string   `xml:"name" json:"name"`
+	Group       string   `xml:"group" json:"group"`
+	Command     string   `xml:"command" json:"command"`
+	Argv        []string `xml:"argv" json:"argv"`
+	Directory   string   `xml:"directory" json:"directory"`
+	Environment []string `xml:"environment" json:"environment"`
+	User        string   `xml:"user" json:"user"`
+	Uid         int      `xml:"uid" json:"uid"`
+	Gid         int      `xml:"gid" json:"gid"`
+	Umask       int      `xml:"umask" json:"umask"`
+}
+
+// ProgramConfig is the definition of a program added at runtime by
+// addProgram. The Environment is the "KEY=value" variables and the Options
+// are the other "key=value" settings of the program section like
+// "startsecs=5", the empty Directory, User and Autorestart are not set
+type ProgramConfig struct {
+	Name        string   `xml:"name" json:"name"`
+	Command     string   `xml:"command" json:"command"`
+	Directory   string   `xml:"directory" json:"directory"`
+	User        string   `xml:"user" json:"user"`
+	Environment []string `xml:"environment" json:"environment"`
+	Autostart   bool     `xml:"autostart" json:"autostart"`
+	Autorestart string   `xml:"autorestart" json:"autorestart"`
+	Options     []string `xml:"options" json:"options"`
+}
+
+// DaemonInfo is the information of the supervisord process, the start and
+// now are unix seconds and the uptime is in seconds
+type DaemonInfo struct {
+	Pid        int    `xml:"pid" json:"pid"`
+	Start      int    `xml:"start" json:"start"`
+	Now        int    `xml:"now" json:"now"`
+	Uptime     int    `xml:"uptime" json:"uptime"`
+	Configfile string `xml:"configfile" json:"configfile"`
+}
+
+// ReloadConfigResult is the change of reloading the configuration, only
+// the changed programs are restarted
 type ReloadConfigResult struct {
-	AddedGroup   []string
-	ChangedGroup []string
-	RemovedGroup []string
+	AddedGroup      []string
+	ChangedGroup    []string
+	RemovedGroup    []string
+	AddedPrograms   []string
+	ChangedPrograms []string
+	RemovedPrograms []string
 }
 
 type ProcessSignal struct {
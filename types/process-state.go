@@ -0,0 +1,87 @@
+package types
+
+// the state codes of a process, they are the same as the ProcessState of
+// the process package and the supervisor process states
+const (
+	PROCESS_STOPPED  = 0
+	PROCESS_STARTING = 10
+	PROCESS_RUNNING  = 20
+	PROCESS_BACKOFF  = 30
+	PROCESS_STOPPING = 40
+	PROCESS_EXITED   = 100
+	PROCESS_FATAL    = 200
+	PROCESS_UNKNOWN  = 1000
+)
+
+// the process is running
+func isRunning(state int) bool {
+	return state == PROCESS_RUNNING
+}
+
+// the process is not running and it is not going to be started or stopped,
+// it is stopped, exited or failed to start
+func isStopped(state int) bool {
+	return state == PROCESS_STOPPED || state == PROCESS_EXITED || state == PROCESS_FATAL
+}
+
+// the process is being started or stopped, or waiting to be started again
+func isTransitioning(state int) bool {
+	return state == PROCESS_STARTING || state == PROCESS_STOPPING || state == PROCESS_BACKOFF
+}
+
+// the process can't be started and it is not started again
+func isFailed(state int) bool {
+	return state == PROCESS_FATAL
+}
+
+// Running returns true if the process is RUNNING
+func (pi *ProcessInfo) Running() bool {
+	return isRunning(pi.State)
+}
+
+// Stopped returns true if the process is STOPPED, EXITED or FATAL
+func (pi *ProcessInfo) Stopped() bool {
+	return isStopped(pi.State)
+}
+
+// Transitioning returns true if the process is STARTING, STOPPING or BACKOFF,
+// it is in a transient state and will change later
+func (pi *ProcessInfo) Transitioning() bool {
+	return isTransitioning(pi.State)
+}
+
+// IsTransitioning is the same as Transitioning
+func (pi *ProcessInfo) IsTransitioning() bool {
+	return pi.Transitioning()
+}
+
+// Failed returns true if the process is FATAL
+func (pi *ProcessInfo) Failed() bool {
+	return isFailed(pi.State)
+}
+
+// Running returns true if the process is RUNNING
+func (si *ProcessStateInfo) Running() bool {
+	return isRunning(si.State)
+}
+
+// Stopped returns true if the process is STOPPED, EXITED or FATAL
+func (si *ProcessStateInfo) Stopped() bool {
+	return isStopped(si.State)
+}
+
+// Transitioning returns true if the process is STARTING, STOPPING or BACKOFF,
+// it is in a transient state and will change later
+func (si *ProcessStateInfo) Transitioning() bool {
+	return isTransitioning(si.State)
+}
+
+// IsTransitioning is the same as Transitioning
+func (si *ProcessStateInfo) IsTransitioning() bool {
+	return si.Transitioning()
+}
+
+// Failed returns true if the process is FATAL
+func (si *ProcessStateInfo) Failed() bool {
+	return isFailed(si.State)
+}
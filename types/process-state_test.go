@@ -0,0 +1,36 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestProcessInfoState(t *testing.T) {
+	tests := []struct {
+		state                                   int
+		running, stopped, transitioning, failed bool
+	}{
+		{PROCESS_STOPPED, false, true, false, false},
+		{PROCESS_STARTING, false, false, true, false},
+		{PROCESS_RUNNING, true, false, false, false},
+		{PROCESS_BACKOFF, false, false, true, false},
+		{PROCESS_STOPPING, false, false, true, false},
+		{PROCESS_EXITED, false, true, false, false},
+		{PROCESS_FATAL, false, true, false, true},
+		{PROCESS_UNKNOWN, false, false, false, false},
+	}
+	for _, test := range tests {
+		info := ProcessInfo{State: test.state}
+		if info.Running() != test.running || info.Stopped() != test.stopped ||
+			info.Transitioning() != test.transitioning || info.IsTransitioning() != test.transitioning ||
+			info.Failed() != test.failed {
+			t.Errorf("Wrong helpers of state %d: running=%v, stopped=%v, transitioning=%v, failed=%v",
+				test.state, info.Running(), info.Stopped(), info.Transitioning(), info.Failed())
+		}
+		stateInfo := ProcessStateInfo{State: test.state}
+		if stateInfo.Running() != test.running || stateInfo.Stopped() != test.stopped ||
+			stateInfo.Transitioning() != test.transitioning || stateInfo.IsTransitioning() != test.transitioning ||
+			stateInfo.Failed() != test.failed {
+			t.Errorf("Wrong helpers of the state info %d", test.state)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/csxuejin/supervisord/config"
+)
+
+type ValidateCommand struct {
+}
+
+var validateCommand ValidateCommand
+
+// validate the configuration file without starting any program, exit with 1
+// if any error is found
+func (v ValidateCommand) Execute(args []string) error {
+	errs := config.NewConfig(options.Configuration).Validate()
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+	fmt.Printf("%s is valid\n", options.Configuration)
+	return nil
+}
+
+func init() {
+	parser.AddCommand("validate",
+		"validate the configuration",
+		"The validate subcommand checks the configuration file and its included files without starting any program",
+		&validateCommand)
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha1"
+	"crypto/subtle"
 	"encoding/hex"
-	"io"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/rpc"
 	"github.com/csxuejin/gorilla-xmlrpc/xml"
@@ -15,9 +21,9 @@ import (
 )
 
 type XmlRPC struct {
+	//the listeners of the started http servers, the key is the protocol
 	listeners map[string]net.Listener
-	// true if RPC is started
-	started bool
+	lock      sync.Mutex
 }
 
 type httpBasicAuth struct {
@@ -40,65 +46,111 @@ func (h *httpBasicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	username, password, ok := r.BasicAuth()
-	if ok && username == h.user {
-		if strings.HasPrefix(h.password, "{SHA}") {
-			log.Debug("auth with SHA")
-			hash := sha1.New()
-			io.WriteString(hash, password)
-			if hex.EncodeToString(hash.Sum(nil)) == h.password[5:] {
-				h.handler.ServeHTTP(w, r)
-				return
-			}
-		} else if password == h.password {
-			log.Debug("Auth with normal password")
-			h.handler.ServeHTTP(w, r)
-			return
-		}
+	if ok && h.checkAuth(username, password) {
+		h.handler.ServeHTTP(w, r)
+		return
 	}
 	w.Header().Set("WWW-Authenticate", "Basic realm=\"supervisor\"")
 	w.WriteHeader(401)
 }
 
+// check the user and password in constant time to resist the timing
+// attack, the password prefixed with "{SHA}" is the hex of its sha1 hash
+func (h *httpBasicAuth) checkAuth(username string, password string) bool {
+	userOk := subtle.ConstantTimeCompare([]byte(username), []byte(h.user)) == 1
+	expected := h.password
+	if strings.HasPrefix(expected, "{SHA}") {
+		hash := sha1.Sum([]byte(password))
+		password = hex.EncodeToString(hash[:])
+		expected = strings.ToLower(expected[len("{SHA}"):])
+	}
+	passwordOk := subtle.ConstantTimeCompare([]byte(password), []byte(expected)) == 1
+	return userOk && passwordOk
+}
+
+// the empty string value is decoded as its raw xml "<string></string>" by
+// the xml-rpc codec, but the value without any type is decoded as a string
+var emptyStringValueRegexp = regexp.MustCompile(`<value>\s*(<string></string>|<string\s*/>)\s*</value>`)
+
+// emptyStringCodec is the xml-rpc codec which decodes the empty string
+// values of the requests as the empty strings
+type emptyStringCodec struct {
+	*xml.Codec
+}
+
+func (c emptyStringCodec) NewRequest(r *http.Request) rpc.CodecRequest {
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err == nil {
+		body = emptyStringValueRegexp.ReplaceAll(body, []byte("<value></value>"))
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return c.Codec.NewRequest(r)
+}
+
 func NewXmlRPC() *XmlRPC {
-	return &XmlRPC{listeners: make(map[string]net.Listener), started: false}
+	return &XmlRPC{listeners: make(map[string]net.Listener)}
 }
 
+// close the listeners of all the http servers
 func (p *XmlRPC) Stop() {
-	for _, listener := range p.listeners {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for protocol, listener := range p.listeners {
 		listener.Close()
+		delete(p.listeners, protocol)
 	}
 }
 
-func (p *XmlRPC) StartUnixHttpServer(user string, password string, listenAddr string, s *Supervisor) {
-	os.Remove(listenAddr)
-	p.startHttpServer(user, password, "unix", listenAddr, s)
+func (p *XmlRPC) StartUnixHttpServer(user string, password string, listenAddr string, s *Supervisor) error {
+	//the abstract socket "@name" on Linux has no file to remove
+	if !strings.HasPrefix(listenAddr, "@") {
+		os.Remove(listenAddr)
+	}
+	return p.startHttpServer(user, password, "unix", listenAddr, s)
 }
 
-func (p *XmlRPC) StartInetHttpServer(user string, password string, listenAddr string, s *Supervisor) {
-	p.startHttpServer(user, password, "tcp", listenAddr, s)
+// start the http server on the tcp address "host:port", the host "*" or an
+// empty host means all the interfaces and a single port like "9001" is
+// accepted as ":9001"
+func (p *XmlRPC) StartInetHttpServer(user string, password string, listenAddr string, s *Supervisor) error {
+	if strings.HasPrefix(listenAddr, "*:") {
+		listenAddr = listenAddr[1:]
+	} else if !strings.Contains(listenAddr, ":") {
+		listenAddr = ":" + listenAddr
+	}
+	return p.startHttpServer(user, password, "tcp", listenAddr, s)
 }
 
-func (p *XmlRPC) startHttpServer(user string, password string, protocol string, listenAddr string, s *Supervisor) {
-	if p.started {
-		return
+// listen on the address and serve the http requests in background, nothing
+// is done if the server of the protocol is already started
+func (p *XmlRPC) startHttpServer(user string, password string, protocol string, listenAddr string, s *Supervisor) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.listeners[protocol]; ok {
+		return nil
 	}
-	p.started = true
 	mux := http.NewServeMux()
 	mux.Handle("/RPC2", NewHttpBasicAuth(user, password, p.createRPCServer(s)))
+	if s.IsMetricsEnabled() {
+		mux.Handle("/metrics", NewHttpBasicAuth(user, password, NewMetricsHandler(s)))
+	}
+	mux.Handle("/logtail/", NewHttpBasicAuth(user, password, NewLogtailHandler(s)))
 	rest_handler := NewSupervisorRestful(s).CreateHandler()
 	mux.Handle("/", NewHttpBasicAuth(user, password, rest_handler))
-	listener, err := net.Listen(protocol, listenAddr)
-	if err == nil {
-		p.listeners[protocol] = listener
-		http.Serve(listener, mux)
-	} else {
-		log.WithFields(log.Fields{"addr": listenAddr, "protocol": protocol}).Error("fail to listen on address")
+	listenConfig := net.ListenConfig{Control: setReuseAddr}
+	listener, err := listenConfig.Listen(context.Background(), protocol, listenAddr)
+	if err != nil {
+		return fmt.Errorf("fail to listen on %s address %s: %v", protocol, listenAddr, err)
 	}
-
+	p.listeners[protocol] = listener
+	log.WithFields(log.Fields{"addr": listenAddr, "protocol": protocol}).Info("http server is listening")
+	go http.Serve(listener, mux)
+	return nil
 }
 func (p *XmlRPC) createRPCServer(s *Supervisor) *rpc.Server {
 	RPC := rpc.NewServer()
-	xmlrpcCodec := xml.NewCodec()
+	xmlrpcCodec := emptyStringCodec{xml.NewCodec()}
 	RPC.RegisterCodec(xmlrpcCodec, "text/xml")
 	RPC.RegisterService(s, "")
 
@@ -107,18 +159,27 @@ func (p *XmlRPC) createRPCServer(s *Supervisor) *rpc.Server {
 	xmlrpcCodec.RegisterAlias("supervisor.getIdentification", "Supervisor.GetIdentification")
 	xmlrpcCodec.RegisterAlias("supervisor.getState", "Supervisor.GetState")
 	xmlrpcCodec.RegisterAlias("supervisor.getPID", "Supervisor.GetPID")
+	xmlrpcCodec.RegisterAlias("supervisor.getDaemonInfo", "Supervisor.GetDaemonInfo")
 	xmlrpcCodec.RegisterAlias("supervisor.readLog", "Supervisor.ReadLog")
 	xmlrpcCodec.RegisterAlias("supervisor.clearLog", "Supervisor.ClearLog")
 	xmlrpcCodec.RegisterAlias("supervisor.shutdown", "Supervisor.Shutdown")
 	xmlrpcCodec.RegisterAlias("supervisor.restart", "Supervisor.Restart")
 	xmlrpcCodec.RegisterAlias("supervisor.getProcessInfo", "Supervisor.GetProcessInfo")
-	xmlrpcCodec.RegisterAlias("supervisor.getSupervisorVersion", "Supervisor.GetVersion")
+	xmlrpcCodec.RegisterAlias("supervisor.getProcessStates", "Supervisor.GetProcessStates")
+	xmlrpcCodec.RegisterAlias("supervisor.getProcessStats", "Supervisor.GetProcessStats")
+	xmlrpcCodec.RegisterAlias("supervisor.getProcessLogInfo", "Supervisor.GetProcessLogInfo")
+	xmlrpcCodec.RegisterAlias("supervisor.getEffectiveConfig", "Supervisor.GetEffectiveConfig")
+	xmlrpcCodec.RegisterAlias("supervisor.getSupervisorVersion", "Supervisor.GetSupervisorVersion")
 	xmlrpcCodec.RegisterAlias("supervisor.getAllProcessInfo", "Supervisor.GetAllProcessInfo")
+	xmlrpcCodec.RegisterAlias("supervisor.getGroupProcessInfo", "Supervisor.GetGroupProcessInfo")
+	xmlrpcCodec.RegisterAlias("supervisor.getAllConfigInfo", "Supervisor.GetAllConfigInfo")
 	xmlrpcCodec.RegisterAlias("supervisor.startProcess", "Supervisor.StartProcess")
 	xmlrpcCodec.RegisterAlias("supervisor.startAllProcesses", "Supervisor.StartAllProcesses")
 	xmlrpcCodec.RegisterAlias("supervisor.startProcessGroup", "Supervisor.StartProcessGroup")
 	xmlrpcCodec.RegisterAlias("supervisor.stopProcess", "Supervisor.StopProcess")
+	xmlrpcCodec.RegisterAlias("supervisor.stopProcessWithSignal", "Supervisor.StopProcessWithSignal")
 	xmlrpcCodec.RegisterAlias("supervisor.stopProcessGroup", "Supervisor.StopProcessGroup")
+	xmlrpcCodec.RegisterAlias("supervisor.restartProcessGroup", "Supervisor.RestartProcessGroup")
 	xmlrpcCodec.RegisterAlias("supervisor.stopAllProcesses", "Supervisor.StopAllProcesses")
 	xmlrpcCodec.RegisterAlias("supervisor.signalProcess", "Supervisor.SignalProcess")
 	xmlrpcCodec.RegisterAlias("supervisor.signalProcessGroup", "Supervisor.SignalProcessGroup")
@@ -127,9 +188,14 @@ func (p *XmlRPC) createRPCServer(s *Supervisor) *rpc.Server {
 	xmlrpcCodec.RegisterAlias("supervisor.sendRemoteCommEvent", "Supervisor.SendRemoteCommEvent")
 	xmlrpcCodec.RegisterAlias("supervisor.reloadConfig", "Supervisor.ReloadConfig")
 	xmlrpcCodec.RegisterAlias("supervisor.addProcessGroup", "Supervisor.AddProcessGroup")
+	xmlrpcCodec.RegisterAlias("supervisor.addProgram", "Supervisor.AddProgram")
 	xmlrpcCodec.RegisterAlias("supervisor.removeProcessGroup", "Supervisor.RemoveProcessGroup")
 	xmlrpcCodec.RegisterAlias("supervisor.readProcessStdoutLog", "Supervisor.ReadProcessStdoutLog")
 	xmlrpcCodec.RegisterAlias("supervisor.readProcessStderrLog", "Supervisor.ReadProcessStderrLog")
+	xmlrpcCodec.RegisterAlias("supervisor.readProcessStdoutLogRange", "Supervisor.ReadProcessStdoutLogRange")
+	xmlrpcCodec.RegisterAlias("supervisor.readProcessStderrLogRange", "Supervisor.ReadProcessStderrLogRange")
+	xmlrpcCodec.RegisterAlias("supervisor.readProcessStdoutLogBackup", "Supervisor.ReadProcessStdoutLogBackup")
+	xmlrpcCodec.RegisterAlias("supervisor.readProcessStderrLogBackup", "Supervisor.ReadProcessStderrLogBackup")
 	xmlrpcCodec.RegisterAlias("supervisor.tailProcessStdoutLog", "Supervisor.TailProcessStdoutLog")
 	xmlrpcCodec.RegisterAlias("supervisor.tailProcessStderrLog", "Supervisor.TailProcessStderrLog")
 	xmlrpcCodec.RegisterAlias("supervisor.clearProcessLogs", "Supervisor.ClearProcessLogs")
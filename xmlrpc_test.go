@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/csxuejin/gorilla-xmlrpc/xml"
+	"github.com/csxuejin/supervisord/xmlrpcclient"
+)
+
+// get a free tcp address on the loopback interface
+func freeTCPAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func postVersion(url string, user string, password string) (int, error) {
+	req, _ := http.NewRequest("POST", url+"/RPC2", strings.NewReader(`<?xml version="1.0"?><methodCall><methodName>supervisor.getVersion</methodName><params></params></methodCall>`))
+	req.Header.Set("Content-Type", "text/xml")
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestInetHttpServer(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\n")
+
+	addr := freeTCPAddr(t)
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartInetHttpServer("user", "secret", addr, s); err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + addr
+	if code, err := postVersion(url, "", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("The request without auth should be rejected, status=%d, err=%v", code, err)
+	}
+	if code, err := postVersion(url, "user", "wrong"); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("The request with wrong password should be rejected, status=%d, err=%v", code, err)
+	}
+	if code, err := postVersion(url, "user", "secret"); err != nil || code != http.StatusOK {
+		t.Errorf("The request with auth should be accepted, status=%d, err=%v", code, err)
+	}
+
+	// the address is in use
+	if err := NewXmlRPC().StartInetHttpServer("", "", addr, s); err == nil || !strings.Contains(err.Error(), addr) {
+		t.Errorf("The bind failure should be reported, err=%v", err)
+	}
+}
+
+func TestInetHttpServerWithoutAuth(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\n")
+
+	addr := freeTCPAddr(t)
+	_, port, _ := net.SplitHostPort(addr)
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	// "*:port" listens on all the interfaces
+	if err := xmlRPC.StartInetHttpServer("", "", "*:"+port, s); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := postVersion("http://"+addr, "", ""); err != nil || code != http.StatusOK {
+		t.Errorf("No auth should be required, status=%d, err=%v", code, err)
+	}
+}
+
+func TestInetHttpServerRestart(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\n")
+
+	addr := freeTCPAddr(t)
+	xmlRPC := NewXmlRPC()
+	if err := xmlRPC.StartInetHttpServer("", "", addr, s); err != nil {
+		t.Fatal(err)
+	}
+	if code, err := postVersion("http://"+addr, "", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("Fail to request the server, status=%d, err=%v", code, err)
+	}
+	xmlRPC.Stop()
+	// the address is bound again at once with SO_REUSEADDR
+	xmlRPC = NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartInetHttpServer("", "", addr, s); err != nil {
+		t.Fatalf("Fail to listen on the address again: %v", err)
+	}
+}
+
+func TestUnixHttpServerWithAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the abstract unix socket is only supported on Linux")
+	}
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\n")
+
+	name := fmt.Sprintf("@supervisord-test-%d", os.Getpid())
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartUnixHttpServer("", "", name, s); err != nil {
+		t.Fatal(err)
+	}
+	client := xmlrpcclient.NewXmlRPCClient("unix://" + name)
+	if reply, err := client.GetVersion(); err != nil || reply.Value == "" {
+		t.Errorf("Fail to get version through abstract unix socket %s, err=%v", name, err)
+	}
+}
+
+func TestGetDaemonInfo(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, "[supervisord]\n")
+
+	addr := freeTCPAddr(t)
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartInetHttpServer("", "", addr, s); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := xmlrpcclient.NewXmlRPCClient("http://" + addr).GetDaemonInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := reply.Value
+	if info.Pid != os.Getpid() || info.Configfile != filepath.Join(dir, "supervisord.conf") {
+		t.Errorf("Wrong pid %d or configuration file %s", info.Pid, info.Configfile)
+	}
+	if int64(info.Start) != daemonStartTime.Unix() || info.Now < info.Start || info.Uptime != info.Now-info.Start {
+		t.Errorf("Wrong start time %d, now %d or uptime %d", info.Start, info.Now, info.Uptime)
+	}
+}
+
+// post a request calling the method without arguments and get the reply
+func postMethod(url string, method string) (string, error) {
+	resp, err := http.Post(url+"/RPC2", "text/xml", strings.NewReader(`<?xml version="1.0"?><methodCall><methodName>`+method+`</methodName><params></params></methodCall>`))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestGetProcessStates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	s := createTestSupervisor(t, dir, `[program:web]
+command=/bin/sleep 60
+startsecs=0
+numprocs=10
+process_name=%(program_name)s_%(process_num)s
+`)
+	defer s.procMgr.StopAllProcesses()
+	s.procMgr.StartAutoStartPrograms()
+
+	addr := freeTCPAddr(t)
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartInetHttpServer("", "", addr, s); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := xmlrpcclient.NewXmlRPCClient("http://" + addr).GetProcessStates()
+	if err != nil || len(reply.Value) != 10 {
+		t.Fatalf("Fail to get the process states, reply=%v, err=%v", reply, err)
+	}
+	for _, state := range reply.Value {
+		proc := s.procMgr.Find(state.Name)
+		if proc == nil || state.Group != "web" || state.Statename != proc.GetState().String() || state.Pid != proc.GetPid() {
+			t.Errorf("Wrong state %+v", state)
+		}
+	}
+
+	allInfo, err := postMethod("http://"+addr, "supervisor.getAllProcessInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states, err := postMethod("http://"+addr, "supervisor.getProcessStates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("the reply of getProcessStates is %d bytes, getAllProcessInfo is %d bytes", len(states), len(allInfo))
+	if len(states)*2 > len(allInfo) {
+		t.Errorf("The reply of getProcessStates should be less than half of getAllProcessInfo, %d and %d bytes", len(states), len(allInfo))
+	}
+}
+
+func TestCheckAuth(t *testing.T) {
+	// the sha1 of "secret"
+	sha := "{SHA}e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4"
+	tests := []struct {
+		password string
+		user     string
+		input    string
+		ok       bool
+	}{
+		{"secret", "user", "secret", true},
+		{"secret", "user", "secre", false},
+		{"secret", "other", "secret", false},
+		{sha, "user", "secret", true},
+		{sha, "user", "e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4", false},
+		{sha, "user", "wrong", false},
+	}
+	for _, test := range tests {
+		auth := NewHttpBasicAuth("user", test.password, nil)
+		if auth.checkAuth(test.user, test.input) != test.ok {
+			t.Errorf("Wrong auth result of %s/%s with password %s, expected %v", test.user, test.input, test.password, test.ok)
+		}
+	}
+}
+
+// a fake event listener which appends the body of each event to a file, the
+// file "<file>.started" is created after it is started
+const testEventListenerScript = `#!/bin/sh
+touch "$1.started"
+echo READY
+while read -r header; do
+	len=${header##*len:}
+	dd bs=1 count=$len 2>/dev/null >> "$1"
+	echo >> "$1"
+	printf 'RESULT 2\nOK'
+	echo READY
+done
+`
+
+func TestSendRemoteCommEvent(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "supervisord")
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "listener.sh")
+	ioutil.WriteFile(script, []byte(testEventListenerScript), 0755)
+	received := filepath.Join(dir, "received")
+	configFile := filepath.Join(dir, "supervisord.conf")
+	ioutil.WriteFile(configFile, []byte(fmt.Sprintf(`[eventlistener:listener]
+command=%s %s
+events=REMOTE_COMMUNICATION
+startsecs=0
+
+[eventlistener:other]
+command=%s %s
+events=PROCESS_COMMUNICATION
+startsecs=0
+`, script, received, script, filepath.Join(dir, "other"))), os.ModePerm)
+	s := NewSupervisor(configFile)
+	defer s.procMgr.StopAllProcesses()
+	if _, err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(received + ".started"); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	addr := freeTCPAddr(t)
+	xmlRPC := NewXmlRPC()
+	defer xmlRPC.Stop()
+	if err := xmlRPC.StartInetHttpServer("", "", addr, s); err != nil {
+		t.Fatal(err)
+	}
+	client := xmlrpcclient.NewXmlRPCClient("http://" + addr)
+	for _, data := range []string{"disk full", "disk ok"} {
+		if reply, err := client.SendRemoteCommEvent("alert", data); err != nil || !reply.Success {
+			t.Fatalf("Fail to send the event, reply=%v, err=%v", reply, err)
+		}
+	}
+
+	expected := "type:alert\ndisk full\ntype:alert\ndisk ok\n"
+	var b []byte
+	for i := 0; i < 50 && string(b) != expected; i++ {
+		time.Sleep(100 * time.Millisecond)
+		b, _ = ioutil.ReadFile(received)
+	}
+	if string(b) != expected {
+		t.Errorf("The event listener should receive the events, received=%q", string(b))
+	}
+	// the listener not subscribing the event doesn't receive it
+	if _, err := os.Stat(filepath.Join(dir, "other")); err == nil {
+		t.Error("The event should not be sent to the listener not subscribing it")
+	}
+}
+
+func TestEmptyStringCodec(t *testing.T) {
+	body := `<?xml version="1.0"?><methodCall><methodName>supervisor.test</methodName><params>
+<param><value><string></string></value></param>
+<param><value><string/></value></param>
+<param><value><string>  </string></value></param>
+<param><value><string>a</string></value></param>
+</params></methodCall>`
+	req, _ := http.NewRequest("POST", "/RPC2", strings.NewReader(body))
+	codecReq := emptyStringCodec{xml.NewCodec()}.NewRequest(req)
+	args := struct{ Empty, Short, Spaces, Value string }{}
+	if err := codecReq.ReadRequest(&args); err != nil {
+		t.Fatal(err)
+	}
+	if args.Empty != "" || args.Short != "" || args.Spaces != "  " || args.Value != "a" {
+		t.Errorf("Wrong decoded strings %q", args)
+	}
+}
@@ -0,0 +1,165 @@
+package xmlrpcclient
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// AuthMode is the way the user and password are sent to the server
+type AuthMode int
+
+const (
+	// send the user and password by http basic auth, this is the default
+	AUTH_BASIC AuthMode = iota
+	// answer the digest challenge of server, for example nginx with digest auth
+	AUTH_DIGEST
+)
+
+// digestAuth keeps the last digest challenge of the server, so the following
+// requests are authorized without being challenged again
+type digestAuth struct {
+	lock      sync.Mutex
+	challenge map[string]string
+	// the nonce count of the nonce in the challenge
+	nc int
+}
+
+// find the digest challenge in the WWW-Authenticate headers of the response
+func findDigestChallenge(header http.Header) (map[string]string, bool) {
+	for _, value := range header.Values("WWW-Authenticate") {
+		if len(value) > 7 && strings.EqualFold(value[:7], "Digest ") {
+			return parseDigestParams(value[7:]), true
+		}
+	}
+	return nil, false
+}
+
+// parse the comma separated key=value or key="value" pairs of digest auth,
+// the quoted value may contain commas
+func parseDigestParams(s string) map[string]string {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		value := ""
+		if strings.HasPrefix(s, "\"") {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			value = b.String()
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+}
+
+func (d *digestAuth) setChallenge(challenge map[string]string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.challenge == nil || d.challenge["nonce"] != challenge["nonce"] {
+		d.nc = 0
+	}
+	d.challenge = challenge
+}
+
+// create the Authorization header for the request, return false if the
+// server is not challenged yet or the challenge is not supported
+func (d *digestAuth) authorization(method string, uri string, user string, password string) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.challenge == nil {
+		return "", false
+	}
+	algorithm := d.challenge["algorithm"]
+	sess := strings.HasSuffix(strings.ToUpper(algorithm), "-SESS")
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return "", false
+	}
+	h := func(s string) string {
+		hasher := newHash()
+		hasher.Write([]byte(s))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	realm, nonce := d.challenge["realm"], d.challenge["nonce"]
+	qop := ""
+	if q, ok := d.challenge["qop"]; ok {
+		for _, option := range strings.Split(q, ",") {
+			if strings.TrimSpace(option) == "auth" {
+				qop = "auth"
+			}
+		}
+		// only auth-int is offered
+		if qop == "" {
+			return "", false
+		}
+	}
+	cnonce := newCnonce()
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+
+	ha1 := h(user + ":" + realm + ":" + password)
+	if sess {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+	response := ""
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		user, realm, nonce, uri, response)
+	if algorithm != "" {
+		auth += ", algorithm=" + algorithm
+	}
+	if opaque, ok := d.challenge["opaque"]; ok {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	if qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	return auth, true
+}
+
+// create a random client nonce
+func newCnonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
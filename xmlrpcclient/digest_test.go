@@ -0,0 +1,62 @@
+package xmlrpcclient
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseDigestParams(t *testing.T) {
+	params := parseDigestParams(`realm="supervisor, test", nonce="abc", qop="auth,auth-int", algorithm=MD5, opaque="x\"y"`)
+	if params["realm"] != "supervisor, test" || params["nonce"] != "abc" || params["qop"] != "auth,auth-int" ||
+		params["algorithm"] != "MD5" || params["opaque"] != `x"y` {
+		t.Errorf("Fail to parse the digest params: %v", params)
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	requests := 0
+	ncs := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Digest ") {
+			w.Header().Set("WWW-Authenticate", `Digest realm="supervisor", nonce="123456", qop="auth", opaque="abc"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p := parseDigestParams(auth[7:])
+		ha1 := md5Hex("user:supervisor:pass")
+		ha2 := md5Hex("POST:" + r.URL.RequestURI())
+		expected := md5Hex(strings.Join([]string{ha1, "123456", p["nc"], p["cnonce"], "auth", ha2}, ":"))
+		if p["response"] != expected || p["opaque"] != "abc" || p["uri"] != "/RPC2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ncs = append(ncs, p["nc"])
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.SetUser("user")
+	client.SetPassword("pass")
+	client.SetAuthMode(AUTH_DIGEST)
+	for i := 0; i < 2; i++ {
+		if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+			t.Fatalf("Fail to authorize by digest, err=%v", err)
+		}
+	}
+	// the second request is authorized by the saved challenge
+	if requests != 3 || len(ncs) != 2 || ncs[0] != "00000001" || ncs[1] != "00000002" {
+		t.Errorf("Wrong nonce count, requests=%d, nc=%v", requests, ncs)
+	}
+}
@@ -0,0 +1,131 @@
+package xmlrpcclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/csxuejin/gorilla-xmlrpc/xml"
+	"github.com/csxuejin/supervisord/faults"
+)
+
+// XmlRPCFault is returned when supervisord answers a call with a <fault>
+// response, the Code is one of the codes defined in package faults
+type XmlRPCFault struct {
+	Code    int
+	Message string
+}
+
+// the known supervisord faults, a returned fault can be compared with them
+// by IsFault() or by errors.Is()
+var (
+	ErrUnknownMethod        = &XmlRPCFault{Code: faults.UNKNOWN_METHOD, Message: "UNKNOWN_METHOD"}
+	ErrIncorrectParameters  = &XmlRPCFault{Code: faults.INCORRECT_PARAMETERS, Message: "INCORRECT_PARAMETERS"}
+	ErrBadArguments         = &XmlRPCFault{Code: faults.BAD_ARGUMENTS, Message: "BAD_ARGUMENTS"}
+	ErrSignatureUnsupported = &XmlRPCFault{Code: faults.SIGNATURE_UNSUPPORTED, Message: "SIGNATURE_UNSUPPORTED"}
+	ErrShutdownState        = &XmlRPCFault{Code: faults.SHUTDOWN_STATE, Message: "SHUTDOWN_STATE"}
+	ErrBadName              = &XmlRPCFault{Code: faults.BAD_NAME, Message: "BAD_NAME"}
+	ErrBadSignal            = &XmlRPCFault{Code: faults.BAD_SIGNAL, Message: "BAD_SIGNAL"}
+	ErrNoFile               = &XmlRPCFault{Code: faults.NO_FILE, Message: "NO_FILE"}
+	ErrNotExecutable        = &XmlRPCFault{Code: faults.NOT_EXECUTABLE, Message: "NOT_EXECUTABLE"}
+	ErrFailed               = &XmlRPCFault{Code: faults.FAILED, Message: "FAILED"}
+	ErrAbnormalTermination  = &XmlRPCFault{Code: faults.ABNORMAL_TERMINATION, Message: "ABNORMAL_TERMINATION"}
+	ErrSpawnError           = &XmlRPCFault{Code: faults.SPAWN_ERROR, Message: "SPAWN_ERROR"}
+	ErrAlreadyStarted       = &XmlRPCFault{Code: faults.ALREADY_STARTED, Message: "ALREADY_STARTED"}
+	ErrNotRunning           = &XmlRPCFault{Code: faults.NOT_RUNNING, Message: "NOT_RUNNING"}
+	ErrSuccess              = &XmlRPCFault{Code: faults.SUCCESS, Message: "SUCCESS"}
+	ErrAlreadyAdded         = &XmlRPCFault{Code: faults.ALREADY_ADDED, Message: "ALREADY_ADDED"}
+	ErrStillRunning         = &XmlRPCFault{Code: faults.STILL_RUNNING, Message: "STILL_RUNNING"}
+	ErrCantReread           = &XmlRPCFault{Code: faults.CANT_REREAD, Message: "CANT_REREAD"}
+)
+
+func (f *XmlRPCFault) Error() string {
+	return fmt.Sprintf("%d: %s", f.Code, f.Message)
+}
+
+// Is reports whether target is a fault with the same code
+func (f *XmlRPCFault) Is(target error) bool {
+	t, ok := target.(*XmlRPCFault)
+	return ok && t.Code == f.Code
+}
+
+// IsFault returns true if err is a fault returned by supervisord with the code
+func IsFault(err error, code int) bool {
+	var f *XmlRPCFault
+	return errors.As(err, &f) && f.Code == code
+}
+
+// convert the fault returned by the xml decoder to XmlRPCFault, any other
+// error is returned as it is
+func toXmlRPCFault(err error) error {
+	switch f := err.(type) {
+	case xml.Fault:
+		return &XmlRPCFault{Code: f.Code, Message: f.String}
+	case *xml.Fault:
+		return &XmlRPCFault{Code: f.Code, Message: f.String}
+	}
+	return err
+}
+
+// process the response by the processors of xmlProcMgr, the error of
+// reading or parsing the response is returned, then the <fault> of the
+// response. An error is also returned if the response has neither <params>
+// nor <fault>, e.g. it is not a xml-rpc response
+func processResponse(xmlProcMgr *XmlProcessorManager, body io.Reader) error {
+	getFault := addFaultProcessors(xmlProcMgr)
+	err := xmlProcMgr.ProcessXml(body)
+	if readErr := bodyReadError(body); readErr != nil {
+		return readErr
+	}
+	if err != nil {
+		return fmt.Errorf("fail to decode the response: %w", err)
+	}
+	return getFault()
+}
+
+// add the processors to collect the <fault> of a response to the xmlProcMgr.
+//
+// Return a function to get the fault after the xml is processed, it returns
+// nil if the response has <params>
+func addFaultProcessors(xmlProcMgr *XmlProcessorManager) func() error {
+	var fault *XmlRPCFault
+	hasParams := false
+	// <params> is ended as a leaf node if there is a space before </params>
+	xmlProcMgr.AddNonLeafProcessor("methodResponse/params", func() { hasParams = true })
+	xmlProcMgr.AddLeafProcessor("methodResponse/params", func(value string) { hasParams = true })
+	setFault := func() {
+		if fault == nil {
+			fault = &XmlRPCFault{}
+		}
+	}
+	xmlProcMgr.AddNonLeafProcessor("methodResponse/fault", setFault)
+	xmlProcMgr.AddLeafProcessor("methodResponse/fault", func(value string) { setFault() })
+	memberName := ""
+	setValue := func(value string) {
+		setFault()
+		switch memberName {
+		case "faultCode":
+			fault.Code, _ = strconv.Atoi(value)
+		case "faultString":
+			fault.Message = value
+		}
+	}
+	prefix := "methodResponse/fault/value/struct/member"
+	xmlProcMgr.AddLeafProcessor(prefix+"/name", func(value string) {
+		memberName = value
+	})
+	xmlProcMgr.AddLeafProcessor(prefix+"/value", setValue)
+	xmlProcMgr.AddLeafProcessor(prefix+"/value/int", setValue)
+	xmlProcMgr.AddLeafProcessor(prefix+"/value/i4", setValue)
+	xmlProcMgr.AddLeafProcessor(prefix+"/value/string", setValue)
+	return func() error {
+		if fault != nil {
+			return fault
+		}
+		if !hasParams {
+			return errors.New("fail to decode the response: no params or fault")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+package xmlrpcclient
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// the interval to poll the log when no new data is available
+var followPollInterval = time.Second
+
+// the max bytes read by one tail request when following a log
+const followReadSize = 64 * 1024
+
+// FollowStdout streams the stdout log of the process written after it is
+// called, like "tail -f". The log is polled by tailProcessStdoutLog and the
+// new bytes are sent on the returned channel until ctx is canceled, then the
+// channel is closed. An error is returned if the log can't be tailed at all
+func (r *XmlRPCClient) FollowStdout(ctx context.Context, name string) (<-chan []byte, error) {
+	return r.followLog(ctx, "supervisor.tailProcessStdoutLog", name)
+}
+
+// FollowStderr streams the stderr log of the process like FollowStdout
+func (r *XmlRPCClient) FollowStderr(ctx context.Context, name string) (<-chan []byte, error) {
+	return r.followLog(ctx, "supervisor.tailProcessStderrLog", name)
+}
+
+func (r *XmlRPCClient) followLog(ctx context.Context, method string, name string) (<-chan []byte, error) {
+	// the offset beyond the end of log gets the current size of the log
+	reply, err := r.tailProcessLog(ctx, method, name, math.MaxInt32, 0)
+	if err != nil {
+		return nil, err
+	}
+	offset := reply.Offset
+	ch := make(chan []byte)
+	go func() {
+		defer close(ch)
+		for {
+			reply, err := r.tailProcessLog(ctx, method, name, offset, followReadSize)
+			if ctx.Err() != nil {
+				return
+			}
+			if err == nil && reply.Overflow && reply.Offset < offset {
+				// the log is rotated or cleared, follow the new log from
+				// its beginning
+				offset = 0
+				continue
+			}
+			if err == nil && len(reply.LogData) > 0 {
+				select {
+				case ch <- []byte(reply.LogData):
+				case <-ctx.Done():
+					return
+				}
+				offset = reply.Offset
+				// more data may be waiting
+				if len(reply.LogData) >= followReadSize {
+					continue
+				}
+			} else if err == nil {
+				offset = reply.Offset
+			}
+			// the failed request is retried in the next poll
+			select {
+			case <-time.After(followPollInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
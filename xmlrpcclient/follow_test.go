@@ -0,0 +1,88 @@
+package xmlrpcclient
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a server answers tailProcessStdoutLog like supervisord with the log
+type tailServer struct {
+	lock sync.Mutex
+	log  string
+}
+
+func (s *tailServer) setLog(log string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.log = log
+}
+
+func (s *tailServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	params := regexp.MustCompile(`<(?:int|i4)>(-?\d+)</`).FindAllStringSubmatch(string(b), -1)
+	offset, _ := strconv.Atoi(params[0][1])
+	length, _ := strconv.Atoi(params[1][1])
+
+	s.lock.Lock()
+	data, overflow := "", false
+	if offset >= len(s.log) {
+		offset, overflow = len(s.log), true
+	} else {
+		if offset+length > len(s.log) {
+			length = len(s.log) - offset
+		}
+		data = s.log[offset : offset+length]
+		offset += length
+	}
+	s.lock.Unlock()
+	fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><string>%s</string></value><value><int>%d</int></value><value><boolean>%v</boolean></value>
+</data></array></value></param></params></methodResponse>`, data, offset, overflow)
+}
+
+func receiveLog(t *testing.T, ch <-chan []byte) string {
+	select {
+	case b := <-ch:
+		return string(b)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No log is received")
+	}
+	return ""
+}
+
+func TestFollowStdout(t *testing.T) {
+	followPollInterval = 10 * time.Millisecond
+	defer func() { followPollInterval = time.Second }()
+	tail := &tailServer{log: "old log\n"}
+	server := httptest.NewServer(tail)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := client.FollowStdout(ctx, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the log written after following is streamed
+	tail.setLog("old log\nline 1\n")
+	if s := receiveLog(t, ch); s != "line 1\n" {
+		t.Errorf("Wrong log: %q", s)
+	}
+	// the rotated log is followed from its beginning
+	tail.setLog("new\n")
+	if s := receiveLog(t, ch); s != "new\n" {
+		t.Errorf("Wrong log after rotation: %q", s)
+	}
+
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,95 @@
+package xmlrpcclient
+
+import (
+	"context"
+	"io"
+)
+
+// ReloadConfigChange is the kind of a change in the reloadConfig result, in
+// the order of the arrays in the response
+type ReloadConfigChange int
+
+const (
+	ADDED_GROUP ReloadConfigChange = iota
+	CHANGED_GROUP
+	REMOVED_GROUP
+	ADDED_PROGRAM
+	CHANGED_PROGRAM
+	REMOVED_PROGRAM
+)
+
+func (c ReloadConfigChange) String() string {
+	switch c {
+	case ADDED_GROUP:
+		return "added group"
+	case CHANGED_GROUP:
+		return "changed group"
+	case REMOVED_GROUP:
+		return "removed group"
+	case ADDED_PROGRAM:
+		return "added program"
+	case CHANGED_PROGRAM:
+		return "changed program"
+	case REMOVED_PROGRAM:
+		return "removed program"
+	}
+	return "unknown"
+}
+
+// ReloadConfigEvent is a group or program changed by reloadConfig, it is sent
+// by ReloadConfigStream. The Err is only set in the last event if the
+// response is a fault or can't be read
+type ReloadConfigEvent struct {
+	Change ReloadConfigChange
+	Name   string
+	Err    error
+}
+
+// ReloadConfigStream reloads the configuration like ReloadConfig but sends
+// each changed group or program on the returned channel as soon as it is
+// parsed from the response, so the changes can be applied before the whole
+// response is received. The channel is closed after the response is parsed
+// or ctx is canceled. An error is returned if the request can't be sent
+func (r *XmlRPCClient) ReloadConfigStream(ctx context.Context) (<-chan ReloadConfigEvent, error) {
+	ins := struct{}{}
+	resp, err := r.post(ctx, "supervisor.reloadConfig", &ins)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan ReloadConfigEvent)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		send := func(event ReloadConfigEvent) {
+			select {
+			case ch <- event:
+			case <-ctx.Done():
+			}
+		}
+		err := processReloadConfig(resp.Body, func(change ReloadConfigChange, name string) {
+			send(ReloadConfigEvent{Change: change, Name: name})
+		})
+		if err != nil {
+			send(ReloadConfigEvent{Err: err})
+		}
+	}()
+	return ch, nil
+}
+
+// parse the reloadConfig response and call changed for each changed group
+// or program while the response is read
+func processReloadConfig(body io.Reader, changed func(change ReloadConfigChange, name string)) error {
+	xmlProcMgr := NewXmlProcessorManager()
+	//each param is an array of names, the param is ended as a leaf node if
+	//the array is not empty
+	i := 0
+	xmlProcMgr.AddNonLeafProcessor("methodResponse/params/param", func() { i++ })
+	xmlProcMgr.AddLeafProcessor("methodResponse/params/param", func(value string) { i++ })
+	xmlProcMgr.AddLeafProcessor("methodResponse/params/param/value/array/data/value", func(value string) {
+		if i <= int(REMOVED_PROGRAM) {
+			changed(ReloadConfigChange(i), value)
+		}
+	})
+
+	return processResponse(xmlProcMgr, body)
+}
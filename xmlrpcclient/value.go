@@ -0,0 +1,221 @@
+package xmlrpcclient
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmlValue is the <value> element of xml-rpc, only the field of the
+// value type is set
+type xmlValue struct {
+	Int      *string    `xml:"int"`
+	I4       *string    `xml:"i4"`
+	Boolean  *string    `xml:"boolean"`
+	Double   *string    `xml:"double"`
+	String   *string    `xml:"string"`
+	DateTime *string    `xml:"dateTime.iso8601"`
+	Base64   *string    `xml:"base64"`
+	Array    *xmlArray  `xml:"array"`
+	Struct   *xmlStruct `xml:"struct"`
+	Nil      *struct{}  `xml:"nil"`
+	CharData string     `xml:",chardata"`
+}
+
+type xmlArray struct {
+	Values []xmlValue `xml:"data>value"`
+}
+
+type xmlStruct struct {
+	Members []xmlMember `xml:"member"`
+}
+
+type xmlMember struct {
+	Name  string   `xml:"name"`
+	Value xmlValue `xml:"value"`
+}
+
+type xmlMethodResponse struct {
+	Params []xmlValue `xml:"params>param>value"`
+	Fault  *xmlValue  `xml:"fault>value"`
+}
+
+// convert the xml-rpc value to go value:
+//
+//	int, i4          -> int
+//	boolean          -> bool
+//	double           -> float64
+//	string           -> string
+//	dateTime.iso8601 -> time.Time
+//	base64           -> []byte
+//	array            -> []interface{}
+//	struct           -> map[string]interface{}
+//	nil              -> nil
+//
+// a value without type is a string
+func (v *xmlValue) toInterface() (interface{}, error) {
+	switch {
+	case v.Int != nil:
+		return strconv.Atoi(strings.TrimSpace(*v.Int))
+	case v.I4 != nil:
+		return strconv.Atoi(strings.TrimSpace(*v.I4))
+	case v.Boolean != nil:
+		return strconv.ParseBool(strings.TrimSpace(*v.Boolean))
+	case v.Double != nil:
+		return strconv.ParseFloat(strings.TrimSpace(*v.Double), 64)
+	case v.String != nil:
+		return *v.String, nil
+	case v.DateTime != nil:
+		return time.ParseInLocation("20060102T15:04:05", strings.TrimSpace(*v.DateTime), time.Local)
+	case v.Base64 != nil:
+		return base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+	case v.Array != nil:
+		result := make([]interface{}, 0)
+		for i := range v.Array.Values {
+			value, err := v.Array.Values[i].toInterface()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	case v.Struct != nil:
+		result := make(map[string]interface{})
+		for i := range v.Struct.Members {
+			value, err := v.Struct.Members[i].Value.toInterface()
+			if err != nil {
+				return nil, err
+			}
+			result[v.Struct.Members[i].Name] = value
+		}
+		return result, nil
+	case v.Nil != nil:
+		return nil, nil
+	}
+	return v.CharData, nil
+}
+
+// convert a fault struct {faultCode, faultString} to XmlRPCFault
+func toFault(value interface{}) (*XmlRPCFault, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	code, ok := m["faultCode"].(int)
+	if !ok {
+		return nil, false
+	}
+	message, _ := m["faultString"].(string)
+	return &XmlRPCFault{Code: code, Message: message}, true
+}
+
+// set the fields of struct pointed by v from the struct member with the
+// same name as the xml tag of field, the members of other types are ignored
+func decodeStruct(m map[string]interface{}, v interface{}) {
+	rv := reflect.ValueOf(v).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		name := strings.Split(rv.Type().Field(i).Tag.Get("xml"), ",")[0]
+		value, ok := m[name]
+		if name == "" || !ok || value == nil {
+			continue
+		}
+		if field := rv.Field(i); reflect.TypeOf(value).AssignableTo(field.Type()) {
+			field.Set(reflect.ValueOf(value))
+		}
+	}
+}
+
+// decode the array of structs in the response to the slice pointed by v by
+// the XmlProcessorManager while the response is read. The struct members are
+// set to the fields with the same xml tag like decodeStruct, the members of
+// other types are ignored. A <fault> response is returned as *XmlRPCFault
+func decodeStructArray(body io.Reader, v interface{}) error {
+	slice := reflect.ValueOf(v).Elem()
+	elemType := slice.Type().Elem()
+	fields := make(map[string]int)
+	for i := 0; i < elemType.NumField(); i++ {
+		if name := strings.Split(elemType.Field(i).Tag.Get("xml"), ",")[0]; name != "" {
+			fields[name] = i
+		}
+	}
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	elem := reflect.New(elemType).Elem()
+	memberName := ""
+	//the data of a typed value is processed again as the leaf <value>
+	valueSet := false
+	setValue := func(value string) {
+		i, ok := fields[memberName]
+		if valueSet || !ok {
+			return
+		}
+		valueSet = true
+		field := elem.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			if n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				field.SetInt(n)
+			}
+		case reflect.Bool:
+			value = strings.TrimSpace(value)
+			field.SetBool(value == "1" || strings.ToLower(value) == "true")
+		case reflect.Float64:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				field.SetFloat(f)
+			}
+		}
+	}
+	//the struct is ended as a leaf node if there is a space before </struct>
+	endStruct := func() {
+		slice.Set(reflect.Append(slice, elem))
+		elem = reflect.New(elemType).Elem()
+	}
+
+	prefix := "methodResponse/params/param/value/array/data/value/struct"
+	xmlProcMgr := NewXmlProcessorManager()
+	xmlProcMgr.AddNonLeafProcessor(prefix, endStruct)
+	xmlProcMgr.AddLeafProcessor(prefix, func(value string) { endStruct() })
+	xmlProcMgr.AddLeafProcessor(prefix+"/member/name", func(value string) {
+		memberName = value
+		valueSet = false
+	})
+	xmlProcMgr.AddLeafProcessor(prefix+"/member/value", setValue)
+	for _, valueType := range []string{"int", "i4", "boolean", "double", "string", "dateTime.iso8601", "base64"} {
+		xmlProcMgr.AddLeafProcessor(prefix+"/member/value/"+valueType, setValue)
+	}
+	return processResponse(xmlProcMgr, body)
+}
+
+// decode the params of the xml-rpc response to go values, a <fault> response
+// is returned as *XmlRPCFault
+func decodeResponseValues(body io.Reader) ([]interface{}, error) {
+	var resp xmlMethodResponse
+	if err := xml.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("fail to decode the response: %w", err)
+	}
+	if resp.Fault != nil {
+		value, err := resp.Fault.toInterface()
+		if err != nil {
+			return nil, err
+		}
+		if fault, ok := toFault(value); ok {
+			return nil, fault
+		}
+		return nil, fmt.Errorf("invalid fault in the response")
+	}
+	result := make([]interface{}, 0)
+	for i := range resp.Params {
+		value, err := resp.Params[i].toInterface()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
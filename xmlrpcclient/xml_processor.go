@@ -79,15 +79,21 @@ func (xpm *XmlProcessorManager) ProcessNonLeafNode(path string) {
 	}
 }
 
-func (xpm *XmlProcessorManager) ProcessXml(reader io.Reader) {
+// ProcessXml calls the processors for the elements read from reader until
+// the end of the xml, the error of parsing the xml is returned, e.g. the xml
+// is truncated
+func (xpm *XmlProcessorManager) ProcessXml(reader io.Reader) error {
 	decoder := xml.NewDecoder(reader)
 	var curData xml.CharData
 	curPath := NewXmlPath()
 
 	for {
 		tk, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			break
+			return err
 		}
 
 		switch tk.(type) {
@@ -1,274 +1,1748 @@
 package xmlrpcclient
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	stdxml "encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/csxuejin/gorilla-xmlrpc/xml"
+	"github.com/csxuejin/supervisord/faults"
 	"github.com/csxuejin/supervisord/types"
 )
 
+// the default maximum idle (keep-alive) connections kept for one host
+const DefaultMaxIdleConnsPerHost = 4
+
+// the timeout of Ping if the context has no deadline
+const DefaultPingTimeout = 5 * time.Second
+
 type XmlRPCClient struct {
-	serverurl string
-	user      string
-	password  string
-	timeout   time.Duration
+	serverurl  string
+	user       string
+	password   string
+	authMode   AuthMode
+	digest     digestAuth
+	timeout    time.Duration
+	rpcPath    string
+	headers    http.Header
+	httpClient *http.Client
+	// the maximum attempts and the delay before the second attempt
+	retryAttempts int
+	retryDelay    time.Duration
+	// the maximum bytes of a response, 0 is no limit
+	maxResponseSize int64
+}
+
+// ErrResponseTooLarge is returned if the response is larger than the size
+// set by SetMaxResponseSize
+var ErrResponseTooLarge = errors.New("the response from supervisord is too large")
+
+// TimeoutError is returned if a call is not answered before the deadline of
+// its context or the timeout of client, or a process is not in the waited
+// state after the timeout. It is a context.DeadlineExceeded for errors.Is, so
+// the caller can retry or kill the process
+type TimeoutError struct {
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
 }
 
+func (e *TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// Timeout is true like the timeout of net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// check if the request fails because its deadline is exceeded, the error of
+// a http or an unix socket connection may be a context.DeadlineExceeded or
+// a net.Error timeout
+func isTimeout(ctx context.Context, err error) bool {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// VersionReply is the reply of GetVersion, GetAPIVersion and
+// GetSupervisorVersion
 type VersionReply struct {
 	Value string
 }
 
-type StartStopReply struct {
-	Value bool
+type StartStopReply struct {
+	Value bool
+}
+
+type ShutdownReply StartStopReply
+
+type AllProcessInfoReply struct {
+	Value []types.ProcessInfo
+}
+
+// ProcessFault is a process failed in a batch operation like
+// startAllProcesses, the FaultCode is one of the codes defined in package
+// faults
+type ProcessFault struct {
+	Name        string
+	FaultCode   int
+	FaultString string
+}
+
+// ChangeAllProcessStateReply is the reply of ChangeAllProcessState, the
+// Value are the processes changed successfully and the Faults are the failed
+// ones. The Pending are the processes not in the target state when the call
+// fails on the transport, they can be changed by ResumeAllProcessState
+type ChangeAllProcessStateReply struct {
+	Value   []types.ProcessInfo
+	Faults  []ProcessFault
+	Pending []types.ProcessInfo
+}
+
+type AllConfigInfoReply struct {
+	Value []types.ProcessConfigInfo
+}
+
+type ProcessInfoReply struct {
+	Value types.ProcessInfo
+}
+
+type ProcessStatsReply struct {
+	Value types.ProcessStats
+}
+
+type ProcessStatesReply struct {
+	Value []types.ProcessStateInfo
+}
+
+type ProcessLogInfoReply struct {
+	Value types.ProcessLogInfo
+}
+
+type EffectiveConfigReply struct {
+	Value types.ProcessEffectiveConfig
+}
+
+type DaemonInfoReply struct {
+	Value types.DaemonInfo
+}
+
+// MethodCall is one call in a system.multicall request
+type MethodCall struct {
+	MethodName string        `xml:"methodName"`
+	Params     []interface{} `xml:"params"`
+}
+
+// MulticallResult is the result of one call in a system.multicall request,
+// Fault is set if the call fails otherwise Value is the decoded result
+type MulticallResult struct {
+	Value interface{}
+	Fault *XmlRPCFault
+}
+
+type ReadLogReply struct {
+	Value string
+}
+
+// the supervisord state codes in StateReply
+const (
+	STATE_FATAL      = 2
+	STATE_RUNNING    = 1
+	STATE_RESTARTING = 0
+	STATE_SHUTDOWN   = -1
+)
+
+type StateReply struct {
+	Statecode int
+	Statename string
+}
+
+type TailLogReply struct {
+	LogData  string
+	Offset   int64
+	Overflow bool
+}
+
+func NewXmlRPCClient(serverurl string) *XmlRPCClient {
+	r := &XmlRPCClient{serverurl: serverurl, rpcPath: "/RPC2", headers: make(http.Header), retryAttempts: 1}
+	r.httpClient = &http.Client{Transport: r.newTransport()}
+	return r
+}
+
+// create the transport of the http client, the connections are kept alive
+// and reused. If the server url is an unix socket, the transport always
+// connects to the socket file.
+func (r *XmlRPCClient) newTransport() *http.Transport {
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second}
+	if sockFile, err := unixSocketPath(r.serverurl); err == nil {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", sockFile)
+		}
+	}
+	return transport
+}
+
+// SetHTTPClient replaces the http client used to send requests. If the server
+// url is an unix socket, the transport of client must connect to the socket.
+func (r *XmlRPCClient) SetHTTPClient(client *http.Client) {
+	r.httpClient = client
+}
+
+// get the transport of http client, return false if it is not *http.Transport
+func (r *XmlRPCClient) getTransport() (*http.Transport, bool) {
+	transport, ok := r.httpClient.Transport.(*http.Transport)
+	return transport, ok
+}
+
+// SetMaxIdleConnsPerHost sets the maximum idle connections kept for reuse,
+// it has no effect if the transport of the http client is not *http.Transport
+func (r *XmlRPCClient) SetMaxIdleConnsPerHost(n int) {
+	if transport, ok := r.getTransport(); ok {
+		transport.MaxIdleConnsPerHost = n
+	}
+}
+
+// SetTLSConfig sets the tls configuration used by https, for example the CA
+// of server and the client certificates. It has no effect if the transport of
+// the http client is not *http.Transport
+func (r *XmlRPCClient) SetTLSConfig(config *tls.Config) {
+	if transport, ok := r.getTransport(); ok {
+		transport.TLSClientConfig = config
+		transport.CloseIdleConnections()
+	}
+}
+
+// SetInsecureSkipVerify disables the verification of server certificate.
+//
+// This is INSECURE, anyone in the middle can impersonate the server. Use it
+// only in the development environment.
+func (r *XmlRPCClient) SetInsecureSkipVerify(skip bool) {
+	if transport, ok := r.getTransport(); ok {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = skip
+		transport.CloseIdleConnections()
+	}
+}
+
+// DialFunc creates a connection to supervisord, the http request is written
+// to the connection as it is
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// SetDialFunc replaces how the connections to supervisord are created, so
+// the client can work over a transport of its own like TLS over an unix
+// socket or a SSH tunnel. The connection is used as it is even for a https
+// server url, the tls must be done by dial if it is needed. The server url is
+// still used for the path and the Host header. A nil dial restores the
+// default connections of http, https and unix server url. It has no effect
+// if the transport of the http client is not *http.Transport
+func (r *XmlRPCClient) SetDialFunc(dial DialFunc) {
+	transport, ok := r.getTransport()
+	if !ok {
+		return
+	}
+	if dial == nil {
+		defaultTransport := r.newTransport()
+		transport.Proxy = defaultTransport.Proxy
+		transport.DialContext = defaultTransport.DialContext
+		transport.DialTLSContext = nil
+	} else {
+		dialContext := func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			return dial(ctx)
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialContext
+		transport.DialTLSContext = dialContext
+	}
+	transport.CloseIdleConnections()
+}
+
+func (r *XmlRPCClient) SetUser(user string) {
+	r.user = user
+}
+
+func (r *XmlRPCClient) SetPassword(password string) {
+	r.password = password
+}
+
+// SetAuthMode sets how the user and password are sent, the default is
+// AUTH_BASIC. With AUTH_DIGEST the request challenged by the server is sent
+// again with the digest authorization, only qop "auth" is supported
+func (r *XmlRPCClient) SetAuthMode(mode AuthMode) {
+	r.authMode = mode
+}
+
+// SetRetry retries a request at most maxAttempts times if supervisord can't
+// be connected or the request times out. The delay before the next attempt is
+// doubled after each attempt, starting from baseDelay, it is not doubled
+// beyond 30 seconds. A fault returned by
+// supervisord is never retried. The timeout of client is the budget of all
+// the attempts.
+func (r *XmlRPCClient) SetRetry(maxAttempts int, baseDelay time.Duration) {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	r.retryAttempts = maxAttempts
+	r.retryDelay = baseDelay
+}
+
+// SetHeader sets a header sent with every request, it replaces the
+// Authorization header of basic auth if the key is "Authorization"
+func (r *XmlRPCClient) SetHeader(key string, value string) {
+	r.headers.Set(key, value)
+}
+
+// SetAuthToken sends the token in the header "Authorization: Bearer <token>"
+func (r *XmlRPCClient) SetAuthToken(token string) {
+	r.SetHeader("Authorization", "Bearer "+token)
+}
+
+// SetTimeout sets the default timeout of every call. A call made by a
+// Context method whose ctx has a deadline uses the deadline instead, so one
+// call can wait longer or shorter than the others:
+//
+//	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//	defer cancel()
+//	reply, err := client.GetAllProcessInfoContext(ctx)
+func (r *XmlRPCClient) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// SetMaxResponseSize sets the maximum bytes of a response to guard against
+// a misbehaving server, a larger response fails with ErrResponseTooLarge.
+// The default 0 is no limit
+func (r *XmlRPCClient) SetMaxResponseSize(size int64) {
+	r.maxResponseSize = size
+}
+
+// SetRPCPath sets the path of xml-rpc endpoint appended to the server url,
+// the default is "/RPC2"
+func (r *XmlRPCClient) SetRPCPath(path string) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	r.rpcPath = path
+}
+
+// Validate checks the server url, the scheme must be http, https or unix
+func (r *XmlRPCClient) Validate() error {
+	if isUnixURL(r.serverurl) {
+		_, err := unixSocketPath(r.serverurl)
+		return err
+	}
+	url, err := url.Parse(r.serverurl)
+	if err != nil {
+		return fmt.Errorf("invalid server url %s: %w", r.serverurl, err)
+	}
+	switch url.Scheme {
+	case "http", "https":
+		if url.Host == "" {
+			return fmt.Errorf("invalid server url %s: no host", r.serverurl)
+		}
+	default:
+		return fmt.Errorf("invalid server url %s: unsupported scheme %q, it must be http, https or unix", r.serverurl, url.Scheme)
+	}
+	return nil
+}
+
+// check if the server url is an unix socket url
+func isUnixURL(serverurl string) bool {
+	return strings.HasPrefix(strings.ToLower(serverurl), "unix:")
+}
+
+// get the socket file from the unix server url, "unix:///abs/path",
+// "unix://relative/path" and "unix:relative/path" are all supported. The
+// path is taken from the raw url because net/url parses the first element
+// of a relative path as the host. "unix://@name" is the abstract socket
+// "name" on Linux, the "@" is kept for net.Dial
+func unixSocketPath(serverurl string) (string, error) {
+	if !isUnixURL(serverurl) {
+		return "", fmt.Errorf("invalid server url %s: not an unix socket url", serverurl)
+	}
+	path := serverurl[len("unix:"):]
+	if strings.HasPrefix(path, "//") {
+		path = path[len("//"):]
+	}
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	if path == "" || path == "@" {
+		return "", fmt.Errorf("invalid server url %s: no socket file", serverurl)
+	}
+	return path, nil
+}
+
+func (r *XmlRPCClient) Url() string {
+	return fmt.Sprintf("%s%s", strings.TrimSuffix(r.serverurl, "/"), r.rpcPath)
+}
+
+// the most bytes left in a response body read before closing it
+const maxDrainBytes = 64 * 1024
+
+// the response body cancels the request context when it is closed
+type cancelBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+	err    error
+}
+
+// the body fails with *TimeoutError if it is not read before the deadline
+func (b *cancelBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && isTimeout(b.ctx, err) {
+		b.err = &TimeoutError{Err: fmt.Errorf("fail to read the response from supervisord: %w", err)}
+		err = b.err
+	}
+	return n, err
+}
+
+// the rest of body like the end of a chunked response is read before closing,
+// the connection is reused only if the body is read to the end
+func (b *cancelBody) Close() error {
+	io.CopyN(ioutil.Discard, b.ReadCloser, maxDrainBytes)
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// the response body fails to read more than the limit bytes
+type limitBody struct {
+	io.ReadCloser
+	limit     int64
+	remaining int64
+	err       error
+}
+
+func (b *limitBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	// read one more byte to find out if the body is larger than the limit
+	if int64(len(p)) > b.remaining+1 {
+		p = p[0 : b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.err = fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, b.limit)
+		err = b.err
+	}
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// get the error of reading the response body more than the max response
+// size or after the deadline, the decoders may hide the error of reading
+// the body
+func bodyReadError(body io.Reader) error {
+	if b, ok := body.(*limitBody); ok {
+		if b.err != nil {
+			return b.err
+		}
+		body = b.ReadCloser
+	}
+	if b, ok := body.(*cancelBody); ok {
+		return b.err
+	}
+	return nil
+}
+
+// post the method call to supervisord, the request is canceled if ctx is
+// done or the timeout of client expires
+func (r *XmlRPCClient) post(ctx context.Context, method string, data interface{}) (*http.Response, error) {
+	buf, err := xml.EncodeClientRequest(method, data)
+	if err != nil {
+		return nil, fmt.Errorf("fail to encode the call of %s: %w", method, err)
+	}
+	return r.postXml(ctx, buf)
+}
+
+// Call calls a method of supervisord and decodes the result to reply, it can
+// call the methods which are not wrapped by the client.
+//
+// The exported fields of struct pointed by args are sent as the params in
+// order, a nil args sends no params. The params of response are decoded to
+// the fields of struct pointed by reply in order. A <fault> response is
+// returned as *XmlRPCFault
+func (r *XmlRPCClient) Call(method string, args interface{}, reply interface{}) error {
+	return r.CallContext(context.Background(), method, args, reply)
+}
+
+// encode the call of method with the string and integer params. The integers
+// are encoded as <int> with all their digits here because the xml-rpc codec
+// only supports int, which narrows the int64 offsets on the 32 bits
+// platforms
+func encodeCall(method string, params ...interface{}) []byte {
+	buf := bytes.NewBufferString("<methodCall><methodName>")
+	stdxml.EscapeText(buf, []byte(method))
+	buf.WriteString("</methodName><params>")
+	for _, param := range params {
+		if s, ok := param.(string); ok {
+			buf.WriteString("<param><value><string>")
+			stdxml.EscapeText(buf, []byte(s))
+			buf.WriteString("</string></value></param>")
+		} else {
+			fmt.Fprintf(buf, "<param><value><int>%d</int></value></param>", param)
+		}
+	}
+	buf.WriteString("</params></methodCall>")
+	return buf.Bytes()
+}
+
+// post the encoded method call and decode the result to reply like
+// CallContext
+func (r *XmlRPCClient) callXml(ctx context.Context, buf []byte, reply interface{}) error {
+	resp, err := r.postXml(ctx, buf)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp.Body, reply)
+}
+
+func (r *XmlRPCClient) CallContext(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if args == nil {
+		args = &struct{}{}
+	}
+	resp, err := r.post(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp.Body, reply)
+}
+
+// post the encoded xml request to supervisord
+func (r *XmlRPCClient) postXml(ctx context.Context, buf []byte) (*http.Response, error) {
+	err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+	reqUrl := r.Url()
+	if isUnixURL(r.serverurl) {
+		// the host is ignored, the transport connects to the socket file
+		reqUrl = "http://unix" + r.rpcPath
+	}
+
+	// the timeout is the budget of all the attempts, the deadline of ctx
+	// overrides the timeout of client
+	cancel := context.CancelFunc(func() {})
+	if _, ok := ctx.Deadline(); !ok && r.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+	}
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		resp, err = r.doPost(ctx, reqUrl, buf)
+		if err == nil {
+			resp.Body = &cancelBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel}
+			break
+		}
+		if attempt >= r.retryAttempts || ctx.Err() != nil || !isTransientError(err) {
+			cancel()
+			return nil, r.sendError(ctx, err)
+		}
+		select {
+		case <-ctx.Done():
+			cancel()
+			return nil, r.sendError(ctx, err)
+		case <-time.After(r.retryDelayAfter(attempt)):
+		}
+	}
+
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad response from supervisord %s: %s", r.serverurl, resp.Status)
+	}
+	if r.maxResponseSize > 0 {
+		resp.Body = &limitBody{ReadCloser: resp.Body, limit: r.maxResponseSize, remaining: r.maxResponseSize}
+	}
+	return resp, nil
+}
+
+// the delay before the next attempt is not doubled beyond it
+const maxRetryDelay = 30 * time.Second
+
+// the delay after the attempt, it is baseDelay, 2*baseDelay, 4*baseDelay ...
+// until it reaches maxRetryDelay
+func (r *XmlRPCClient) retryDelayAfter(attempt int) time.Duration {
+	delay := r.retryDelay
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	return delay
+}
+
+// the error of sending the request, it is a *TimeoutError if the deadline is
+// exceeded
+func (r *XmlRPCClient) sendError(ctx context.Context, err error) error {
+	err = fmt.Errorf("fail to send request to supervisord %s: %w", r.serverurl, err)
+	if isTimeout(ctx, err) {
+		return &TimeoutError{Err: err}
+	}
+	return err
+}
+
+// send the request, in digest auth mode a request challenged by the server
+// is sent once again with the authorization for the challenge
+func (r *XmlRPCClient) doPost(ctx context.Context, reqUrl string, buf []byte) (*http.Response, error) {
+	resp, err := r.sendRequest(ctx, reqUrl, buf)
+	if err != nil || r.authMode != AUTH_DIGEST || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge, ok := findDigestChallenge(resp.Header)
+	if !ok {
+		return resp, nil
+	}
+	resp.Body.Close()
+	r.digest.setChallenge(challenge)
+	return r.sendRequest(ctx, reqUrl, buf)
+}
+
+// send the request, if it fails to be written to a kept alive connection
+// which may be closed by the server, it is sent once again on a new
+// connection. The request already written is never sent again because it
+// may be handled by supervisord, so a call like startProcess is not run twice
+func (r *XmlRPCClient) sendRequest(ctx context.Context, reqUrl string, buf []byte) (*http.Response, error) {
+	var reused, wrote int32
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				atomic.StoreInt32(&reused, 1)
+			}
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				atomic.StoreInt32(&wrote, 1)
+			}
+		},
+	}
+	resp, err := r.doRequest(httptrace.WithClientTrace(ctx, trace), reqUrl, buf)
+	if err != nil && atomic.LoadInt32(&reused) == 1 && atomic.LoadInt32(&wrote) == 0 && ctx.Err() == nil {
+		r.httpClient.CloseIdleConnections()
+		return r.doRequest(ctx, reqUrl, buf)
+	}
+	return resp, err
+}
+
+func (r *XmlRPCClient) doRequest(ctx context.Context, reqUrl string, buf []byte) (*http.Response, error) {
+	req, err := http.NewRequest("POST", reqUrl, bytes.NewBuffer(buf))
+	if err != nil {
+		return nil, fmt.Errorf("fail to create request: %w", err)
+	}
+	if len(r.user) > 0 && len(r.password) > 0 {
+		if r.authMode == AUTH_DIGEST {
+			if auth, ok := r.digest.authorization(req.Method, req.URL.RequestURI(), r.user, r.password); ok {
+				req.Header.Set("Authorization", auth)
+			}
+		} else {
+			req.SetBasicAuth(r.user, r.password)
+		}
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	for key, values := range r.headers {
+		req.Header[key] = values
+	}
+	return r.httpClient.Do(req.WithContext(ctx))
+}
+
+// check if the error is a connection refused or timeout error, the unix
+// socket file not existing is also transient because supervisord may not
+// have created it yet
+func isTransientError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ENOENT) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// decode the response body to reply, a <fault> response is returned as *XmlRPCFault
+func decodeResponse(body io.Reader, reply interface{}) error {
+	err := xml.DecodeClientResponse(body, reply)
+	if limitErr := bodyReadError(body); limitErr != nil {
+		return limitErr
+	}
+	return toXmlRPCFault(err)
+}
+
+// call the method returning an array of structs and decode the array to the
+// slice pointed by v while the response is read, so a large response is not
+// buffered as a whole
+func (r *XmlRPCClient) callStructArray(ctx context.Context, method string, args interface{}, v interface{}) error {
+	if args == nil {
+		args = &struct{}{}
+	}
+	resp, err := r.post(ctx, method, args)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeStructArray(resp.Body, v)
+}
+
+// GetVersion returns the version of the xml-rpc API, not the version of
+// supervisord. It is kept for compatibility, it is same as GetAPIVersion
+func (r *XmlRPCClient) GetVersion() (reply VersionReply, err error) {
+	return r.GetVersionContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetVersionContext(ctx context.Context) (reply VersionReply, err error) {
+	return r.getVersion(ctx, "supervisor.getVersion")
+}
+
+// GetAPIVersion returns the version of the xml-rpc API
+func (r *XmlRPCClient) GetAPIVersion() (reply VersionReply, err error) {
+	return r.GetAPIVersionContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetAPIVersionContext(ctx context.Context) (reply VersionReply, err error) {
+	return r.getVersion(ctx, "supervisor.getAPIVersion")
+}
+
+// GetSupervisorVersion returns the version of the supervisord
+func (r *XmlRPCClient) GetSupervisorVersion() (reply VersionReply, err error) {
+	return r.GetSupervisorVersionContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetSupervisorVersionContext(ctx context.Context) (reply VersionReply, err error) {
+	return r.getVersion(ctx, "supervisor.getSupervisorVersion")
+}
+
+func (r *XmlRPCClient) getVersion(ctx context.Context, method string) (reply VersionReply, err error) {
+	err = r.CallContext(ctx, method, nil, &reply)
+	return
+}
+
+func (r *XmlRPCClient) GetAllProcessInfo() (reply AllProcessInfoReply, err error) {
+	return r.GetAllProcessInfoContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetAllProcessInfoContext(ctx context.Context) (reply AllProcessInfoReply, err error) {
+	err = r.callStructArray(ctx, "supervisor.getAllProcessInfo", nil, &reply.Value)
+	return
+}
+
+// GetGroupProcessInfo gets the information of the processes in the group
+// by the "supervisor.getGroupProcessInfo" method of this supervisord. For
+// the supervisord without the method, the processes are filtered from
+// GetAllProcessInfo by their group. An ErrBadName fault is returned if no
+// process is in the group
+func (r *XmlRPCClient) GetGroupProcessInfo(group string) (reply AllProcessInfoReply, err error) {
+	return r.GetGroupProcessInfoContext(context.Background(), group)
+}
+
+func (r *XmlRPCClient) GetGroupProcessInfoContext(ctx context.Context, group string) (reply AllProcessInfoReply, err error) {
+	ins := struct{ Name string }{group}
+	err = r.callStructArray(ctx, "supervisor.getGroupProcessInfo", &ins, &reply.Value)
+	if !IsFault(err, faults.UNKNOWN_METHOD) {
+		return
+	}
+	all, err := r.GetAllProcessInfoContext(ctx)
+	if err != nil {
+		return
+	}
+	for _, info := range all.Value {
+		if info.Group == group {
+			reply.Value = append(reply.Value, info)
+		}
+	}
+	if len(reply.Value) <= 0 {
+		err = &XmlRPCFault{Code: faults.BAD_NAME, Message: fmt.Sprintf("BAD_NAME: %s", group)}
+	}
+	return
+}
+
+// GetProcessStates gets the name, state and pid of all the processes by the
+// "supervisor.getProcessStates" method, its reply is much smaller than
+// GetAllProcessInfo for polling. For the supervisord without the method,
+// the states are picked up from GetAllProcessInfo
+func (r *XmlRPCClient) GetProcessStates() (reply ProcessStatesReply, err error) {
+	return r.GetProcessStatesContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetProcessStatesContext(ctx context.Context) (reply ProcessStatesReply, err error) {
+	err = r.callStructArray(ctx, "supervisor.getProcessStates", nil, &reply.Value)
+	if !IsFault(err, faults.UNKNOWN_METHOD) {
+		return
+	}
+	all, err := r.GetAllProcessInfoContext(ctx)
+	if err != nil {
+		return
+	}
+	reply.Value = make([]types.ProcessStateInfo, 0)
+	for _, info := range all.Value {
+		reply.Value = append(reply.Value, types.ProcessStateInfo{Name: info.Name,
+			Group:     info.Group,
+			State:     info.State,
+			Statename: info.Statename,
+			Pid:       info.Pid})
+	}
+	return
+}
+
+// GetAllConfigInfo gets the configuration of all the programs
+func (r *XmlRPCClient) GetAllConfigInfo() (reply AllConfigInfoReply, err error) {
+	return r.GetAllConfigInfoContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetAllConfigInfoContext(ctx context.Context) (reply AllConfigInfoReply, err error) {
+	err = r.CallContext(ctx, "supervisor.getAllConfigInfo", nil, &reply)
+	return
+}
+
+// GetState gets the state of supervisord, the state is one of:
+//
+//	statecode  statename
+//	2          FATAL
+//	1          RUNNING
+//	0          RESTARTING
+//	-1         SHUTDOWN
+func (r *XmlRPCClient) GetState() (reply StateReply, err error) {
+	return r.GetStateContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetStateContext(ctx context.Context) (reply StateReply, err error) {
+	result := struct{ Value StateReply }{}
+	err = r.CallContext(ctx, "supervisor.getState", nil, &result)
+	reply = result.Value
+	return
+}
+
+// Ping checks if supervisord answers a cheap getState call, it is nil if the
+// server is alive. The fault or the transport error is returned otherwise, so
+// the reason why the server is down can be logged. The call is canceled after
+// DefaultPingTimeout if ctx of PingContext has no deadline
+func (r *XmlRPCClient) Ping() error {
+	return r.PingContext(context.Background())
+}
+
+func (r *XmlRPCClient) PingContext(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultPingTimeout)
+		defer cancel()
+	}
+	_, err := r.GetStateContext(ctx)
+	return err
+}
+
+// GetDaemonInfo gets the pid, the start time, the uptime and the
+// configuration file of supervisord
+func (r *XmlRPCClient) GetDaemonInfo() (reply DaemonInfoReply, err error) {
+	return r.GetDaemonInfoContext(context.Background())
+}
+
+func (r *XmlRPCClient) GetDaemonInfoContext(ctx context.Context) (reply DaemonInfoReply, err error) {
+	err = r.CallContext(ctx, "supervisor.getDaemonInfo", nil, &reply)
+	return
+}
+
+// ReadLog reads length bytes from offset of the supervisord log, the arguments
+// follow the supervisor semantics:
+//
+//	offset >= 0, length > 0: read length bytes from offset
+//	offset >= 0, length == 0: read from offset to the end of log
+//	offset < 0, length == 0: read the last -offset bytes
+func (r *XmlRPCClient) ReadLog(offset int64, length int) (reply ReadLogReply, err error) {
+	return r.ReadLogContext(context.Background(), offset, length)
+}
+
+func (r *XmlRPCClient) ReadLogContext(ctx context.Context, offset int64, length int) (reply ReadLogReply, err error) {
+	err = r.callXml(ctx, encodeCall("supervisor.readLog", offset, length), &reply)
+	return
+}
+
+// ClearLog clears the supervisord log
+func (r *XmlRPCClient) ClearLog() (reply types.BooleanReply, err error) {
+	return r.ClearLogContext(context.Background())
+}
+
+func (r *XmlRPCClient) ClearLogContext(ctx context.Context) (reply types.BooleanReply, err error) {
+	err = r.CallContext(ctx, "supervisor.clearLog", nil, &reply)
+	return
+}
+
+// GetProcessInfo gets the information of one process, a BAD_NAME fault is
+// returned if no such process
+func (r *XmlRPCClient) GetProcessInfo(name string) (reply ProcessInfoReply, err error) {
+	return r.GetProcessInfoContext(context.Background(), name)
+}
+
+func (r *XmlRPCClient) GetProcessInfoContext(ctx context.Context, name string) (reply ProcessInfoReply, err error) {
+	ins := struct{ Name string }{name}
+	err = r.CallContext(ctx, "supervisor.getProcessInfo", &ins, &reply)
+	return
+}
+
+// GetProcessStats gets the cpu and memory usage of a running process, a
+// NOT_RUNNING fault is returned if the process is not running
+func (r *XmlRPCClient) GetProcessStats(name string) (reply ProcessStatsReply, err error) {
+	return r.GetProcessStatsContext(context.Background(), name)
+}
+
+func (r *XmlRPCClient) GetProcessStatsContext(ctx context.Context, name string) (reply ProcessStatsReply, err error) {
+	ins := struct{ Name string }{name}
+	err = r.CallContext(ctx, "supervisor.getProcessStats", &ins, &reply)
+	return
+}
+
+// GetProcessLogInfo gets the stdout and stderr log files of the process with
+// the number of their rotated backups and whether the capture and events
+// are enabled
+func (r *XmlRPCClient) GetProcessLogInfo(name string) (reply ProcessLogInfoReply, err error) {
+	return r.GetProcessLogInfoContext(context.Background(), name)
+}
+
+func (r *XmlRPCClient) GetProcessLogInfoContext(ctx context.Context, name string) (reply ProcessLogInfoReply, err error) {
+	ins := struct{ Name string }{name}
+	err = r.CallContext(ctx, "supervisor.getProcessLogInfo", &ins, &reply)
+	return
+}
+
+// GetEffectiveConfig gets the configuration the process is started with,
+// the command, directory, environment and user are resolved by supervisord
+func (r *XmlRPCClient) GetEffectiveConfig(name string) (reply EffectiveConfigReply, err error) {
+	return r.GetEffectiveConfigContext(context.Background(), name)
+}
+func (r *XmlRPCClient) GetEffectiveConfigContext(ctx context.Context, name string) (reply EffectiveConfigReply, err error) {
+	ins := struct{ Name string }{name}
+	err = r.CallContext(ctx, "supervisor.getEffectiveConfig", &ins, &reply)
+	return
+}
+
+// ChangeProcessState starts or stops the process and waits until it is
+// started or stopped
+func (r *XmlRPCClient) ChangeProcessState(change string, processName string) (reply StartStopReply, err error) {
+	return r.ChangeProcessStateContext(context.Background(), change, processName)
+}
+
+func (r *XmlRPCClient) ChangeProcessStateContext(ctx context.Context, change string, processName string) (reply StartStopReply, err error) {
+	return r.changeProcessState(ctx, change, processName, true)
+}
+
+// ChangeProcessStateWait starts or stops the process, the wait is sent to
+// supervisord as the second param of startProcess or stopProcess. If wait is
+// true the call returns after the process is RUNNING or stopped, otherwise it
+// returns once the change is begun
+func (r *XmlRPCClient) ChangeProcessStateWait(change string, processName string, wait bool) (reply StartStopReply, err error) {
+	return r.ChangeProcessStateWaitContext(context.Background(), change, processName, wait)
+}
+
+func (r *XmlRPCClient) ChangeProcessStateWaitContext(ctx context.Context, change string, processName string, wait bool) (reply StartStopReply, err error) {
+	return r.changeProcessState(ctx, change, processName, wait)
+}
+
+// StartProcessNoWait starts the process and returns after it is spawned
+// without waiting for startsecs, the process state can be got by
+// GetProcessInfo later
+func (r *XmlRPCClient) StartProcessNoWait(processName string) (reply StartStopReply, err error) {
+	return r.StartProcessNoWaitContext(context.Background(), processName)
+}
+
+func (r *XmlRPCClient) StartProcessNoWaitContext(ctx context.Context, processName string) (reply StartStopReply, err error) {
+	return r.changeProcessState(ctx, "start", processName, false)
+}
+
+func (r *XmlRPCClient) changeProcessState(ctx context.Context, change string, processName string, wait bool) (reply StartStopReply, err error) {
+	if !(change == "start" || change == "stop") {
+		err = fmt.Errorf("Incorrect required state")
+		return
+	}
+
+	ins := struct {
+		Value string
+		Wait  bool
+	}{processName, wait}
+	err = r.CallContext(ctx, fmt.Sprintf("supervisor.%sProcess", change), &ins, &reply)
+	return
+}
+
+// SendProcessStdin writes chars to the stdin of the process. A NOT_RUNNING
+// fault is returned if the process is not running and a NO_FILE fault is
+// returned if the stdin of process can't be written.
+//
+// The control characters are escaped so they are not changed by the xml
+// parser, an error is returned if chars contains a character not allowed in xml
+func (r *XmlRPCClient) SendProcessStdin(name string, chars string) (reply types.BooleanReply, err error) {
+	return r.SendProcessStdinContext(context.Background(), name, chars)
+}
+
+func (r *XmlRPCClient) SendProcessStdinContext(ctx context.Context, name string, chars string) (reply types.BooleanReply, err error) {
+	buf := bytes.NewBufferString("<methodCall><methodName>supervisor.sendProcessStdin</methodName><params>")
+	for _, param := range []string{name, chars} {
+		for _, c := range param {
+			if !isXmlChar(c) {
+				err = fmt.Errorf("character %q can't be sent in xml", c)
+				return
+			}
+		}
+		buf.WriteString("<param><value><string>")
+		stdxml.EscapeText(buf, []byte(param))
+		buf.WriteString("</string></value></param>")
+	}
+	buf.WriteString("</params></methodCall>")
+	resp, err := r.postXml(ctx, buf.Bytes())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	err = decodeResponse(resp.Body, &reply)
+	return
 }
 
-type ShutdownReply StartStopReply
-
-type AllProcessInfoReply struct {
-	Value []types.ProcessInfo
+// check if the character is allowed in xml 1.0
+func isXmlChar(c rune) bool {
+	return c == 0x09 || c == 0x0A || c == 0x0D ||
+		(c >= 0x20 && c <= 0xD7FF) ||
+		(c >= 0xE000 && c <= 0xFFFD) ||
+		(c >= 0x10000 && c <= 0x10FFFF)
 }
 
-func NewXmlRPCClient(serverurl string) *XmlRPCClient {
-	return &XmlRPCClient{serverurl: serverurl}
+// SendRemoteCommEvent emits a REMOTE_COMMUNICATION event with the type and
+// data to the event listeners of supervisord
+func (r *XmlRPCClient) SendRemoteCommEvent(eventType string, data string) (reply types.BooleanReply, err error) {
+	return r.SendRemoteCommEventContext(context.Background(), eventType, data)
 }
 
-func (r *XmlRPCClient) SetUser(user string) {
-	r.user = user
+func (r *XmlRPCClient) SendRemoteCommEventContext(ctx context.Context, eventType string, data string) (reply types.BooleanReply, err error) {
+	ins := struct {
+		Type string
+		Data string
+	}{eventType, data}
+	err = r.CallContext(ctx, "supervisor.sendRemoteCommEvent", &ins, &reply)
+	return
 }
 
-func (r *XmlRPCClient) SetPassword(password string) {
-	r.password = password
+// RestartProcess stops the process, waits until it is stopped and then starts
+// it again. An error is returned if the process is still not stopped after
+// timeout, a timeout <= 0 means waiting until the process stops.
+func (r *XmlRPCClient) RestartProcess(name string, timeout time.Duration) (reply StartStopReply, err error) {
+	return r.RestartProcessContext(context.Background(), name, timeout)
 }
 
-func (r *XmlRPCClient) SetTimeout(timeout time.Duration) {
-	r.timeout = timeout
+func (r *XmlRPCClient) RestartProcessContext(ctx context.Context, name string, timeout time.Duration) (reply StartStopReply, err error) {
+	_, err = r.ChangeProcessStateContext(ctx, "stop", name)
+	if err != nil && !IsFault(err, faults.NOT_RUNNING) {
+		return
+	}
+	err = r.waitProcessStopped(ctx, name, timeout)
+	if err != nil {
+		return
+	}
+	return r.ChangeProcessStateContext(ctx, "start", name)
 }
 
-func (r *XmlRPCClient) Url() string {
-	return fmt.Sprintf("%s/RPC2", r.serverurl)
+// StopProcessWithSignal stops the process with the signal instead of its
+// configured stopsignal and waits until it is stopped, for example QUIT to
+// get a core dump. An error is returned if the process is still not stopped
+// after timeout, a timeout <= 0 means waiting until the process stops.
+func (r *XmlRPCClient) StopProcessWithSignal(name string, signal string, timeout time.Duration) (reply StartStopReply, err error) {
+	return r.StopProcessWithSignalContext(context.Background(), name, signal, timeout)
 }
 
-func (r *XmlRPCClient) post(method string, data interface{}) (*http.Response, error) {
-	buf, _ := xml.EncodeClientRequest(method, data)
-	url, err := url.Parse(r.serverurl)
+func (r *XmlRPCClient) StopProcessWithSignalContext(ctx context.Context, name string, signal string, timeout time.Duration) (reply StartStopReply, err error) {
+	ins := types.ProcessSignal{Name: name, Signal: signal}
+	err = r.CallContext(ctx, "supervisor.stopProcessWithSignal", &ins, &reply)
 	if err != nil {
-		return nil, err
+		return
 	}
-	var resp *http.Response
-	if url.Scheme == "http" || url.Scheme == "https" {
-		req, err := http.NewRequest("POST", r.Url(), bytes.NewBuffer(buf))
-		if err != nil {
-			fmt.Println("Fail to create request:", err)
-			return nil, err
-		}
-		if len(r.user) > 0 && len(r.password) > 0 {
-			req.SetBasicAuth(r.user, r.password)
-		}
-
-		if r.timeout > 0 {
-			ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-			defer cancel()
-			req = req.WithContext(ctx)
-		}
+	err = r.waitProcessStopped(ctx, name, timeout)
+	return
+}
 
-		req.Header.Set("Content-Type", "text/xml")
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			fmt.Println("Fail to send request to supervisord:", err)
-			return nil, err
-		}
-	} else if url.Scheme == "unix" {
-		var conn net.Conn
-		var err error
-		if r.timeout > 0 {
-			conn, err = net.DialTimeout("unix", url.Path, r.timeout)
-		} else {
-			conn, err = net.Dial("unix", url.Path)
-		}
-		if err != nil {
-			fmt.Printf("Fail to connect unix socket path: %s\n", r.serverurl)
-			return nil, err
-		}
-		defer conn.Close()
+// the interval to poll the process state
+const pollInterval = 500 * time.Millisecond
 
-		if r.timeout > 0 {
-			if err := conn.SetDeadline(time.Now().Add(r.timeout)); err != nil {
-				return nil, err
-			}
-		}
+// wait until the process is in STOPPED, EXITED or FATAL state
+func (r *XmlRPCClient) waitProcessStopped(ctx context.Context, name string, timeout time.Duration) error {
+	_, err := r.waitProcessState(ctx, name, timeout, "stop", "STOPPED", "EXITED", "FATAL")
+	return err
+}
 
-		req, err := http.NewRequest("POST", "/RPC2", bytes.NewBuffer(buf))
+// wait until the process is in one of the states and return the state, the
+// action is what the process is waited for in the timeout error
+func (r *XmlRPCClient) waitProcessState(ctx context.Context, name string, timeout time.Duration, action string, states ...string) (string, error) {
+	endTime := time.Now().Add(timeout)
+	for {
+		info, err := r.GetProcessInfoContext(ctx, name)
 		if err != nil {
-			fmt.Printf("Fail to create a http request")
-			return nil, err
+			return "", err
 		}
-		if len(r.user) > 0 && len(r.password) > 0 {
-			req.SetBasicAuth(r.user, r.password)
+		for _, state := range states {
+			if info.Value.Statename == state {
+				return state, nil
+			}
 		}
-		req.Header.Set("Content-Type", "text/xml")
-		err = req.Write(conn)
-		if err != nil {
-			fmt.Printf("Fail to write to unix socket %s\n", r.serverurl)
-			return nil, err
+		if timeout > 0 && time.Now().After(endTime) {
+			return info.Value.Statename, &TimeoutError{Err: fmt.Errorf("process %s is still %s after waiting %v for it to %s", name, info.Value.Statename, timeout, action)}
 		}
-		resp, err = http.ReadResponse(bufio.NewReader(conn), req)
-		if err != nil {
-			fmt.Printf("Fail to read response %s\n", err)
-			return nil, err
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return info.Value.Statename, &TimeoutError{Err: ctx.Err()}
+			}
+			return info.Value.Statename, ctx.Err()
+		case <-time.After(pollInterval):
 		}
 	}
-
-	if resp.StatusCode/100 != 2 {
-		fmt.Println("Bad Response:", resp.Status)
-		resp.Body.Close()
-		return nil, fmt.Errorf("Response code is NOT 2xx")
-	}
-	return resp, nil
 }
 
-func (r *XmlRPCClient) GetVersion() (reply VersionReply, err error) {
-	ins := struct{}{}
-	resp, err := r.post("supervisor.getVersion", &ins)
+// RestartResult is the result of restarting a member of a group, Err is set
+// if the member is not RUNNING after the restart
+type RestartResult struct {
+	Name      string
+	Statename string
+	Err       error
+}
 
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
+type RestartProcessGroupReply struct {
+	Value []RestartResult
+}
 
-	err = xml.DecodeClientResponse(resp.Body, &reply)
+// RestartProcessGroup restarts all the processes in the group by
+// supervisor.restartProcessGroup, which restarts them one by one if the
+// group is configured with "serialrestart". If supervisord doesn't support
+// the method, the processes are stopped, waited until all of them are
+// stopped and then started, waiting until each one leaves the STARTING and
+// BACKOFF states. Each member is waited at most timeout in each phase, a
+// timeout <= 0 means no limit. The result of each member is returned in
+// reply, an error is returned only if the group can't be restarted, for
+// example an ErrBadName fault if no such group
+func (r *XmlRPCClient) RestartProcessGroup(name string, timeout time.Duration) (reply RestartProcessGroupReply, err error) {
+	return r.RestartProcessGroupContext(context.Background(), name, timeout)
+}
 
+func (r *XmlRPCClient) RestartProcessGroupContext(ctx context.Context, name string, timeout time.Duration) (reply RestartProcessGroupReply, err error) {
+	ins := struct {
+		Name string
+		Wait bool
+	}{name, true}
+	var restarted AllProcessInfoReply
+	err = r.CallContext(ctx, "supervisor.restartProcessGroup", &ins, &restarted)
+	if IsFault(err, faults.UNKNOWN_METHOD) {
+		return r.restartProcessGroupByStopStart(ctx, name, timeout)
+	}
+	for _, info := range restarted.Value {
+		result := RestartResult{Name: info.Name, Statename: info.Statename}
+		if info.Statename != "RUNNING" {
+			result.Err = fmt.Errorf("process %s is %s after restart", info.Name, info.Statename)
+		}
+		reply.Value = append(reply.Value, result)
+	}
 	return
 }
 
-func (r *XmlRPCClient) GetAllProcessInfo() (reply AllProcessInfoReply, err error) {
-	ins := struct{}{}
-	resp, err := r.post("supervisor.getAllProcessInfo", &ins)
+func (r *XmlRPCClient) restartProcessGroupByStopStart(ctx context.Context, name string, timeout time.Duration) (reply RestartProcessGroupReply, err error) {
+	stopped, err := r.StopProcessGroupContext(ctx, name)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-
-	err = xml.DecodeClientResponse(resp.Body, &reply)
-
+	failed := make(map[string]error)
+	for _, info := range stopped.Value {
+		if e := r.waitProcessStopped(ctx, info.Name, timeout); e != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return
+			}
+			failed[info.Name] = e
+		}
+	}
+	started, err := r.StartProcessGroupContext(ctx, name)
+	if err != nil {
+		return
+	}
+	for _, info := range started.Value {
+		result := RestartResult{Name: info.Name, Err: failed[info.Name]}
+		if result.Err == nil {
+			result.Statename, result.Err = r.waitProcessState(ctx, info.Name, timeout, "start", "RUNNING", "STOPPED", "EXITED", "FATAL")
+			if result.Err == nil && result.Statename != "RUNNING" {
+				result.Err = fmt.Errorf("process %s is %s after restart", info.Name, result.Statename)
+			}
+		} else {
+			result.Statename = info.Statename
+		}
+		reply.Value = append(reply.Value, result)
+	}
 	return
 }
 
-func (r *XmlRPCClient) ChangeProcessState(change string, processName string) (reply StartStopReply, err error) {
+// ChangeAllProcessState starts or stops all the processes. The result of
+// each process is decoded separately, a process is reported in the Faults of
+// reply if its result is a fault struct or has a status other than SUCCESS.
+//
+// If the call fails on the transport, for example the connection is broken
+// while waiting, some processes may have been changed. The error is returned
+// with the reply got by querying the states again: the processes in the
+// target state are in the Value and the others are in the Pending
+func (r *XmlRPCClient) ChangeAllProcessState(change string) (reply ChangeAllProcessStateReply, err error) {
+	return r.ChangeAllProcessStateContext(context.Background(), change)
+}
+
+func (r *XmlRPCClient) ChangeAllProcessStateContext(ctx context.Context, change string) (reply ChangeAllProcessStateReply, err error) {
 	if !(change == "start" || change == "stop") {
 		err = fmt.Errorf("Incorrect required state")
 		return
 	}
+	reply, err = r.changeAllProcessState(ctx, change)
+	var fault *XmlRPCFault
+	if err == nil || errors.As(err, &fault) {
+		return
+	}
+	if all, e := r.GetAllProcessInfoContext(ctx); e == nil {
+		reply = ChangeAllProcessStateReply{}
+		for _, info := range all.Value {
+			if inTargetState(change, info.Statename) {
+				reply.Value = append(reply.Value, info)
+			} else {
+				reply.Pending = append(reply.Pending, info)
+			}
+		}
+	}
+	return
+}
 
-	ins := struct{ Value string }{processName}
-	resp, err := r.post(fmt.Sprintf("supervisor.%sProcess", change), &ins)
-
+func (r *XmlRPCClient) changeAllProcessState(ctx context.Context, change string) (reply ChangeAllProcessStateReply, err error) {
+	ins := struct{ Wait bool }{true}
+	resp, err := r.post(ctx, fmt.Sprintf("supervisor.%sAllProcesses", change), &ins)
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	err = xml.DecodeClientResponse(resp.Body, &reply)
-
+	values, err := decodeResponseValues(resp.Body)
+	if err != nil {
+		return
+	}
+	if len(values) != 1 {
+		err = fmt.Errorf("invalid %sAllProcesses response", change)
+		return
+	}
+	elems, ok := values[0].([]interface{})
+	if !ok {
+		err = fmt.Errorf("invalid %sAllProcesses response", change)
+		return
+	}
+	for _, elem := range elems {
+		m, ok := elem.(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("invalid process result %v", elem)
+			return
+		}
+		name, _ := m["name"].(string)
+		if fault, ok := toFault(m); ok {
+			reply.Faults = append(reply.Faults, ProcessFault{Name: name, FaultCode: fault.Code, FaultString: fault.Message})
+		} else if status, ok := m["status"].(int); ok && status != faults.SUCCESS {
+			description, _ := m["description"].(string)
+			reply.Faults = append(reply.Faults, ProcessFault{Name: name, FaultCode: status, FaultString: description})
+		} else {
+			var info types.ProcessInfo
+			decodeStruct(m, &info)
+			reply.Value = append(reply.Value, info)
+		}
+	}
 	return
 }
 
-func (r *XmlRPCClient) ChangeAllProcessState(change string) (reply AllProcessInfoReply, err error) {
+// ResumeAllProcessState starts or stops only the processes not in the target
+// state yet, so it is safe to retry after ChangeAllProcessState fails. The
+// states are queried first, the processes already in the target state are
+// reported in the Value without being changed and the others are changed one
+// by one. If it fails on the transport again, the processes not changed yet
+// are reported in the Pending with the error
+func (r *XmlRPCClient) ResumeAllProcessState(change string) (reply ChangeAllProcessStateReply, err error) {
+	return r.ResumeAllProcessStateContext(context.Background(), change)
+}
+
+func (r *XmlRPCClient) ResumeAllProcessStateContext(ctx context.Context, change string) (reply ChangeAllProcessStateReply, err error) {
 	if !(change == "start" || change == "stop") {
 		err = fmt.Errorf("Incorrect required state")
 		return
 	}
-	ins := struct{ Wait bool }{true}
-	resp, err := r.post(fmt.Sprintf("supervisor.%sAllProcesses", change), &ins)
+	all, err := r.GetAllProcessInfoContext(ctx)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
-	err = xml.DecodeClientResponse(resp.Body, &reply)
+	for i, info := range all.Value {
+		if inTargetState(change, info.Statename) {
+			reply.Value = append(reply.Value, info)
+			continue
+		}
+		name := fmt.Sprintf("%s:%s", info.Group, info.Name)
+		_, err = r.changeProcessState(ctx, change, name, true)
+		var fault *XmlRPCFault
+		if errors.As(err, &fault) && !isAlreadyChanged(change, fault) {
+			reply.Faults = append(reply.Faults, ProcessFault{Name: info.Name, FaultCode: fault.Code, FaultString: fault.Message})
+			err = nil
+			continue
+		}
+		var infoReply ProcessInfoReply
+		if err == nil || fault != nil {
+			infoReply, err = r.GetProcessInfoContext(ctx, name)
+		}
+		if err != nil {
+			reply.Pending = append(reply.Pending, all.Value[i:]...)
+			return
+		}
+		reply.Value = append(reply.Value, infoReply.Value)
+	}
 	return
 }
 
-func (r *XmlRPCClient) Shutdown() (reply ShutdownReply, err error) {
-	ins := struct{}{}
-	resp, err := r.post("supervisor.shutdown", &ins)
+// check if the process is in the target state of starting or stopping
+func inTargetState(change string, statename string) bool {
+	if change == "start" {
+		return statename == "RUNNING"
+	}
+	return statename == "STOPPED" || statename == "EXITED" || statename == "FATAL"
+}
 
-	if err != nil {
-		return
+// check if the fault is returned because the process is already started or
+// stopped by the previous call
+func isAlreadyChanged(change string, fault *XmlRPCFault) bool {
+	if change == "start" {
+		return fault.Code == faults.ALREADY_STARTED
 	}
-	defer resp.Body.Close()
+	return fault.Code == faults.NOT_RUNNING
+}
+
+// StartProcessGroup starts all the processes in the group and returns their
+// information, a process failed to start is reported by its state. An
+// ErrBadName fault is returned if there is no such group.
+func (r *XmlRPCClient) StartProcessGroup(name string) (reply AllProcessInfoReply, err error) {
+	return r.StartProcessGroupContext(context.Background(), name)
+}
+
+func (r *XmlRPCClient) StartProcessGroupContext(ctx context.Context, name string) (reply AllProcessInfoReply, err error) {
+	return r.changeProcessGroupState(ctx, "start", name)
+}
+
+// StopProcessGroup stops all the processes in the group and returns their
+// information. An ErrBadName fault is returned if there is no such group.
+func (r *XmlRPCClient) StopProcessGroup(name string) (reply AllProcessInfoReply, err error) {
+	return r.StopProcessGroupContext(context.Background(), name)
+}
 
-	err = xml.DecodeClientResponse(resp.Body, &reply)
+func (r *XmlRPCClient) StopProcessGroupContext(ctx context.Context, name string) (reply AllProcessInfoReply, err error) {
+	return r.changeProcessGroupState(ctx, "stop", name)
+}
+
+func (r *XmlRPCClient) changeProcessGroupState(ctx context.Context, change string, name string) (reply AllProcessInfoReply, err error) {
+	ins := struct {
+		Name string
+		Wait bool
+	}{name, true}
+	err = r.CallContext(ctx, fmt.Sprintf("supervisor.%sProcessGroup", change), &ins, &reply)
+	return
+}
 
+func (r *XmlRPCClient) Shutdown() (reply ShutdownReply, err error) {
+	return r.ShutdownContext(context.Background())
+}
+
+func (r *XmlRPCClient) ShutdownContext(ctx context.Context) (reply ShutdownReply, err error) {
+	err = r.CallContext(ctx, "supervisor.shutdown", nil, &reply)
 	return
 }
 
 func (r *XmlRPCClient) ReloadConfig() (reply types.ReloadConfigResult, err error) {
+	return r.ReloadConfigContext(context.Background())
+}
+
+func (r *XmlRPCClient) ReloadConfigContext(ctx context.Context) (reply types.ReloadConfigResult, err error) {
 	ins := struct{}{}
-	resp, err := r.post("supervisor.reloadConfig", &ins)
+	resp, err := r.post(ctx, "supervisor.reloadConfig", &ins)
 	if err != nil {
 		return
 	}
 
 	defer resp.Body.Close()
-	xmlProcMgr := NewXmlProcessorManager()
 	reply.AddedGroup = make([]string, 0)
 	reply.ChangedGroup = make([]string, 0)
 	reply.RemovedGroup = make([]string, 0)
-	i := -1
-	has_value := false
+	reply.AddedPrograms = make([]string, 0)
+	reply.ChangedPrograms = make([]string, 0)
+	reply.RemovedPrograms = make([]string, 0)
+	lists := []*[]string{&reply.AddedGroup, &reply.ChangedGroup, &reply.RemovedGroup,
+		&reply.AddedPrograms, &reply.ChangedPrograms, &reply.RemovedPrograms}
+	err = processReloadConfig(resp.Body, func(change ReloadConfigChange, name string) {
+		*lists[change] = append(*lists[change], name)
+	})
+	return
+}
 
-	xmlProcMgr.AddNonLeafProcessor("methodResponse/params/param/value/array/data", func() {
-		if has_value {
-			has_value = false
-		} else {
-			i++
+// ListMethods lists the methods supported by the server
+func (r *XmlRPCClient) ListMethods() ([]string, error) {
+	return r.ListMethodsContext(context.Background())
+}
+
+func (r *XmlRPCClient) ListMethodsContext(ctx context.Context) ([]string, error) {
+	reply := struct{ Value []string }{}
+	if err := r.CallContext(ctx, "system.listMethods", nil, &reply); err != nil {
+		return nil, err
+	}
+	if reply.Value == nil {
+		reply.Value = make([]string, 0)
+	}
+	return reply.Value, nil
+}
+
+// MethodHelp gets the documentation of the method
+func (r *XmlRPCClient) MethodHelp(method string) (string, error) {
+	return r.MethodHelpContext(context.Background(), method)
+}
+
+func (r *XmlRPCClient) MethodHelpContext(ctx context.Context, method string) (string, error) {
+	ins := struct{ Name string }{method}
+	reply := struct{ Value string }{}
+	err := r.CallContext(ctx, "system.methodHelp", &ins, &reply)
+	return reply.Value, err
+}
+
+// Multicall sends all the calls in one system.multicall request, the results
+// are in the same order as the calls.
+//
+// The result value is decoded to go value: int, bool, float64, string,
+// time.Time, []byte, []interface{} or map[string]interface{}
+func (r *XmlRPCClient) Multicall(calls []MethodCall) ([]MulticallResult, error) {
+	return r.MulticallContext(context.Background(), calls)
+}
+
+func (r *XmlRPCClient) MulticallContext(ctx context.Context, calls []MethodCall) ([]MulticallResult, error) {
+	for i := range calls {
+		if calls[i].Params == nil {
+			calls[i].Params = make([]interface{}, 0)
 		}
-	})
+	}
+	ins := struct{ Calls []MethodCall }{calls}
+	resp, err := r.post(ctx, "system.multicall", &ins)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	xmlProcMgr.AddLeafProcessor("methodResponse/params/param/value/array/data/value", func(value string) {
-		has_value = true
-		i++
-		switch i {
-		case 0:
-			reply.AddedGroup = append(reply.AddedGroup, value)
-		case 1:
-			reply.ChangedGroup = append(reply.ChangedGroup, value)
-		case 2:
-			reply.RemovedGroup = append(reply.RemovedGroup, value)
+	values, err := decodeResponseValues(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("invalid multicall response")
+	}
+	elems, ok := values[0].([]interface{})
+	if !ok || len(elems) != len(calls) {
+		return nil, fmt.Errorf("invalid multicall response")
+	}
+	result := make([]MulticallResult, 0)
+	for _, elem := range elems {
+		// a succeeded call is an array with one element and a failed
+		// call is a fault struct
+		if fault, ok := toFault(elem); ok {
+			result = append(result, MulticallResult{Fault: fault})
+		} else if arr, ok := elem.([]interface{}); ok && len(arr) == 1 {
+			result = append(result, MulticallResult{Value: arr[0]})
+		} else {
+			return nil, fmt.Errorf("invalid multicall result %v", elem)
 		}
-	})
+	}
+	return result, nil
+}
+
+// AddProcessGroup creates the processes of a group in the configuration and
+// starts the autostart ones, it is used with ReloadConfig: call
+// AddProcessGroup for each added group after calling RemoveProcessGroup for
+// each removed group. The processes already created are kept, a BAD_NAME
+// fault is returned if the group is not in the configuration
+func (r *XmlRPCClient) AddProcessGroup(name string) (reply StartStopReply, err error) {
+	return r.AddProcessGroupContext(context.Background(), name)
+}
+
+func (r *XmlRPCClient) AddProcessGroupContext(ctx context.Context, name string) (reply StartStopReply, err error) {
+	ins := struct{ Name string }{name}
+	err = r.CallContext(ctx, "supervisor.addProcessGroup", &ins, &reply)
+	return
+}
+
+// AddProgram adds a new program to supervisord at runtime without editing
+// its configuration file, the program is saved in the "programs_dir" of
+// supervisord so it is loaded again after supervisord is restarted. An
+// ALREADY_ADDED fault is returned if the program exists
+func (r *XmlRPCClient) AddProgram(config types.ProgramConfig) (reply StartStopReply, err error) {
+	return r.AddProgramContext(context.Background(), config)
+}
+
+func (r *XmlRPCClient) AddProgramContext(ctx context.Context, config types.ProgramConfig) (reply StartStopReply, err error) {
+	ins := struct{ Config types.ProgramConfig }{config}
+	err = r.CallContext(ctx, "supervisor.addProgram", &ins, &reply)
+	return
+}
 
-	xmlProcMgr.ProcessXml(resp.Body)
+// RemoveProcessGroup removes the processes of a group, they can be created
+// again by AddProcessGroup.
+//
+// The processes in the group must be stopped at first, otherwise a
+// STILL_RUNNING fault is returned. A BAD_NAME fault is returned if no
+// process is in the group, e.g. the group is already removed by
+// ReloadConfig
+func (r *XmlRPCClient) RemoveProcessGroup(name string) (reply StartStopReply, err error) {
+	return r.RemoveProcessGroupContext(context.Background(), name)
+}
+
+func (r *XmlRPCClient) RemoveProcessGroupContext(ctx context.Context, name string) (reply StartStopReply, err error) {
+	ins := struct{ Name string }{name}
+	err = r.CallContext(ctx, "supervisor.removeProcessGroup", &ins, &reply)
 	return
 }
 
 func (r *XmlRPCClient) SignalProcess(signal string, name string) (reply types.BooleanReply, err error) {
+	return r.SignalProcessContext(context.Background(), signal, name)
+}
+
+func (r *XmlRPCClient) SignalProcessContext(ctx context.Context, signal string, name string) (reply types.BooleanReply, err error) {
 	ins := types.ProcessSignal{Name: name, Signal: signal}
-	resp, err := r.post("supervisor.signalProcess", &ins)
+	err = r.CallContext(ctx, "supervisor.signalProcess", &ins, &reply)
+	return
+}
+
+// SignalGroupReply is the result of sending a signal to each process of a
+// group, in the order of GetGroupProcessInfo
+type SignalGroupReply struct {
+	Value []bool
+}
+
+// SignalProcessGroup sends the signal to all the processes in the group, the
+// processes are still managed by supervisord
+func (r *XmlRPCClient) SignalProcessGroup(group string, signal string) (reply SignalGroupReply, err error) {
+	return r.SignalProcessGroupContext(context.Background(), group, signal)
+}
+
+func (r *XmlRPCClient) SignalProcessGroupContext(ctx context.Context, group string, signal string) (reply SignalGroupReply, err error) {
+	ins := types.ProcessSignal{Name: group, Signal: signal}
+	err = r.CallContext(ctx, "supervisor.signalProcessGroup", &ins, &reply)
+	return
+}
+
+func (r *XmlRPCClient) SignalAll(signal string) (reply AllProcessInfoReply, err error) {
+	return r.SignalAllContext(context.Background(), signal)
+}
+
+func (r *XmlRPCClient) SignalAllContext(ctx context.Context, signal string) (reply AllProcessInfoReply, err error) {
+	ins := struct{ Signal string }{signal}
+	err = r.CallContext(ctx, "supervisor.signalAllProcesses", &ins, &reply)
+	return
+}
+
+func (r *XmlRPCClient) TailProcessStdoutLog(name string, offset int64, length int) (reply TailLogReply, err error) {
+	return r.TailProcessStdoutLogContext(context.Background(), name, offset, length)
+}
+
+func (r *XmlRPCClient) TailProcessStdoutLogContext(ctx context.Context, name string, offset int64, length int) (reply TailLogReply, err error) {
+	return r.tailProcessLog(ctx, "supervisor.tailProcessStdoutLog", name, offset, length)
+}
+
+func (r *XmlRPCClient) TailProcessStderrLog(name string, offset int64, length int) (reply TailLogReply, err error) {
+	return r.TailProcessStderrLogContext(context.Background(), name, offset, length)
+}
+
+func (r *XmlRPCClient) TailProcessStderrLogContext(ctx context.Context, name string, offset int64, length int) (reply TailLogReply, err error) {
+	return r.tailProcessLog(ctx, "supervisor.tailProcessStderrLog", name, offset, length)
+}
+
+// TailLinesReply is the last complete lines of the stdout log without the
+// newline, the Offset is the end of the last line in the log so the log
+// written after it can be read by TailProcessStdoutLog from the Offset
+type TailLinesReply struct {
+	Lines  []string
+	Offset int64
+}
+
+// the bytes of the first read by TailLines, it is doubled in each read
+var tailLinesChunkSize = 4096
+
+// the offset beyond the end of any log, tailProcessStdoutLog returns the size
+// of the log as the offset for it without reading anything
+const tailLogEndOffset = math.MaxInt64
+
+// TailLines gets the last n complete lines of the stdout log of the process,
+// the log is read backward from the end by TailProcessStdoutLog until n
+// lines are got or the beginning of the log is reached. The line being
+// written without the newline is not returned. No line is read if n is 0
+// and the Offset is the end of the log, an error is returned if n < 0
+func (r *XmlRPCClient) TailLines(name string, n int) (reply TailLinesReply, err error) {
+	return r.TailLinesContext(context.Background(), name, n)
+}
+
+func (r *XmlRPCClient) TailLinesContext(ctx context.Context, name string, n int) (reply TailLinesReply, err error) {
+	reply.Lines = make([]string, 0)
+	if n < 0 {
+		err = fmt.Errorf("invalid number of lines %d, it must not be negative", n)
+		return
+	}
+	// get the size of the log
+	tail, err := r.TailProcessStdoutLogContext(ctx, name, tailLogEndOffset, 0)
 	if err != nil {
 		return
 	}
-	defer resp.Body.Close()
+	if n == 0 {
+		reply.Offset = tail.Offset
+		return
+	}
+	start := tail.Offset
+	data := ""
+	// the first line is not complete if the read doesn't start from 0, so
+	// one more newline is required
+	for chunkSize := int64(tailLinesChunkSize); start > 0 && strings.Count(data, "\n") <= n; chunkSize *= 2 {
+		offset := start - chunkSize
+		if offset < 0 {
+			offset = 0
+		}
+		tail, err = r.TailProcessStdoutLogContext(ctx, name, offset, int(start-offset))
+		if err != nil {
+			return
+		}
+		data = tail.LogData + data
+		start = offset
+	}
 
-	err = xml.DecodeClientResponse(resp.Body, &reply)
+	end := strings.LastIndexByte(data, '\n') + 1
+	reply.Offset = start + int64(end)
+	lines := strings.Split(data[:end], "\n")
+	// the last one is the empty string after the last newline
+	lines = lines[:len(lines)-1]
+	if start > 0 && len(lines) > 0 {
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	reply.Lines = append(reply.Lines, lines...)
 	return
 }
 
-func (r *XmlRPCClient) SignalAll(signal string) (reply AllProcessInfoReply, err error) {
-	ins := struct{ Signal string }{signal}
-	resp, err := r.post("supervisor.signalProcess", &ins)
+// ReadStdoutRange reads length bytes from offset of the stdout log of the
+// process across its rotated backups, the gzipped backups are decompressed
+// by supervisord. The offset 0 is the beginning of the oldest backup and a
+// length 0 reads to the end of the current log
+func (r *XmlRPCClient) ReadStdoutRange(name string, offset int64, length int) (reply ReadLogReply, err error) {
+	return r.ReadStdoutRangeContext(context.Background(), name, offset, length)
+}
+
+func (r *XmlRPCClient) ReadStdoutRangeContext(ctx context.Context, name string, offset int64, length int) (reply ReadLogReply, err error) {
+	return r.readLogRange(ctx, "supervisor.readProcessStdoutLogRange", name, offset, length)
+}
+
+// ReadStderrRange reads the stderr log of the process like ReadStdoutRange
+func (r *XmlRPCClient) ReadStderrRange(name string, offset int64, length int) (reply ReadLogReply, err error) {
+	return r.ReadStderrRangeContext(context.Background(), name, offset, length)
+}
+
+func (r *XmlRPCClient) ReadStderrRangeContext(ctx context.Context, name string, offset int64, length int) (reply ReadLogReply, err error) {
+	return r.readLogRange(ctx, "supervisor.readProcessStderrLogRange", name, offset, length)
+}
+
+func (r *XmlRPCClient) readLogRange(ctx context.Context, method string, name string, offset int64, length int) (reply ReadLogReply, err error) {
+	err = r.callXml(ctx, encodeCall(method, name, offset, length), &reply)
+	return
+}
+
+// ReadProcessStdoutLogBackup reads length bytes from offset of the stdout log
+// backup "<logfile>.<index>" of the process, the index is from 1 to the
+// stdout_logfile_backups. A length 0 reads to the end of the backup, a
+// NO_FILE fault is returned if the backup doesn't exist
+func (r *XmlRPCClient) ReadProcessStdoutLogBackup(name string, index int, offset, length int) (reply ReadLogReply, err error) {
+	return r.ReadProcessStdoutLogBackupContext(context.Background(), name, index, offset, length)
+}
+
+func (r *XmlRPCClient) ReadProcessStdoutLogBackupContext(ctx context.Context, name string, index int, offset, length int) (reply ReadLogReply, err error) {
+	return r.readLogBackup(ctx, "supervisor.readProcessStdoutLogBackup", name, index, offset, length)
+}
+
+// ReadProcessStderrLogBackup reads the stderr log backup of the process like
+// ReadProcessStdoutLogBackup
+func (r *XmlRPCClient) ReadProcessStderrLogBackup(name string, index int, offset, length int) (reply ReadLogReply, err error) {
+	return r.ReadProcessStderrLogBackupContext(context.Background(), name, index, offset, length)
+}
+
+func (r *XmlRPCClient) ReadProcessStderrLogBackupContext(ctx context.Context, name string, index int, offset, length int) (reply ReadLogReply, err error) {
+	return r.readLogBackup(ctx, "supervisor.readProcessStderrLogBackup", name, index, offset, length)
+}
+
+func (r *XmlRPCClient) readLogBackup(ctx context.Context, method string, name string, index int, offset, length int) (reply ReadLogReply, err error) {
+	ins := struct {
+		Name   string
+		Index  int
+		Offset int
+		Length int
+	}{name, index, offset, length}
+	err = r.CallContext(ctx, method, &ins, &reply)
+	return
+}
+
+// the tail result is an array of [bytes, offset, overflow]. The elements
+// have different types so each one is picked up by its xml type instead of
+// its position, this also accepts the result returned as three params.
+func (r *XmlRPCClient) tailProcessLog(ctx context.Context, method string, name string, offset int64, length int) (reply TailLogReply, err error) {
+	resp, err := r.postXml(ctx, encodeCall(method, name, offset, length))
 	if err != nil {
 		return
 	}
 	defer resp.Body.Close()
 
-	err = xml.DecodeClientResponse(resp.Body, &reply)
+	reply.Offset = offset
+	setLogData := func(value string) {
+		reply.LogData = value
+	}
+	setOffset := func(value string) {
+		if n, e := strconv.ParseInt(value, 10, 64); e == nil {
+			reply.Offset = n
+		}
+	}
+	setOverflow := func(value string) {
+		reply.Overflow = value == "1" || strings.ToLower(value) == "true"
+	}
 
+	xmlProcMgr := NewXmlProcessorManager()
+	for _, prefix := range []string{"methodResponse/params/param/value/array/data/value", "methodResponse/params/param/value"} {
+		xmlProcMgr.AddLeafProcessor(prefix+"/string", setLogData)
+		xmlProcMgr.AddLeafProcessor(prefix+"/int", setOffset)
+		xmlProcMgr.AddLeafProcessor(prefix+"/i4", setOffset)
+		xmlProcMgr.AddLeafProcessor(prefix+"/boolean", setOverflow)
+	}
+	err = processResponse(xmlProcMgr, resp.Body)
 	return
 }
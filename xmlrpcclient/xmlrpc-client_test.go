@@ -0,0 +1,1665 @@
+package xmlrpcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/csxuejin/supervisord/types"
+)
+
+// create a handler which saves the request body to reqBody and answers
+// every request with the response
+func testHandler(response string, reqBody *string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if reqBody != nil {
+			*reqBody = string(b)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(response))
+	})
+}
+
+func startTestServer(response string, reqBody *string) *httptest.Server {
+	return httptest.NewServer(testHandler(response, reqBody))
+}
+
+// start a http server listening on an unix socket in a temporary directory
+func startTestUnixServer(response string) (net.Listener, string, error) {
+	listener, sockFile, err := listenTestUnixSocket()
+	if err != nil {
+		return nil, "", err
+	}
+	go http.Serve(listener, testHandler(response, nil))
+	return listener, sockFile, nil
+}
+
+// listen on a socket file in a new temporary directory
+func listenTestUnixSocket() (net.Listener, string, error) {
+	dir, err := ioutil.TempDir("", "xmlrpcclient")
+	if err != nil {
+		return nil, "", err
+	}
+	sockFile := filepath.Join(dir, "supervisord.sock")
+	listener, err := net.Listen("unix", sockFile)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, "", err
+	}
+	return listener, sockFile, nil
+}
+
+// countListener counts the accepted connections
+type countListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+const badNameFault = `<?xml version="1.0"?>
+<methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>10</int></value></member>
+<member><name>faultString</name><value><string>BAD_NAME: test</string></value></member>
+</struct></value></fault></methodResponse>`
+
+func TestFaultResponse(t *testing.T) {
+	server := startTestServer(badNameFault, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	_, err := client.ChangeProcessState("start", "test")
+	fault, ok := err.(*XmlRPCFault)
+	if !ok || fault.Code != 10 || fault.Message != "BAD_NAME: test" {
+		t.Errorf("Fail to get the fault, err=%v", err)
+	}
+	if !IsFault(err, ErrBadName.Code) || !fault.Is(ErrBadName) || fault.Is(ErrAlreadyStarted) {
+		t.Error("Fail to compare the fault")
+	}
+}
+
+func TestFaultResponseOfReloadConfig(t *testing.T) {
+	server := startTestServer(badNameFault, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	_, err := client.ReloadConfig()
+	if !IsFault(err, ErrBadName.Code) {
+		t.Errorf("Fail to get the fault, err=%v", err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	array := func(values ...string) string {
+		result := "<param><value><array><data>"
+		for _, value := range values {
+			result += "<value><string>" + value + "</string></value>"
+		}
+		return result + "</data></array></value></param>"
+	}
+	server := startTestServer("<methodResponse><params>"+array()+array("g")+array()+
+		array()+array("a", "b")+array("c")+"</params></methodResponse>", nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.AddedGroup) != 0 || strings.Join(reply.ChangedGroup, ",") != "g" || len(reply.RemovedGroup) != 0 ||
+		len(reply.AddedPrograms) != 0 || strings.Join(reply.ChangedPrograms, ",") != "a,b" || strings.Join(reply.RemovedPrograms, ",") != "c" {
+		t.Errorf("Wrong reload result: %+v", reply)
+	}
+}
+
+func TestReloadConfigStream(t *testing.T) {
+	proceed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<methodResponse><params><param><value><array><data><value><string>g1</string></value></data></array></value></param>"))
+		w.(http.Flusher).Flush()
+		// the rest is sent after the first change is received
+		<-proceed
+		w.Write([]byte("<param><value><array><data></data></array></value></param><param><value><array><data></data></array></value></param>" +
+			"<param><value><array><data></data></array></value></param>" +
+			"<param><value><array><data><value><string>a</string></value><value><string>b</string></value></data></array></value></param>" +
+			"<param><value><array><data><value><string>c</string></value></data></array></value></param></params></methodResponse>"))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client := NewXmlRPCClient(server.URL)
+	ch, err := client.ReloadConfigStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := <-ch
+	close(proceed)
+	if first.Change != ADDED_GROUP || first.Name != "g1" || first.Err != nil {
+		t.Errorf("Wrong first change %+v", first)
+	}
+	changes := make([]string, 0)
+	for event := range ch {
+		if event.Err != nil {
+			t.Fatal(event.Err)
+		}
+		changes = append(changes, fmt.Sprintf("%v %s", event.Change, event.Name))
+	}
+	expected := []string{"changed program a", "changed program b", "removed program c"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Wrong changes %v", changes)
+	}
+}
+
+func TestFaultOfReloadConfigStream(t *testing.T) {
+	server := startTestServer(badNameFault, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	ch, err := client.ReloadConfigStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, ok := <-ch
+	if !ok || !IsFault(event.Err, ErrBadName.Code) {
+		t.Errorf("The fault should be sent in the last event, event=%+v", event)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("The channel should be closed after the fault")
+	}
+}
+
+func TestSignalAllMethodName(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data></data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.SignalAll("HUP")
+	if !strings.Contains(reqBody, "<methodName>supervisor.signalAllProcesses</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+	if !strings.Contains(reqBody, "<string>HUP</string>") {
+		t.Errorf("The signal is not sent: %s", reqBody)
+	}
+}
+
+func TestSignalProcessGroup(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><boolean>1</boolean></value><value><boolean>0</boolean></value>
+</data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.SignalProcessGroup("web", "USR1")
+	if err != nil || len(reply.Value) != 2 || !reply.Value[0] || reply.Value[1] {
+		t.Errorf("Wrong results of signalling the group, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.signalProcessGroup</methodName>") ||
+		!strings.Contains(reqBody, "<string>web</string>") || !strings.Contains(reqBody, "<string>USR1</string>") {
+		t.Errorf("Wrong request: %s", reqBody)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	listener, sockFile, err := startTestUnixServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	defer listener.Close()
+
+	client := NewXmlRPCClient("unix://" + sockFile)
+	for i := 0; i < 2; i++ {
+		reply, err := client.GetVersion()
+		if err != nil || reply.Value != "3.0" {
+			t.Errorf("Fail to get version through unix socket, err=%v", err)
+		}
+	}
+}
+
+func TestUnixSocketPath(t *testing.T) {
+	tests := []struct {
+		serverurl string
+		path      string
+	}{
+		{"unix:///var/run/supervisor.sock", "/var/run/supervisor.sock"},
+		// net/url parses "relative.sock" as the host
+		{"unix://relative.sock", "relative.sock"},
+		{"unix://run/supervisor.sock", "run/supervisor.sock"},
+		{"unix:relative.sock", "relative.sock"},
+		{"UNIX:///tmp/supervisor.sock", "/tmp/supervisor.sock"},
+		{"unix:///tmp/my%20supervisor.sock", "/tmp/my supervisor.sock"},
+		{"unix://@supervisord", "@supervisord"},
+		{"unix:@supervisord", "@supervisord"},
+	}
+	for _, test := range tests {
+		if path, err := unixSocketPath(test.serverurl); err != nil || path != test.path {
+			t.Errorf("Wrong socket file of %s: %s, err=%v", test.serverurl, path, err)
+		}
+	}
+	for _, serverurl := range []string{"unix://", "unix:", "unix://@", "http://localhost:9001"} {
+		if _, err := unixSocketPath(serverurl); err == nil {
+			t.Errorf("No error for the server url %s", serverurl)
+		}
+	}
+	if err := NewXmlRPCClient("unix://").Validate(); err == nil || !strings.Contains(err.Error(), "no socket file") {
+		t.Errorf("The empty socket file is not detected, err=%v", err)
+	}
+}
+
+func TestRelativeUnixSocket(t *testing.T) {
+	listener, sockFile, err := startTestUnixServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	defer listener.Close()
+
+	wd, _ := os.Getwd()
+	relFile, err := filepath.Rel(wd, sockFile)
+	if err != nil {
+		t.Skip("no relative path to the socket file")
+	}
+	client := NewXmlRPCClient("unix://" + relFile)
+	if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+		t.Errorf("Fail to get version through relative unix socket %s, err=%v", relFile, err)
+	}
+}
+
+func TestAbstractUnixSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the abstract unix socket is only supported on Linux")
+	}
+	name := fmt.Sprintf("@xmlrpcclient-test-%d", os.Getpid())
+	listener, err := net.Listen("unix", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go http.Serve(listener, testHandler(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`, nil))
+
+	client := NewXmlRPCClient("unix://" + name)
+	if err := client.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+		t.Errorf("Fail to get version through abstract unix socket %s, err=%v", name, err)
+	}
+	// no socket file is created for the abstract socket
+	if _, err := os.Stat(name); err == nil {
+		t.Errorf("The socket file %s should not be created", name)
+	}
+}
+
+func TestCancelByContext(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := NewXmlRPCClient(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetAllProcessInfoContext(ctx)
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Error("The request is not canceled by the context")
+	}
+}
+
+func TestPerCallTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte(versionResponse))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.SetTimeout(100 * time.Millisecond)
+	if _, err := client.GetVersion(); err == nil {
+		t.Errorf("The client timeout is not applied")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if reply, err := client.GetVersionContext(ctx); err != nil || reply.Value != "3.0" {
+		t.Errorf("The deadline of context doesn't override the client timeout, err=%v", err)
+	}
+}
+
+func TestGetProcessInfo(t *testing.T) {
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>name</name><value><string>test</string></value></member>
+<member><name>group</name><value><string>test</string></value></member>
+<member><name>state</name><value><int>20</int></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+<member><name>pid</name><value><int>1234</int></value></member>
+</struct></value></param></params></methodResponse>`, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetProcessInfo("test")
+	if err != nil || reply.Value.Name != "test" || reply.Value.Statename != "RUNNING" || reply.Value.Pid != 1234 {
+		t.Errorf("Fail to get process info, err=%v", err)
+	}
+}
+
+func TestGetProcessStats(t *testing.T) {
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>name</name><value><string>test</string></value></member>
+<member><name>pid</name><value><int>1234</int></value></member>
+<member><name>cpu_percent</name><value><double>12.5</double></value></member>
+<member><name>rss</name><value><int>4096</int></value></member>
+</struct></value></param></params></methodResponse>`, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetProcessStats("test")
+	if err != nil || reply.Value.Name != "test" || reply.Value.Pid != 1234 || reply.Value.Cpu_percent != 12.5 || reply.Value.Rss != 4096 {
+		t.Errorf("Fail to get process stats, reply=%v, err=%v", reply, err)
+	}
+}
+
+func TestGetDaemonInfo(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>pid</name><value><int>1234</int></value></member>
+<member><name>start</name><value><int>1600000000</int></value></member>
+<member><name>now</name><value><int>1600000060</int></value></member>
+<member><name>uptime</name><value><int>60</int></value></member>
+<member><name>configfile</name><value><string>/etc/supervisord.conf</string></value></member>
+</struct></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetDaemonInfo()
+	if err != nil || reply.Value.Pid != 1234 || reply.Value.Start != 1600000000 || reply.Value.Uptime != 60 || reply.Value.Configfile != "/etc/supervisord.conf" {
+		t.Errorf("Fail to get daemon info, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.getDaemonInfo</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+}
+
+func TestGetProcessLogInfo(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>name</name><value><string>test</string></value></member>
+<member><name>stdout_logfile</name><value><string>/var/log/test.log</string></value></member>
+<member><name>stdout_logfile_backups</name><value><int>5</int></value></member>
+<member><name>stdout_events_enabled</name><value><boolean>1</boolean></value></member>
+<member><name>redirect_stderr</name><value><boolean>1</boolean></value></member>
+</struct></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetProcessLogInfo("test")
+	info := reply.Value
+	if err != nil || info.Name != "test" || info.Stdout_logfile != "/var/log/test.log" || info.Stdout_logfile_backups != 5 || !info.Stdout_events_enabled || !info.Redirect_stderr {
+		t.Errorf("Fail to get process log info, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.getProcessLogInfo</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+}
+
+func TestGetEffectiveConfig(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>name</name><value><string>test</string></value></member>
+<member><name>argv</name><value><array><data><value><string>/bin/sleep</string></value><value><string>10</string></value></data></array></value></member>
+<member><name>directory</name><value><string>/tmp</string></value></member>
+<member><name>environment</name><value><array><data><value><string>A=1</string></value></data></array></value></member>
+<member><name>uid</name><value><int>1000</int></value></member>
+</struct></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetEffectiveConfig("test")
+	config := reply.Value
+	if err != nil || config.Name != "test" || len(config.Argv) != 2 || config.Argv[1] != "10" || config.Directory != "/tmp" || len(config.Environment) != 1 || config.Uid != 1000 {
+		t.Errorf("Fail to get effective config, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.getEffectiveConfig</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+}
+
+func TestRestartProcessTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "supervisor.getProcessInfo") {
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+</struct></value></param></params></methodResponse>`))
+		} else {
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	_, err := client.RestartProcess("test", 100*time.Millisecond)
+	var timeoutErr *TimeoutError
+	if !errors.As(err, &timeoutErr) || !strings.Contains(err.Error(), "RUNNING") {
+		t.Errorf("Fail to get the timeout error, err=%v", err)
+	}
+}
+
+func TestTimeoutError(t *testing.T) {
+	stopResponse := `<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`
+	handlers := map[string]http.Handler{
+		//the response is not sent until the stop is finished
+		"delayed response": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(500 * time.Millisecond)
+			w.Write([]byte(stopResponse))
+		}),
+		//the headers are sent but the body is not finished
+		"delayed body": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(stopResponse[0:30]))
+			w.(http.Flusher).Flush()
+			time.Sleep(500 * time.Millisecond)
+			w.Write([]byte(stopResponse[30:]))
+		}),
+	}
+	for name, handler := range handlers {
+		server := httptest.NewServer(handler)
+		listener, sockFile, err := listenTestUnixSocket()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go http.Serve(listener, handler)
+
+		for _, serverurl := range []string{server.URL, "unix://" + sockFile} {
+			client := NewXmlRPCClient(serverurl)
+			client.SetTimeout(100 * time.Millisecond)
+			_, err := client.ChangeProcessStateWait("stop", "test", true)
+			var timeoutErr *TimeoutError
+			if !errors.As(err, &timeoutErr) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("The %s of %s is not a timeout error, err=%v", name, serverurl, err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			_, err = NewXmlRPCClient(serverurl).ChangeProcessStateWaitContext(ctx, "stop", "test", true)
+			cancel()
+			if !errors.As(err, &timeoutErr) {
+				t.Errorf("The %s of %s is not a timeout error by the deadline of context, err=%v", name, serverurl, err)
+			}
+		}
+		server.Close()
+		listener.Close()
+		os.RemoveAll(filepath.Dir(sockFile))
+	}
+
+	//the other errors are not the timeout
+	_, err := NewXmlRPCClient("unix:///nonexistent/supervisord.sock").ChangeProcessStateWait("stop", "test", true)
+	var timeoutErr *TimeoutError
+	if err == nil || errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("The connection error should not be a timeout error, err=%v", err)
+	}
+}
+
+func TestGetAllProcessInfo(t *testing.T) {
+	// the values of all types and the spaces between the elements
+	server := startTestServer(`<?xml version="1.0"?>
+<methodResponse>
+  <params>
+    <param>
+      <value>
+        <array>
+          <data>
+            <value>
+              <struct>
+                <member>
+                  <name>name</name>
+                  <value><string>web</string></value>
+                </member>
+                <member><name>group</name><value>web group</value></member>
+                <member><name>pid</name><value><i4> 1234 </i4></value></member>
+                <member><name>backoff</name><value><double>1.5</double></value></member>
+                <member><name>spawnerr</name><value><string></string></value></member>
+                <member><name>unknown</name><value><array><data><value><int>1</int></value></data></array></value></member>
+                <member><name>state</name><value><int>20</int></value></member>
+              </struct>
+            </value>
+            <value><struct><member><name>name</name><value><string>worker</string></value></member></struct></value>
+          </data>
+        </array>
+      </value>
+    </param>
+  </params>
+</methodResponse>`, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetAllProcessInfo()
+	expected := []types.ProcessInfo{{Name: "web", Group: "web group", Pid: 1234, Backoff: 1.5, State: 20}, {Name: "worker"}}
+	if err != nil || !reflect.DeepEqual(reply.Value, expected) {
+		t.Errorf("Fail to decode all the process info, reply=%+v, err=%v", reply, err)
+	}
+}
+
+func TestGetAllProcessInfoInvalidResponse(t *testing.T) {
+	responses := map[string]string{
+		"truncated": `<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>web</string></value></member></struct></value>
+<value><struct><member><name>name</name>`,
+		"malformed": `<?xml version="1.0"?><methodResponse><params></param></methodResponse>`,
+		"html":      `<html><head><title>ok</title></head><body>It works!</body></html>`,
+		"empty":     ``,
+	}
+	for kind, response := range responses {
+		server := startTestServer(response, nil)
+		client := NewXmlRPCClient(server.URL)
+		if reply, err := client.GetAllProcessInfo(); err == nil {
+			t.Errorf("The %s response should fail, reply=%+v", kind, reply)
+		}
+		server.Close()
+	}
+
+	// no process is a valid response
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+</data></array></value></param></params></methodResponse>`, nil)
+	defer server.Close()
+	client := NewXmlRPCClient(server.URL)
+	if reply, err := client.GetAllProcessInfo(); err != nil || len(reply.Value) != 0 {
+		t.Errorf("Fail to decode no process, reply=%+v, err=%v", reply, err)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	response := `<?xml version="1.0"?><methodResponse><params><param><value><array><data>` +
+		strings.Repeat(`<value><struct><member><name>name</name><value><string>web</string></value></member></struct></value>`, 100) +
+		`</data></array></value></param></params></methodResponse>`
+	server := startTestServer(response, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.SetMaxResponseSize(int64(len(response)))
+	if reply, err := client.GetAllProcessInfo(); err != nil || len(reply.Value) != 100 {
+		t.Errorf("The response within the limit should be decoded, processes=%d, err=%v", len(reply.Value), err)
+	}
+	client.SetMaxResponseSize(int64(len(response) - 1))
+	if _, err := client.GetAllProcessInfo(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("The streaming decode should fail with ErrResponseTooLarge, err=%v", err)
+	}
+	if _, err := client.GetProcessInfo("web"); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("The decode should fail with ErrResponseTooLarge, err=%v", err)
+	}
+	if _, err := client.ReloadConfig(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("The xml processor should fail with ErrResponseTooLarge, err=%v", err)
+	}
+}
+
+func TestGetGroupProcessInfo(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>web_1</string></value></member>
+<member><name>group</name><value><string>web</string></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetGroupProcessInfo("web")
+	if err != nil || len(reply.Value) != 1 || reply.Value[0].Name != "web_1" || !strings.Contains(reqBody, "supervisor.getGroupProcessInfo") {
+		t.Errorf("Fail to get the processes in group, reply=%v, err=%v", reply, err)
+	}
+}
+
+func TestGetGroupProcessInfoByAllProcessInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		// an old supervisord without getGroupProcessInfo
+		if strings.Contains(string(b), "supervisor.getGroupProcessInfo") {
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>1</int></value></member>
+<member><name>faultString</name><value><string>UNKNOWN_METHOD</string></value></member>
+</struct></value></fault></methodResponse>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>web_1</string></value></member>
+<member><name>group</name><value><string>web</string></value></member></struct></value>
+<value><struct><member><name>name</name><value><string>worker</string></value></member>
+<member><name>group</name><value><string>worker</string></value></member></struct></value>
+<value><struct><member><name>name</name><value><string>web_2</string></value></member>
+<member><name>group</name><value><string>web</string></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetGroupProcessInfo("web")
+	if err != nil || len(reply.Value) != 2 || reply.Value[0].Name != "web_1" || reply.Value[1].Name != "web_2" {
+		t.Errorf("Fail to filter the processes in group, reply=%v, err=%v", reply, err)
+	}
+	if _, err := client.GetGroupProcessInfo("nonexistent"); !IsFault(err, ErrBadName.Code) {
+		t.Errorf("A BAD_NAME fault should be returned for the unknown group, err=%v", err)
+	}
+}
+
+func TestGetProcessStatesByAllProcessInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		// an old supervisord without getProcessStates
+		if strings.Contains(string(b), "supervisor.getProcessStates") {
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>1</int></value></member>
+<member><name>faultString</name><value><string>UNKNOWN_METHOD</string></value></member>
+</struct></value></fault></methodResponse>`))
+			return
+		}
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>web</string></value></member>
+<member><name>description</name><value><string>pid 1234, uptime 0:01:00</string></value></member>
+<member><name>state</name><value><int>20</int></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+<member><name>pid</name><value><int>1234</int></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetProcessStates()
+	expected := types.ProcessStateInfo{Name: "web", State: 20, Statename: "RUNNING", Pid: 1234}
+	if err != nil || len(reply.Value) != 1 || reply.Value[0] != expected {
+		t.Errorf("Fail to get the process states, reply=%v, err=%v", reply, err)
+	}
+}
+
+func TestRestartProcessGroup(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>good</string></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member></struct></value>
+<value><struct><member><name>name</name><value><string>bad</string></value></member>
+<member><name>statename</name><value><string>BACKOFF</string></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.RestartProcessGroup("pool", time.Second)
+	if err != nil || len(reply.Value) != 2 || !strings.Contains(reqBody, "supervisor.restartProcessGroup") {
+		t.Fatalf("Fail to restart the group, reply=%v, err=%v", reply, err)
+	}
+	if reply.Value[0].Err != nil || reply.Value[1].Err == nil || reply.Value[1].Statename != "BACKOFF" {
+		t.Errorf("Wrong restart results: %v", reply.Value)
+	}
+}
+
+func TestRestartProcessGroupByStopStart(t *testing.T) {
+	groupInfo := `<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>good</string></value></member></struct></value>
+<value><struct><member><name>name</name><value><string>bad</string></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`
+	var started int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body := string(b)
+		// an old supervisord without restartProcessGroup
+		if strings.Contains(body, "supervisor.restartProcessGroup") {
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>1</int></value></member>
+<member><name>faultString</name><value><string>UNKNOWN_METHOD</string></value></member>
+</struct></value></fault></methodResponse>`))
+			return
+		}
+		if strings.Contains(body, "supervisor.startProcessGroup") {
+			atomic.StoreInt32(&started, 1)
+		}
+		if !strings.Contains(body, "supervisor.getProcessInfo") {
+			w.Write([]byte(groupInfo))
+			return
+		}
+		// the member "bad" fails to start
+		state := "STOPPED"
+		if atomic.LoadInt32(&started) == 1 {
+			state = "RUNNING"
+			if strings.Contains(body, "<string>bad</string>") {
+				state = "FATAL"
+			}
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>statename</name><value><string>%s</string></value></member>
+</struct></value></param></params></methodResponse>`, state)
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.RestartProcessGroup("pool", time.Second)
+	if err != nil || len(reply.Value) != 2 {
+		t.Fatalf("Fail to restart the group, reply=%v, err=%v", reply, err)
+	}
+	if reply.Value[0].Name != "good" || reply.Value[0].Statename != "RUNNING" || reply.Value[0].Err != nil {
+		t.Errorf("The member should be restarted, result=%v", reply.Value[0])
+	}
+	if reply.Value[1].Name != "bad" || reply.Value[1].Statename != "FATAL" || reply.Value[1].Err == nil {
+		t.Errorf("The member should fail to restart, result=%v", reply.Value[1])
+	}
+}
+
+func TestChangeProcessStateWait(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	paramsPattern := regexp.MustCompile(`<param>\s*<value>\s*<(\w+)>([^<]*)</\w+>\s*</value>\s*</param>`)
+	for _, test := range []struct {
+		change string
+		wait   bool
+		method string
+		value  string
+	}{{"start", true, "supervisor.startProcess", "1"},
+		{"start", false, "supervisor.startProcess", "0"},
+		{"stop", true, "supervisor.stopProcess", "1"},
+		{"stop", false, "supervisor.stopProcess", "0"}} {
+		if reply, err := client.ChangeProcessStateWait(test.change, "group:test", test.wait); err != nil || !reply.Value {
+			t.Errorf("Fail to %s process, reply=%v, err=%v", test.change, reply, err)
+		}
+		params := paramsPattern.FindAllStringSubmatch(reqBody, -1)
+		if !strings.Contains(reqBody, "<methodName>"+test.method+"</methodName>") || len(params) != 2 ||
+			params[0][1] != "string" || params[0][2] != "group:test" || params[1][1] != "boolean" || params[1][2] != test.value {
+			t.Errorf("The name and wait=%v are not passed as two params: %s", test.wait, reqBody)
+		}
+	}
+}
+
+func TestStartProcessNoWait(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	if reply, err := client.StartProcessNoWait("test"); err != nil || !reply.Value {
+		t.Errorf("Fail to start process, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "supervisor.startProcess") || !strings.Contains(reqBody, "<boolean>0</boolean>") {
+		t.Errorf("The wait=false is not passed: %s", reqBody)
+	}
+	if _, err := client.ChangeProcessState("start", "test"); err != nil || !strings.Contains(reqBody, "<boolean>1</boolean>") {
+		t.Errorf("The wait=true is not passed: %s, err=%v", reqBody, err)
+	}
+}
+
+func TestStopProcessWithSignal(t *testing.T) {
+	reqBody := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "supervisor.getProcessInfo") {
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>statename</name><value><string>STOPPED</string></value></member>
+</struct></value></param></params></methodResponse>`))
+		} else {
+			reqBody = string(b)
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.StopProcessWithSignal("test", "QUIT", time.Second)
+	if err != nil || !reply.Value {
+		t.Errorf("Fail to stop process with signal, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "supervisor.stopProcessWithSignal") || !strings.Contains(reqBody, "QUIT") {
+		t.Errorf("Wrong request: %s", reqBody)
+	}
+}
+
+func TestReadStdoutRange(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>rotated log</string></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ReadStdoutRange("test", 1000, 100)
+	if err != nil || reply.Value != "rotated log" {
+		t.Errorf("Fail to read log range, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "supervisor.readProcessStdoutLogRange") || !strings.Contains(reqBody, "<string>test</string>") || !strings.Contains(reqBody, "<int>1000</int>") {
+		t.Errorf("Wrong request: %s", reqBody)
+	}
+
+	// the offset in the rotated history may exceed 32 bits
+	if _, err = client.ReadStderrRange("test", 5000000000, 100); err != nil {
+		t.Errorf("Fail to read log range, err=%v", err)
+	}
+	if !strings.Contains(reqBody, "supervisor.readProcessStderrLogRange") || !strings.Contains(reqBody, "<int>5000000000</int>") {
+		t.Errorf("Wrong request: %s", reqBody)
+	}
+}
+
+func TestReadProcessStdoutLogBackup(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>backup log</string></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ReadProcessStdoutLogBackup("test", 2, 100, 0)
+	if err != nil || reply.Value != "backup log" {
+		t.Errorf("Fail to read log backup, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "supervisor.readProcessStdoutLogBackup") || !strings.Contains(reqBody, "<int>2</int>") || !strings.Contains(reqBody, "<int>100</int>") {
+		t.Errorf("Wrong request: %s", reqBody)
+	}
+}
+
+// the xml-rpc response of an array of the processes with the states
+func processInfoArrayResponse(states map[string]string) string {
+	names := make([]string, 0)
+	for name := range states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	values := ""
+	for _, name := range names {
+		values += fmt.Sprintf(`<value><struct><member><name>name</name><value><string>%s</string></value></member>
+<member><name>group</name><value><string>%s</string></value></member>
+<member><name>statename</name><value><string>%s</string></value></member></struct></value>`, name, name, states[name])
+	}
+	return `<?xml version="1.0"?><methodResponse><params><param><value><array><data>` + values + `</data></array></value></param></params></methodResponse>`
+}
+
+func TestChangeAllProcessStateOnBrokenConnection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if strings.Contains(string(b), "supervisor.startAllProcesses") {
+			// the connection is broken while waiting for the processes
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(processInfoArrayResponse(map[string]string{"started": "RUNNING", "starting": "STARTING"})))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ChangeAllProcessState("start")
+	if err == nil {
+		t.Error("The transport error should be returned")
+	}
+	if len(reply.Value) != 1 || reply.Value[0].Name != "started" || len(reply.Pending) != 1 || reply.Pending[0].Name != "starting" {
+		t.Errorf("The results should be got from the states, reply=%+v", reply)
+	}
+}
+
+func TestResumeAllProcessState(t *testing.T) {
+	states := map[string]string{"running": "RUNNING", "stopped": "STOPPED", "started": "STOPPED", "bad": "FATAL"}
+	var lock sync.Mutex
+	calls := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		b, _ := ioutil.ReadAll(r.Body)
+		body := string(b)
+		name := ""
+		if m := regexp.MustCompile(`<string>\w+:(\w+)</string>`).FindStringSubmatch(body); m != nil {
+			name = m[1]
+		}
+		switch {
+		case strings.Contains(body, "supervisor.getAllProcessInfo"):
+			w.Write([]byte(processInfoArrayResponse(states)))
+		case strings.Contains(body, "supervisor.startProcess"):
+			calls = append(calls, name)
+			fault := map[string]string{"started": "60 ALREADY_STARTED", "bad": "50 SPAWN_ERROR"}[name]
+			if fault != "" {
+				// started by the failed call before
+				fields := strings.Fields(fault)
+				w.Write([]byte(fmt.Sprintf(`<?xml version="1.0"?><methodResponse><fault><value><struct>
+<member><name>faultCode</name><value><int>%s</int></value></member>
+<member><name>faultString</name><value><string>%s: %s</string></value></member>
+</struct></value></fault></methodResponse>`, fields[0], fields[1], name)))
+				return
+			}
+			w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`))
+		case strings.Contains(body, "supervisor.getProcessInfo"):
+			w.Write([]byte(fmt.Sprintf(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>name</name><value><string>%s</string></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+</struct></value></param></params></methodResponse>`, name)))
+		}
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ResumeAllProcessState("start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(calls)
+	if !reflect.DeepEqual(calls, []string{"bad", "started", "stopped"}) {
+		t.Errorf("Only the processes not running should be started, calls=%v", calls)
+	}
+	names := make([]string, 0)
+	for _, info := range reply.Value {
+		if info.Statename == "RUNNING" {
+			names = append(names, info.Name)
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"running", "started", "stopped"}) {
+		t.Errorf("Wrong succeeded processes: %+v", reply.Value)
+	}
+	expected := []ProcessFault{{Name: "bad", FaultCode: 50, FaultString: "SPAWN_ERROR: bad"}}
+	if !reflect.DeepEqual(reply.Faults, expected) || len(reply.Pending) != 0 {
+		t.Errorf("Wrong failed processes: %+v", reply)
+	}
+}
+
+func TestChangeAllProcessStateWithFaults(t *testing.T) {
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct>
+<member><name>name</name><value><string>ok</string></value></member>
+<member><name>group</name><value><string>ok</string></value></member>
+<member><name>status</name><value><int>80</int></value></member>
+<member><name>description</name><value><string>OK</string></value></member>
+</struct></value>
+<value><struct>
+<member><name>name</name><value><string>bad</string></value></member>
+<member><name>group</name><value><string>bad</string></value></member>
+<member><name>status</name><value><int>50</int></value></member>
+<member><name>description</name><value><string>SPAWN_ERROR: bad</string></value></member>
+</struct></value>
+<value><struct>
+<member><name>faultCode</name><value><int>10</int></value></member>
+<member><name>faultString</name><value><string>BAD_NAME: gone</string></value></member>
+</struct></value>
+</data></array></value></param></params></methodResponse>`, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ChangeAllProcessState("start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Value) != 1 || reply.Value[0].Name != "ok" || reply.Value[0].Group != "ok" {
+		t.Errorf("Wrong succeeded processes: %v", reply.Value)
+	}
+	expected := []ProcessFault{{Name: "bad", FaultCode: 50, FaultString: "SPAWN_ERROR: bad"},
+		{Name: "", FaultCode: 10, FaultString: "BAD_NAME: gone"}}
+	if !reflect.DeepEqual(reply.Faults, expected) {
+		t.Errorf("Wrong failed processes: %v", reply.Faults)
+	}
+}
+
+func TestMulticall(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><array><data><value><string>3.0</string></value></data></array></value>
+<value><struct>
+<member><name>faultCode</name><value><int>10</int></value></member>
+<member><name>faultString</name><value><string>BAD_NAME: test</string></value></member>
+</struct></value>
+</data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	results, err := client.Multicall([]MethodCall{{MethodName: "supervisor.getVersion"},
+		{MethodName: "supervisor.getProcessInfo", Params: []interface{}{"test"}}})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("Fail to call multicall, err=%v", err)
+	}
+	if results[0].Fault != nil || results[0].Value != "3.0" {
+		t.Error("Fail to get the result of first call")
+	}
+	if results[1].Fault == nil || results[1].Fault.Code != 10 {
+		t.Error("Fail to get the fault of second call")
+	}
+	if !strings.Contains(reqBody, "<name>methodName</name><value><string>supervisor.getProcessInfo</string></value>") {
+		t.Errorf("Fail to encode the calls: %s", reqBody)
+	}
+}
+
+func TestSendProcessStdin(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.SendProcessStdin("test", "reload <now>\r\n")
+	if err != nil || !reply.Success {
+		t.Errorf("Fail to send stdin, err=%v", err)
+	}
+	if !strings.Contains(reqBody, "<string>reload &lt;now&gt;&#xD;&#xA;</string>") {
+		t.Errorf("Fail to escape the chars: %s", reqBody)
+	}
+	if _, err = client.SendProcessStdin("test", "\x00"); err == nil {
+		t.Error("The invalid xml character is sent")
+	}
+}
+
+func TestSendRemoteCommEvent(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.SendRemoteCommEvent("test", "a < b")
+	if err != nil || !reply.Success {
+		t.Errorf("Fail to send the event, err=%v", err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.sendRemoteCommEvent</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+	if !strings.Contains(reqBody, "<param><value><string>test</string></value></param><param><value><string>a &lt; b</string></value></param>") {
+		t.Errorf("The arguments are not sent as two strings: %s", reqBody)
+	}
+}
+
+func TestStartProcessGroup(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>web1</string></value></member><member><name>group</name><value><string>web</string></value></member><member><name>statename</name><value><string>RUNNING</string></value></member></struct></value>
+<value><struct><member><name>name</name><value><string>web2</string></value></member><member><name>group</name><value><string>web</string></value></member><member><name>statename</name><value><string>FATAL</string></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.StartProcessGroup("web")
+	if err != nil || len(reply.Value) != 2 || reply.Value[1].Statename != "FATAL" {
+		t.Errorf("Fail to get the result of group members, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.startProcessGroup</methodName>") ||
+		!strings.Contains(reqBody, "<string>web</string>") || !strings.Contains(reqBody, "<boolean>1</boolean>") {
+		t.Errorf("Wrong request is sent: %s", reqBody)
+	}
+}
+
+func TestStopUnknownProcessGroup(t *testing.T) {
+	server := startTestServer(badNameFault, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	if _, err := client.StopProcessGroup("test"); !errors.Is(err, ErrBadName) {
+		t.Errorf("Expect BAD_NAME fault, but got %v", err)
+	}
+}
+
+func TestGetSupervisorVersion(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>1.0.013</string></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetSupervisorVersion()
+	if err != nil || reply.Value != "1.0.013" {
+		t.Errorf("Fail to get the supervisord version, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.getSupervisorVersion</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+}
+
+func TestGetAllConfigInfo(t *testing.T) {
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>web</string></value></member><member><name>group</name><value><string>web</string></value></member><member><name>inuse</name><value><boolean>1</boolean></value></member><member><name>autostart</name><value><boolean>0</boolean></value></member><member><name>command</name><value><string>/bin/web -p 80</string></value></member><member><name>process_prio</name><value><int>100</int></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetAllConfigInfo()
+	if err != nil || len(reply.Value) != 1 {
+		t.Fatalf("Fail to get the config info, reply=%v, err=%v", reply, err)
+	}
+	info := reply.Value[0]
+	if info.Name != "web" || !info.Inuse || info.Autostart || info.Command != "/bin/web -p 80" || info.Process_prio != 100 {
+		t.Errorf("Wrong config info: %v", info)
+	}
+}
+
+func TestReadLog(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>log data</string></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.ReadLog(-100, 0)
+	if err != nil || reply.Value != "log data" {
+		t.Errorf("Fail to read log, err=%v", err)
+	}
+	if !strings.Contains(reqBody, "<int>-100</int>") {
+		t.Errorf("The offset is not passed: %s", reqBody)
+	}
+	// the offset beyond 4GiB is not narrowed
+	if _, err = client.ReadLog(5000000000, 10); err != nil || !strings.Contains(reqBody, "<int>5000000000</int>") || !strings.Contains(reqBody, "supervisor.readLog") {
+		t.Errorf("The large offset is not passed: %s, err=%v", reqBody, err)
+	}
+}
+
+func TestGetState(t *testing.T) {
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>statecode</name><value><int>0</int></value></member>
+<member><name>statename</name><value><string>RESTARTING</string></value></member>
+</struct></value></param></params></methodResponse>`, nil)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.GetState()
+	if err != nil || reply.Statecode != STATE_RESTARTING || reply.Statename != "RESTARTING" {
+		t.Errorf("Fail to get state, err=%v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	var reqBody string
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><struct>
+<member><name>statecode</name><value><int>1</int></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+</struct></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	if err := client.Ping(); err != nil || !strings.Contains(reqBody, "supervisor.getState") {
+		t.Errorf("Fail to ping supervisord, err=%v", err)
+	}
+
+	faultServer := startTestServer(badNameFault, nil)
+	defer faultServer.Close()
+	if err := NewXmlRPCClient(faultServer.URL).Ping(); !IsFault(err, ErrBadName.Code) {
+		t.Errorf("The fault is not returned by ping, err=%v", err)
+	}
+
+	err := NewXmlRPCClient("unix:///nonexistent/supervisord.sock").Ping()
+	if !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("The connection error is not returned by ping, err=%v", err)
+	}
+}
+
+func TestRPCPath(t *testing.T) {
+	path := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.GetVersion()
+	if path != "/RPC2" {
+		t.Errorf("The default path is %s", path)
+	}
+	client.SetRPCPath("/supervisor/RPC2")
+	client.GetVersion()
+	if path != "/supervisor/RPC2" {
+		t.Errorf("The custom path is not used, path=%s", path)
+	}
+}
+
+func TestAuthHeader(t *testing.T) {
+	auth := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.SetUser("user")
+	client.SetPassword("password")
+	client.GetVersion()
+	if !strings.HasPrefix(auth, "Basic ") {
+		t.Errorf("The basic auth is not sent, Authorization=%s", auth)
+	}
+	client.SetAuthToken("token")
+	client.GetVersion()
+	if auth != "Bearer token" {
+		t.Errorf("The token is not sent, Authorization=%s", auth)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(testHandler(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`, nil))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	if _, err := client.GetVersion(); err == nil {
+		t.Error("The unknown server certificate is accepted")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	client.SetTLSConfig(&tls.Config{RootCAs: pool})
+	if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+		t.Errorf("Fail to get version with the CA, err=%v", err)
+	}
+
+	client = NewXmlRPCClient(server.URL)
+	client.SetInsecureSkipVerify(true)
+	if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+		t.Errorf("Fail to get version without verification, err=%v", err)
+	}
+}
+
+func TestRetryUntilServerStarted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xmlrpcclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sockFile := filepath.Join(dir, "supervisord.sock")
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		listener, err := net.Listen("unix", sockFile)
+		if err == nil {
+			http.Serve(listener, testHandler(`<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`, nil))
+		}
+	}()
+
+	client := NewXmlRPCClient("unix://" + sockFile)
+	client.SetRetry(6, 50*time.Millisecond)
+	if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+		t.Errorf("Fail to retry the request, err=%v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	client := NewXmlRPCClient("http://localhost:9001")
+	client.SetRetry(1000, 100*time.Millisecond)
+	tests := map[int]time.Duration{1: 100 * time.Millisecond,
+		2:   200 * time.Millisecond,
+		4:   800 * time.Millisecond,
+		10:  maxRetryDelay,
+		100: maxRetryDelay,
+		999: maxRetryDelay}
+	for attempt, expected := range tests {
+		if delay := client.retryDelayAfter(attempt); delay != expected {
+			t.Errorf("Wrong delay %v after attempt %d, expected %v", delay, attempt, expected)
+		}
+	}
+	// the base delay is not lowered
+	client.SetRetry(1000, time.Minute)
+	if delay := client.retryDelayAfter(100); delay != time.Minute {
+		t.Errorf("Wrong delay %v of the base delay beyond the maximum", delay)
+	}
+}
+
+func TestNoRetryOnFault(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(badNameFault))
+	}))
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	client.SetRetry(3, 10*time.Millisecond)
+	if _, err := client.GetProcessInfo("test"); !IsFault(err, ErrBadName.Code) || requests != 1 {
+		t.Errorf("The fault is retried, requests=%d", requests)
+	}
+}
+
+func TestWrappedConnectionError(t *testing.T) {
+	client := NewXmlRPCClient("unix:///nonexistent/supervisord.sock")
+	_, err := client.GetVersion()
+	if !errors.Is(err, syscall.ENOENT) || !strings.Contains(err.Error(), "supervisord") {
+		t.Errorf("The connection error is not wrapped, err=%v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>test</string></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	args := struct{ Name string }{"test"}
+	reply := struct{ Value string }{}
+	if err := client.Call("supervisor.someMethod", &args, &reply); err != nil || reply.Value != "test" {
+		t.Errorf("Fail to call the method, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>supervisor.someMethod</methodName>") || !strings.Contains(reqBody, "<string>test</string>") {
+		t.Errorf("Wrong request is sent: %s", reqBody)
+	}
+	if err := client.Call("supervisor.someMethod", nil, &reply); err != nil {
+		t.Errorf("Fail to call the method without args, err=%v", err)
+	}
+}
+
+const versionResponse = `<?xml version="1.0"?><methodResponse><params><param><value><string>3.0</string></value></param></params></methodResponse>`
+
+const startStopResponse = `<?xml version="1.0"?><methodResponse><params><param><value><boolean>1</boolean></value></param></params></methodResponse>`
+
+func TestUnixSocketReuseConnection(t *testing.T) {
+	l, sockFile, err := listenTestUnixSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	listener := &countListener{Listener: l}
+	defer listener.Close()
+	go http.Serve(listener, testHandler(versionResponse, nil))
+
+	client := NewXmlRPCClient("unix://" + sockFile)
+	for i := 0; i < 10; i++ {
+		if _, err := client.GetVersion(); err != nil {
+			t.Fatalf("Fail to get version through unix socket, err=%v", err)
+		}
+	}
+	if accepted := atomic.LoadInt32(&listener.accepted); accepted != 1 {
+		t.Errorf("The connection is not reused, %d connections are dialed", accepted)
+	}
+}
+
+func TestUnixSocketChunkedResponse(t *testing.T) {
+	l, sockFile, err := listenTestUnixSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	listener := &countListener{Listener: l}
+	defer listener.Close()
+	response := `<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>test</string></value></member>
+<member><name>status</name><value><int>80</int></value></member></struct></value>
+</data></array></value></param></params></methodResponse>`
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		// the response without the content length is sent in chunks, the
+		// last chunk is not read by the decoder stopping at the end of xml
+		for i := 0; i < len(response); i += 64 {
+			w.Write([]byte(response[i:int(math.Min(float64(i+64), float64(len(response))))]))
+			w.(http.Flusher).Flush()
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("\n"))
+	}))
+
+	client := NewXmlRPCClient("unix://" + sockFile)
+	for i := 0; i < 5; i++ {
+		reply, err := client.ChangeAllProcessState("start")
+		if err != nil || len(reply.Value) != 1 || reply.Value[0].Name != "test" {
+			t.Fatalf("Fail to read the chunked response, reply=%v, err=%v", reply, err)
+		}
+		if all, err := client.GetAllProcessInfo(); err != nil || len(all.Value) != 1 {
+			t.Fatalf("Fail to read the chunked response, reply=%v, err=%v", all, err)
+		}
+	}
+	if accepted := atomic.LoadInt32(&listener.accepted); accepted != 1 {
+		t.Errorf("The connection is not reused after the chunked response, %d connections are dialed", accepted)
+	}
+}
+
+func TestDialFunc(t *testing.T) {
+	listener, sockFile, err := listenTestUnixSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	// the https server listening on an unix socket
+	server := httptest.NewUnstartedServer(testHandler(versionResponse, nil))
+	server.Listener.Close()
+	server.Listener = listener
+	server.StartTLS()
+	defer server.Close()
+
+	var dials int32
+	client := NewXmlRPCClient("https://supervisord.invalid")
+	client.SetDialFunc(func(ctx context.Context) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "unix", sockFile)
+		if err != nil {
+			return nil, err
+		}
+		return tls.Client(conn, &tls.Config{InsecureSkipVerify: true}), nil
+	})
+	for i := 0; i < 3; i++ {
+		if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+			t.Fatalf("Fail to get version through the dial func, reply=%v, err=%v", reply, err)
+		}
+	}
+	if atomic.LoadInt32(&dials) != 1 {
+		t.Errorf("The connection of the dial func is not reused, %d connections are dialed", dials)
+	}
+
+	// the default dial connects to the host of server url
+	client.SetDialFunc(nil)
+	if _, err := client.GetVersion(); err == nil || atomic.LoadInt32(&dials) != 1 {
+		t.Errorf("The default dial should be restored, dials=%d, err=%v", dials, err)
+	}
+}
+
+type connRequestsKey struct{}
+
+func TestUnixSocketFallbackToNewConnection(t *testing.T) {
+	listener, sockFile, err := listenTestUnixSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	defer listener.Close()
+	// the idle connections are closed by the server
+	server := &http.Server{IdleTimeout: 10 * time.Millisecond, Handler: testHandler(versionResponse, nil)}
+	go server.Serve(listener)
+
+	client := NewXmlRPCClient("unix://" + sockFile)
+	for i := 0; i < 3; i++ {
+		if reply, err := client.GetVersion(); err != nil || reply.Value != "3.0" {
+			t.Errorf("Fail to send the request on a new connection, err=%v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestNoResendAfterRequestWritten(t *testing.T) {
+	listener, sockFile, err := listenTestUnixSocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(sockFile))
+	defer listener.Close()
+	// every connection is closed silently after its second request is read
+	var received int32
+	server := &http.Server{
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, connRequestsKey{}, new(int))
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			atomic.AddInt32(&received, 1)
+			requests := r.Context().Value(connRequestsKey{}).(*int)
+			*requests++
+			if *requests > 1 {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.Write([]byte(startStopResponse))
+		}),
+	}
+	go server.Serve(listener)
+
+	client := NewXmlRPCClient("unix://" + sockFile)
+	if _, err := client.ChangeProcessState("start", "test"); err != nil {
+		t.Fatalf("Fail to start the process, err=%v", err)
+	}
+	// the request read by the server may be handled, so it is not sent again
+	if _, err := client.ChangeProcessState("start", "test"); err == nil {
+		t.Error("The request closed by the server after it is read should fail")
+	}
+	if n := atomic.LoadInt32(&received); n != 2 {
+		t.Errorf("The written request is sent again, %d requests are received", n)
+	}
+}
+
+func BenchmarkUnixSocket(b *testing.B) {
+	for _, keepAlive := range []bool{true, false} {
+		b.Run(fmt.Sprintf("keepalive=%v", keepAlive), func(b *testing.B) {
+			l, sockFile, err := listenTestUnixSocket()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(filepath.Dir(sockFile))
+			listener := &countListener{Listener: l}
+			defer listener.Close()
+			go http.Serve(listener, testHandler(versionResponse, nil))
+
+			client := NewXmlRPCClient("unix://" + sockFile)
+			transport, _ := client.getTransport()
+			transport.DisableKeepAlives = !keepAlive
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.GetVersion(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt32(&listener.accepted)), "dials")
+		})
+	}
+}
+
+func TestInvalidScheme(t *testing.T) {
+	client := NewXmlRPCClient("htpp://localhost:9001")
+	if err := client.Validate(); err == nil || !strings.Contains(err.Error(), "htpp") {
+		t.Errorf("The invalid scheme is not detected, err=%v", err)
+	}
+	// it must return the error instead of panic with a nil response
+	if _, err := client.GetAllProcessInfo(); err == nil {
+		t.Errorf("No error for the invalid scheme")
+	}
+	for _, serverurl := range []string{"http://localhost:9001", "https://localhost:9001", "unix:///tmp/supervisord.sock"} {
+		if err := NewXmlRPCClient(serverurl).Validate(); err != nil {
+			t.Errorf("The valid url %s is rejected, err=%v", serverurl, err)
+		}
+	}
+}
+
+func TestListMethods(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data><value><string>supervisor.getState</string></value><value><string>system.listMethods</string></value></data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	methods, err := client.ListMethods()
+	if err != nil || len(methods) != 2 || methods[0] != "supervisor.getState" || methods[1] != "system.listMethods" {
+		t.Errorf("Fail to list the methods, methods=%v, err=%v", methods, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>system.listMethods</methodName>") {
+		t.Errorf("Wrong method is called: %s", reqBody)
+	}
+}
+
+func TestMethodHelp(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><string>Get info about a process</string></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	help, err := client.MethodHelp("supervisor.getProcessInfo")
+	if err != nil || help != "Get info about a process" {
+		t.Errorf("Fail to get the method help, help=%s, err=%v", help, err)
+	}
+	if !strings.Contains(reqBody, "<methodName>system.methodHelp</methodName>") || !strings.Contains(reqBody, "<string>supervisor.getProcessInfo</string>") {
+		t.Errorf("Wrong request is sent: %s", reqBody)
+	}
+}
+
+// a supervisord serving tailProcessStdoutLog from the log, the offset beyond
+// the log gets its size
+func startTestTailServer(log string) *httptest.Server {
+	intPattern := regexp.MustCompile(`<(?:int|i4)>(-?[0-9]+)</(?:int|i4)>`)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		args := intPattern.FindAllStringSubmatch(string(b), -1)
+		offset, _ := strconv.Atoi(args[0][1])
+		length, _ := strconv.Atoi(args[1][1])
+		data := ""
+		if offset < len(log) {
+			if offset+length > len(log) {
+				length = len(log) - offset
+			}
+			data = log[offset : offset+length]
+		} else {
+			offset = len(log)
+		}
+		fmt.Fprintf(w, `<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><string>%s</string></value><value><int>%d</int></value><value><boolean>0</boolean></value>
+</data></array></value></param></params></methodResponse>`, data, offset+len(data))
+	}))
+}
+
+func TestTailProcessStdoutLogLargeOffset(t *testing.T) {
+	reqBody := ""
+	server := startTestServer(`<?xml version="1.0"?><methodResponse><params><param><value><array><data>
+<value><string>log</string></value><value><int>5000000003</int></value><value><boolean>0</boolean></value>
+</data></array></value></param></params></methodResponse>`, &reqBody)
+	defer server.Close()
+
+	client := NewXmlRPCClient(server.URL)
+	reply, err := client.TailProcessStdoutLog("test", 5000000000, 3)
+	if err != nil || reply.LogData != "log" || reply.Offset != 5000000003 {
+		t.Errorf("Fail to tail the log beyond 4GiB, reply=%v, err=%v", reply, err)
+	}
+	if !strings.Contains(reqBody, "supervisor.tailProcessStdoutLog") || !strings.Contains(reqBody, "<int>5000000000</int>") {
+		t.Errorf("Wrong request: %s", reqBody)
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	tailLinesChunkSize = 8
+	defer func() { tailLinesChunkSize = 4096 }()
+	log := "line 1\nline 2\nline 3 is a longer line\nline 4\npartial"
+	server := startTestTailServer(log)
+	defer server.Close()
+	client := NewXmlRPCClient(server.URL)
+
+	tests := []struct {
+		n     int
+		lines string
+	}{
+		{1, "line 4"},
+		{2, "line 3 is a longer line,line 4"},
+		{4, "line 1,line 2,line 3 is a longer line,line 4"},
+		{10, "line 1,line 2,line 3 is a longer line,line 4"},
+	}
+	for _, test := range tests {
+		reply, err := client.TailLines("test", test.n)
+		if err != nil || strings.Join(reply.Lines, ",") != test.lines {
+			t.Errorf("Wrong last %d lines %q, err=%v", test.n, reply.Lines, err)
+		}
+		// the partial line is read after the offset
+		if reply.Offset != int64(strings.Index(log, "partial")) {
+			t.Errorf("Wrong offset %d of the last %d lines", reply.Offset, test.n)
+		}
+	}
+
+	// no line is read for 0 and the offset is the end of the log
+	reply, err := client.TailLines("test", 0)
+	if err != nil || len(reply.Lines) != 0 || reply.Offset != int64(len(log)) {
+		t.Errorf("Wrong last 0 lines %q, offset=%d, err=%v", reply.Lines, reply.Offset, err)
+	}
+	if _, err = client.TailLines("test", -1); err == nil {
+		t.Error("The negative number of lines should be rejected")
+	}
+}